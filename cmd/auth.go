@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/llm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Store and inspect the API key revly uses",
+	Long: `
+revly looks for the API key in this order and uses the first it finds:
+
+	1. the output of llm.key_command, e.g. "pass show openrouter" (user config only)
+	2. the variable named by llm.key_env, if set (user config only)
+	3. LLM_API_KEY
+	4. the provider's usual variable: OPENROUTER_API_KEY, OPENAI_API_KEY,
+	   ANTHROPIC_API_KEY, GEMINI_API_KEY or GOOGLE_API_KEY
+	5. the credentials file, ~/.revly/credentials.toml, written by 'revly auth login'
+
+Variables can also be set in .env at the repository root. Keys in the
+credentials file are stored per endpoint host, so a key is only sent to the
+host it was saved for, and never to an endpoint the repository config set.
+The file is created readable only by you, and revly
+refuses to read it if that changes.`,
+	Example: `
+	revly auth login
+		- Paste the key for the configured endpoint; it is checked, then saved.
+
+	pass show openrouter | revly auth login
+		- Read the key from stdin instead.
+
+	revly auth status
+		- Show which key is used and where each source stands.
+
+	revly auth login --profile work
+		- Store the key for the endpoint of the "work" profile.
+`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Save an API key for the configured endpoint in the credentials file",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			return
+		}
+		if !llm.RequiresAPIKey(cfg.LLM) {
+			fmt.Printf("%s doesn't need an API key.\n", cfg.LLM.Provider)
+			return
+		}
+		name := llm.CredentialName(cfg.LLM)
+
+		key, err := readKey(fmt.Sprintf("API key for %s: ", name))
+		if err != nil {
+			color.Red("Failed to read the key: %v", err)
+			return
+		}
+		if key == "" {
+			color.Red("No key given; nothing saved.")
+			return
+		}
+
+		skipCheck, _ := cmd.Flags().GetBool("skip-check")
+		if models := cfg.Task("review").Models; !skipCheck && len(models) > 0 {
+			fmt.Printf("Checking the key with %s...\n", models[0])
+			if _, err := llm.CheckModel(cmd.Context(), cfg.LLM, key, models[0]); err != nil {
+				if llm.IsAuthError(err) {
+					color.Red("%s rejected the key; nothing saved: %v", name, err)
+					return
+				}
+				color.Yellow("Couldn't confirm the key works (%v); saving it anyway.", err)
+			}
+		}
+
+		if err := llm.SaveCredential(name, key); err != nil {
+			color.Red("Failed to save the key: %v", err)
+			return
+		}
+		color.Green("Saved the key for %s in %s", name, llm.CredentialsFile())
+		if cred, err := llm.ResolveKey(cfg.LLM); err == nil && cred.Source != "credentials file" {
+			color.Yellow("The key in %s is still used first; unset it to use the saved one.", cred.Source)
+		}
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the saved API key for the configured endpoint",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if all, _ := cmd.Flags().GetBool("all"); all {
+			if err := os.Remove(llm.CredentialsFile()); err != nil && !os.IsNotExist(err) {
+				color.Red("Failed to remove %s: %v", llm.CredentialsFile(), err)
+				return
+			}
+			color.Green("Removed every saved key.")
+			return
+		}
+
+		cfg, err := config.GetConfig()
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			return
+		}
+		name := llm.CredentialName(cfg.LLM)
+		removed, err := llm.DeleteCredential(name)
+		switch {
+		case err != nil:
+			color.Red("Failed to remove the key: %v", err)
+		case !removed:
+			color.Yellow("No key is saved for %s.", name)
+		default:
+			color.Green("Removed the saved key for %s.", name)
+		}
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which API key is used and where revly looked for it",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			color.Yellow("%v", err)
+		}
+		provider := cfg.LLM.Provider
+		if provider == "" {
+			provider = "openrouter"
+		}
+		fmt.Printf("Provider: %s\n", provider)
+		fmt.Printf("Endpoint: %s\n", llm.EndpointURL(cfg.LLM))
+		if name, source := config.Profile(); name != "" {
+			fmt.Printf("Profile:  %s (selected by %s)\n", name, source)
+		}
+		if !llm.RequiresAPIKey(cfg.LLM) {
+			fmt.Println("No API key is needed.")
+			return
+		}
+
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		used := false
+		for _, s := range llm.KeySources(cfg.LLM) {
+			name := s.Name
+			if name == "credentials file" {
+				name += " (" + llm.CredentialName(cfg.LLM) + ")"
+			}
+			key, err := s.Lookup()
+			switch {
+			case err != nil:
+				fmt.Fprintf(w, "  %s\t%s\n", name, color.RedString("error: %v", err))
+			case key == "":
+				fmt.Fprintf(w, "  %s\tnot set\n", name)
+			case !used:
+				used = true
+				fmt.Fprintf(w, "%s %s\t%s\n", color.GreenString("→"), name, color.GreenString("%s (used)", maskKey(key)))
+			default:
+				fmt.Fprintf(w, "  %s\t%s\n", name, maskKey(key))
+			}
+		}
+		w.Flush()
+		if !used {
+			fmt.Println()
+			color.Red("No API key found. Run 'revly auth login' or set %s.", llm.KeyEnvs(cfg.LLM)[0])
+		}
+	},
+}
+
+// readKey reads a key without echoing it from a terminal, or the first line
+// of stdin when it is piped.
+func readKey(prompt string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Print(prompt)
+		secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		return strings.TrimSpace(string(secret)), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line, nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return "", nil
+}
+
+// maskKey shows just enough of a key to tell keys apart.
+func maskKey(key string) string {
+	if len(key) < 12 {
+		return "****"
+	}
+	return key[:4] + "…" + key[len(key)-4:]
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authLoginCmd, authLogoutCmd, authStatusCmd)
+	authLoginCmd.Flags().Bool("skip-check", false, "Save the key without trying it against the first review model")
+	authLogoutCmd.Flags().Bool("all", false, "Remove the whole credentials file")
+}
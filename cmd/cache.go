@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/cache"
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/llm"
+	"github.com/spf13/cobra"
+)
+
+// cacheSlot returns the cache key for task's answer to input, and the header
+// to store with it.
+func cacheSlot(task string, input []byte) (string, cache.Meta, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", cache.Meta{}, err
+	}
+	models := cfg.Task(task).Models
+	promptHash, err := llm.PromptVersion(cfg, task)
+	if err != nil {
+		return "", cache.Meta{}, err
+	}
+	meta := cache.Meta{Task: task, Models: models, PromptHash: promptHash}
+	return cache.Key(task, models, promptHash, input), meta, nil
+}
+
+// saveToCache stores data with the models and tokens counted by tally.
+func saveToCache(key string, meta cache.Meta, tally *llm.Tally, data []byte) {
+	meta.Model = strings.Join(tally.Models(), ",")
+	meta.PromptTokens, meta.CompletionTokens = tally.Tokens()
+	if err := cache.Save(key, meta, data); err != nil {
+		color.Yellow("Couldn't cache the result: %v", err)
+	}
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and clean up cached reviews and pair suggestions",
+	Long: `
+Reviews and pair suggestions are cached in .revly/cache/<task>/ so the same
+diff isn't sent twice. Entries older than [cache] ttl are ignored, and once
+the cache outgrows [cache] max_size_mb the least recently used entries are
+evicted. Empty and unreadable entries are removed too. This happens on its
+own as revly writes to the cache; 'revly cache prune' does it on demand.
+
+With [cache.remote] set, local misses are looked up in a shared directory or
+HTTP server, and new entries are uploaded to it. These commands only manage
+the local cache.
+
+	[cache]
+	ttl = "720h"
+	max_size_mb = 50`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show cache size and entry counts per task",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := cache.List()
+		if err != nil {
+			color.Red("Error reading cache: %v", err)
+			return
+		}
+		policy := cache.CurrentPolicy()
+
+		type taskStats struct {
+			entries, expired, corrupt int
+			size                      int64
+		}
+		byTask := map[string]*taskStats{}
+		var tasks []string
+		var total taskStats
+		for _, e := range entries {
+			name := e.Task
+			if e.Corrupt {
+				name = "(corrupt)"
+			}
+			s, ok := byTask[name]
+			if !ok {
+				s = &taskStats{}
+				byTask[name] = s
+				tasks = append(tasks, name)
+			}
+			for _, s := range []*taskStats{s, &total} {
+				s.entries++
+				s.size += e.Size
+				switch {
+				case e.Corrupt:
+					s.corrupt++
+				case policy.Expired(e.Meta):
+					s.expired++
+				}
+			}
+		}
+		sort.Strings(tasks)
+
+		color.Cyan("Cache: %s, %d entries (limit %s, ttl %s)", formatBytes(total.size), total.entries, describeLimit(policy.MaxSize), describeTTL(policy.TTL))
+		if _, _, err := cache.Remote(); err != nil {
+			color.Red("Shared cache: %v", err)
+		} else if cfg, _ := config.GetConfig(); cfg.Cache.Remote.Type != "" {
+			r := cfg.Cache.Remote
+			where, mode := r.URL, "read-write"
+			if r.Type == "dir" {
+				where = r.Path
+			}
+			if r.ReadOnly {
+				mode = "read-only"
+			}
+			fmt.Printf("Shared cache: %s %s (%s)\n", r.Type, where, mode)
+		}
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintf(w, "TASK\tENTRIES\tEXPIRED\tCORRUPT\tSIZE\t\n")
+		for _, t := range tasks {
+			s := byTask[t]
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t\n", t, s.entries, s.expired, s.corrupt, formatBytes(s.size))
+		}
+		w.Flush()
+		if total.expired+total.corrupt > 0 {
+			fmt.Printf("\nRun 'revly cache prune' to remove %d expired or corrupt entries.\n", total.expired+total.corrupt)
+		}
+	},
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list [task]",
+	Short: "List cache entries, most recently used first",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := cache.List()
+		if err != nil {
+			color.Red("Error reading cache: %v", err)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "KEY\tTASK\tMODEL\tTOKENS\tSIZE\tCREATED\tLAST USED\n")
+		shown := 0
+		for _, e := range entries {
+			if len(args) == 1 && e.Task != args[0] {
+				continue
+			}
+			shown++
+			if e.Corrupt {
+				fmt.Fprintf(w, "%s\t%s\t(corrupt)\t-\t%s\t-\t%s\n", shortKey(e.Key), e.Task, formatBytes(e.Size), e.LastUsed.Local().Format("2006-01-02 15:04"))
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", shortKey(e.Key), e.Task, e.Meta.Model,
+				e.Meta.PromptTokens+e.Meta.CompletionTokens, formatBytes(e.Size),
+				e.Meta.CreatedAt.Local().Format("2006-01-02 15:04"), e.LastUsed.Local().Format("2006-01-02 15:04"))
+		}
+		if shown == 0 {
+			color.Yellow("The cache is empty.")
+			return
+		}
+		w.Flush()
+	},
+}
+
+var cacheShowCmd = &cobra.Command{
+	Use:   "show <key>",
+	Short: "Print a cache entry's header and contents",
+	Long:  `Prints one cache entry. The key can be shortened to any unique prefix, as shown by 'revly cache list'.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e, err := cache.Find(args[0])
+		if err != nil {
+			color.Red("%v", err)
+			return
+		}
+		raw, err := cache.Read(e)
+		if err != nil {
+			color.Red("Error reading entry: %v", err)
+			return
+		}
+		if e.Corrupt {
+			color.Yellow("%s is corrupt; showing it as is.", e.Key)
+			fmt.Println(string(raw))
+			return
+		}
+
+		m := e.Meta
+		fmt.Printf("Key:      %s\n", e.Key)
+		fmt.Printf("Task:     %s\n", m.Task)
+		fmt.Printf("Models:   %s\n", strings.Join(m.Models, ", "))
+		fmt.Printf("Answered: %s\n", m.Model)
+		fmt.Printf("Prompt:   %s\n", m.PromptHash)
+		fmt.Printf("Tokens:   %d prompt, %d completion\n", m.PromptTokens, m.CompletionTokens)
+		fmt.Printf("Created:  %s\n", m.CreatedAt.Local().Format(time.RFC1123))
+		fmt.Printf("Used:     %s\n", e.LastUsed.Local().Format(time.RFC1123))
+		fmt.Println()
+		_, body, _ := bytes.Cut(raw, []byte("\n"))
+		fmt.Println(string(body))
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove expired and corrupt entries and trim the cache to its size limit",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		policy := cache.CurrentPolicy()
+		if ttl, _ := cmd.Flags().GetDuration("ttl"); cmd.Flags().Changed("ttl") {
+			policy.TTL = ttl
+		}
+		if mb, _ := cmd.Flags().GetInt("max-size-mb"); cmd.Flags().Changed("max-size-mb") {
+			policy.MaxSize = int64(mb) << 20
+		}
+
+		report, err := cache.Prune(policy, dryRun)
+		if err != nil {
+			color.Red("Error pruning cache: %v", err)
+			return
+		}
+		verb := "Removed"
+		if dryRun {
+			verb = "Would remove"
+		}
+		color.Green("%s %d entries (%d corrupt, %d expired, %d evicted), freeing %s. %s left.",
+			verb, report.Removed(), report.Corrupt, report.Expired, report.Evicted, formatBytes(report.Freed), formatBytes(report.Remaining))
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear [task]",
+	Short: "Delete every cache entry, or only those for one task",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		task := ""
+		if len(args) == 1 {
+			task = args[0]
+		}
+		n, err := cache.Clear(task)
+		if err != nil {
+			color.Red("Error clearing cache: %v", err)
+			return
+		}
+		color.Green("Removed %d cache entries.", n)
+	},
+}
+
+func shortKey(key string) string {
+	if len(key) > 12 {
+		return key[:12]
+	}
+	return key
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func describeLimit(n int64) string {
+	if n <= 0 {
+		return "none"
+	}
+	return formatBytes(n)
+}
+
+func describeTTL(d time.Duration) string {
+	if d <= 0 {
+		return "none"
+	}
+	return d.String()
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatsCmd, cacheListCmd, cacheShowCmd, cachePruneCmd, cacheClearCmd)
+	cachePruneCmd.Flags().Bool("dry-run", false, "Report what would be removed without deleting anything")
+	cachePruneCmd.Flags().Duration("ttl", 0, "Override [cache] ttl for this run")
+	cachePruneCmd.Flags().Int("max-size-mb", 0, "Override [cache] max_size_mb for this run")
+}
@@ -2,12 +2,15 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"strings"
 
+	"github.com/fatih/color"
 	"github.com/nareshkarthigeyan/revly/internals/config"
 	"github.com/nareshkarthigeyan/revly/internals/llm"
 	"github.com/spf13/cobra"
@@ -68,8 +71,7 @@ revly commit -m "Fix typo in README"
 
 		cfg, err := config.GetConfig()
 		if err != nil {
-			// // DEBUG: Error getting config
-			// fmt.Println("DEBUG: Error getting config:", err)
+			color.Red("Error loading config: %v", err)
 			return
 		}
 
@@ -102,7 +104,11 @@ revly commit -m "Fix typo in README"
 		if message != "" {
 			msg = message
 		} else {
-			aiMsg, err := llm.GetLLMResponse(diff)
+			aiMsg, err := llm.GetLLMResponse(cmd.Context(), diff)
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("Commit aborted.")
+				return
+			}
 			if err != nil {
 				log.Fatalf("Error generating commit message: %v", err)
 			}
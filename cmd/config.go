@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and edit revly's configuration",
+	Long: `
+Configuration is merged from several layers, each overriding the keys it sets:
+
+	1. built-in defaults
+	2. the user config, ~/.revly/config.toml (and the older ~/revly.config.toml)
+	3. the repository config, revly.config.toml at the repository root
+	4. the active [profiles.<name>] section, chosen with --profile,
+	   REVLY_PROFILE or the profile's match patterns
+	5. REVLY_* environment variables, e.g. REVLY_LLM_TIMEOUT=2m for llm.timeout
+	6. --set key=value flags, on any command
+
+So a repository can pin its models while your API endpoint and personal
+preferences live in the user config. Lists can be given comma-separated in
+environment variables and flags: REVLY_LLM_MODELS=model-a,model-b.`,
+	Example: `
+	revly config list --show-origin
+		- Every effective value and the layer it came from.
+
+	revly config get llm.models
+		- One value, or every value in a table ("revly config get llm").
+
+	revly config set models.review.temperature 0.2
+		- Write to the repository config; --user writes the user config.
+
+	revly review --set llm.timeout=10m
+		- Override a value for one run.
+
+	revly review --profile work
+		- Use the [profiles.work] overrides for one run.
+`,
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List every effective config value",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			color.Yellow("%v", err)
+		}
+		showOrigin, _ := cmd.Flags().GetBool("show-origin")
+		printEntries(config.Entries(cfg), showOrigin)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a key, or of every key in a table",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			color.Yellow("%v", err)
+		}
+		entries, err := config.Lookup(cfg, args[0])
+		if err != nil {
+			color.Red("%v", err)
+			return
+		}
+		showOrigin, _ := cmd.Flags().GetBool("show-origin")
+		if len(entries) == 1 && entries[0].Key == args[0] && !showOrigin {
+			fmt.Println(entries[0].Value)
+			return
+		}
+		printEntries(entries, showOrigin)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a key in the repository (or, with --user, the user) config",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := configTarget(cmd)
+		if err := config.Set(path, args[0], args[1]); err != nil {
+			color.Red("%v", err)
+			return
+		}
+		color.Green("Set %s in %s", args[0], path)
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a key from the repository (or, with --user, the user) config",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := configTarget(cmd)
+		removed, err := config.Unset(path, args[0])
+		if err != nil {
+			color.Red("%v", err)
+			return
+		}
+		if !removed {
+			color.Yellow("%s is not set in %s", args[0], path)
+			return
+		}
+		color.Green("Removed %s from %s", args[0], path)
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "List the config files revly reads, in the order they are merged",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, f := range config.Files() {
+			status := "not found"
+			if f.Exists() {
+				status = "loaded"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", f.Scope, f.Path, status)
+		}
+		if name, source := config.Profile(); name != "" {
+			fmt.Fprintf(w, "profile\t%s\tselected by %s\n", name, source)
+		}
+		w.Flush()
+	},
+}
+
+var configProfilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List the profiles defined in the config and which one is active",
+	Long: `
+A profile is a [profiles.<name>] section overriding [llm], [models] and [git]:
+
+	[profiles.work]
+	match = ["*github.com?acme/*"]
+
+	[profiles.work.llm]
+	provider = "openai-compatible"
+	base_url = "https://llm-gateway.acme.internal/v1"
+	key_env = "ACME_LLM_KEY"
+
+It is used when named by --profile or REVLY_PROFILE, or when one of the
+repository's remote URLs matches a pattern in match (* matches anything,
+? a single character).`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := config.GetConfig(); err != nil {
+			color.Yellow("%v", err)
+		}
+		infos := config.Profiles()
+		if len(infos) == 0 {
+			fmt.Println("No profiles are defined.")
+			return
+		}
+		active, source := config.Profile()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "\tNAME\tMATCH\tDEFINED IN")
+		for _, p := range infos {
+			mark := ""
+			if p.Name == active {
+				mark = "*"
+			}
+			match := strings.Join(p.Match, ", ")
+			if match == "" {
+				match = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, p.Name, match, strings.Join(p.Files, ", "))
+		}
+		w.Flush()
+		if active != "" {
+			fmt.Printf("\nActive: %s, selected by %s\n", active, source)
+		} else {
+			fmt.Println("\nNo profile is active.")
+		}
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check the config for unknown keys and invalid values",
+	Long: `
+Checks the merged configuration, or a single file, for keys revly doesn't
+know (often a key in the wrong table), values of the wrong type or out of
+range, and settings that don't fit together. Exits with status 1 if there
+are errors, so it can run in CI:
+
+	revly config validate revly.config.toml
+
+Files in an older config format still load, but are reported; run
+'revly config migrate' to upgrade them.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		var problems []config.Problem
+		if len(args) == 1 {
+			var err error
+			problems, err = config.ValidateFile(args[0])
+			if err != nil {
+				color.Red("%v", err)
+				os.Exit(1)
+			}
+		} else {
+			_, err := config.GetConfig()
+			var invalid *config.ValidationError
+			if err != nil && !errors.As(err, &invalid) {
+				problems = append(problems, config.Problem{Message: err.Error()})
+			}
+			problems = append(problems, config.Problems()...)
+		}
+
+		failed := false
+		for _, p := range problems {
+			failed = failed || !p.Warning
+		}
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(map[string]any{"valid": !failed, "problems": problems})
+		} else {
+			for _, p := range problems {
+				if p.Warning {
+					color.Yellow("warning: %s", p)
+				} else {
+					color.Red("error: %s", p)
+				}
+			}
+			if !failed {
+				color.Green("Config is valid.")
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate [file]",
+	Short: "Upgrade config files in an older format",
+	Long: `
+Rewrites config files written in an older format, such as ones from older
+versions of 'revly init', in the current one. Without a file, every config
+file revly reads is checked. The original of each upgraded file is kept as
+<file>.bak, with the same permissions.
+
+Old files load without this, migrated in memory; revly never rewrites them
+on its own.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var paths []string
+		if len(args) == 1 {
+			paths = args
+		} else {
+			for _, f := range config.Files() {
+				if f.Exists() {
+					paths = append(paths, f.Path)
+				}
+			}
+		}
+
+		failed := false
+		for _, path := range paths {
+			notes, upgraded, err := config.Migrate(path)
+			switch {
+			case err != nil:
+				color.Red("%s: %v", path, err)
+				failed = true
+			case !upgraded:
+				fmt.Printf("%s is up to date.\n", path)
+			default:
+				color.Green("Upgraded %s to config version %d; the previous file is %s.bak", path, config.SchemaVersion, path)
+				for _, n := range notes {
+					fmt.Printf("  - %s\n", n)
+				}
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func configTarget(cmd *cobra.Command) string {
+	if user, _ := cmd.Flags().GetBool("user"); user {
+		return config.UserFile()
+	}
+	for _, f := range config.Files() {
+		if f.Scope == "repo" {
+			return f.Path
+		}
+	}
+	return ""
+}
+
+func printEntries(entries []config.Entry, showOrigin bool) {
+	if !showOrigin {
+		for _, e := range entries {
+			fmt.Printf("%s = %s\n", e.Key, e.Value)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s = %s\n", e.Origin, e.Key, e.Value)
+	}
+	w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configListCmd, configGetCmd, configSetCmd, configUnsetCmd, configPathCmd, configProfilesCmd, configValidateCmd, configMigrateCmd)
+	configCmd.PersistentFlags().Bool("show-origin", false, "Show the file, variable or flag each value came from")
+	configSetCmd.Flags().Bool("user", false, "Write the user config (~/.revly/config.toml) instead of the repository's")
+	configUnsetCmd.Flags().Bool("user", false, "Edit the user config (~/.revly/config.toml) instead of the repository's")
+	configValidateCmd.Flags().Bool("json", false, "Print the problems as JSON")
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/fakellm"
+	"github.com/spf13/cobra"
+)
+
+var devCmd = &cobra.Command{
+	Use:   "dev",
+	Short: "Tools for developing and testing revly",
+}
+
+var fakeLLMCmd = &cobra.Command{
+	Use:   "fake-llm",
+	Short: "Run a local OpenAI-compatible LLM server with scripted replies",
+	Long: `
+Starts an OpenAI-compatible /v1/chat/completions server on localhost so the
+review, commit and pair commands can run without a real provider, for
+example in CI. Point revly at it with:
+
+	[llm]
+	provider = "openai-compatible"
+	base_url = "http://127.0.0.1:8787/v1"
+	models = ["fake"]
+
+Without a script it answers every prompt in the shape revly expects: an empty
+review, "chore: update files" for commits, and a short nudge for pair.
+
+A script is a TOML file of rules, tried in order:
+
+	[[rule]]
+	model = "flaky-*"        # glob on the requested model
+	status = 429             # answer with an error instead
+	retry_after = "1s"
+	times = 2                # only for the first two matching requests
+
+	[[rule]]
+	match = "commit message" # substring of the prompt
+	content = "feat: add fake server"
+
+	[[rule]]
+	tool = "read_file"       # call a tool, if the request offers tools
+	arguments = '{"path": "main.go"}'
+	times = 1
+
+	[[rule]]
+	file = "testdata/review.json"
+	latency = "200ms"
+
+Set LLM_API_KEY to anything; the server ignores it.
+
+To replay real provider traffic instead, record a cassette:
+
+	REVLY_CASSETTE=testdata/review.json REVLY_CASSETTE_MODE=record revly review
+	REVLY_CASSETTE=testdata/review.json revly review`,
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, _ := cmd.Flags().GetString("addr")
+		scriptFile, _ := cmd.Flags().GetString("script")
+		latency, _ := cmd.Flags().GetDuration("latency")
+		chunkDelay, _ := cmd.Flags().GetDuration("chunk-delay")
+		errorRate, _ := cmd.Flags().GetFloat64("error-rate")
+		errorStatus, _ := cmd.Flags().GetInt("error-status")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+
+		opts := fakellm.Options{
+			Latency:     latency,
+			ChunkDelay:  chunkDelay,
+			ErrorRate:   errorRate,
+			ErrorStatus: errorStatus,
+			Seed:        seed,
+		}
+		if scriptFile != "" {
+			script, err := fakellm.LoadScript(scriptFile)
+			if err != nil {
+				color.Red("%v", err)
+				return
+			}
+			opts.Script = script
+		}
+		if !quiet {
+			opts.Log = log.Printf
+		}
+
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			color.Red("Failed to listen on %s: %v", addr, err)
+			return
+		}
+		srv := &http.Server{Handler: fakellm.New(opts)}
+
+		color.Green("Fake LLM listening on http://%s/v1", ln.Addr())
+		fmt.Printf("%d scripted rule(s), latency %s, error rate %.0f%%. Press Ctrl-C to stop.\n", len(opts.Script.Rules), latency, errorRate*100)
+
+		go func() {
+			<-cmd.Context().Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(ctx)
+		}()
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			color.Red("Server error: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(devCmd)
+	devCmd.AddCommand(fakeLLMCmd)
+	fakeLLMCmd.Flags().String("addr", "127.0.0.1:8787", "Address to listen on (port 0 picks a free one)")
+	fakeLLMCmd.Flags().String("script", "", "TOML file of scripted replies")
+	fakeLLMCmd.Flags().Duration("latency", 0, "Delay before every response")
+	fakeLLMCmd.Flags().Duration("chunk-delay", 20*time.Millisecond, "Delay between streamed chunks")
+	fakeLLMCmd.Flags().Float64("error-rate", 0, "Fraction of requests (0-1) answered with --error-status")
+	fakeLLMCmd.Flags().Int("error-status", http.StatusServiceUnavailable, "HTTP status for injected errors")
+	fakeLLMCmd.Flags().Int64("seed", 1, "Seed for error injection, for repeatable runs")
+	fakeLLMCmd.Flags().Bool("quiet", false, "Don't log requests")
+}
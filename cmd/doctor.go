@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/doctor"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that git, the config, the API key, the LLM and the cache are set up",
+	Long: `
+Runs a series of checks and prints a pass, warn or fail line for each:
+
+	git          installed, and new enough for every kind of review
+	repository   revly is inside a git repository with at least one commit
+	rsync        the tools revly pair runs
+	config       files found, every key known and every value valid
+	api key      a key is found in one of the places 'revly auth' lists
+	endpoint     the LLM endpoint answers
+	model        each configured model answers a tiny prompt
+	cache        the cache directory is writable and healthy, and the
+	             shared cache, if any, is reachable
+	terminal     colors, width and whether prompts can be answered
+
+Exits with status 1 if any check fails.`,
+	Example: `
+	revly doctor
+		- Run every check.
+
+	revly doctor --offline
+		- Skip the endpoint and model checks, which send requests.
+
+	revly doctor --json
+		- Print the results as JSON, e.g. for a bug report or CI.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		offline, _ := cmd.Flags().GetBool("offline")
+
+		results := doctor.Run(cmd.Context(), doctor.Options{Network: !offline})
+		failed := doctor.Failed(results)
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(map[string]any{"ok": !failed, "checks": results})
+		} else {
+			printDoctor(results)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func printDoctor(results []doctor.Result) {
+	counts := map[doctor.Status]int{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		counts[r.Status]++
+		var status string
+		switch r.Status {
+		case doctor.Pass:
+			status = color.GreenString("✓ pass")
+		case doctor.Warn:
+			status = color.YellowString("! warn")
+		default:
+			status = color.RedString("✗ fail")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, r.Check, r.Detail)
+	}
+	w.Flush()
+	fmt.Printf("\n%d passed, %d warnings, %d failed\n", counts[doctor.Pass], counts[doctor.Warn], counts[doctor.Fail])
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().Bool("json", false, "Print the results as JSON")
+	doctorCmd.Flags().Bool("offline", false, "Skip the checks that contact the LLM endpoint")
+}
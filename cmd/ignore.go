@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/gitutils"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// stateMatcher matches revly's own state, which is never worth reviewing.
+var stateMatcher = gitutils.NewMatcher([]string{"/.revly/"})
+
+// skippedFiles maps each reason a file was left out of a review to the files
+// left out for it.
+type skippedFiles struct {
+	reasons []string
+	files   map[string][]string
+}
+
+func (s *skippedFiles) add(reason, path string) {
+	if s.files == nil {
+		s.files = map[string][]string{}
+	}
+	if len(s.files[reason]) == 0 {
+		s.reasons = append(s.reasons, reason)
+	}
+	s.files[reason] = append(s.files[reason], path)
+}
+
+func (s skippedFiles) count() int {
+	n := 0
+	for _, files := range s.files {
+		n += len(files)
+	}
+	return n
+}
+
+// String lists up to five files per reason, e.g.
+// "Skipped 3 files: .revlyignore: go.sum, package-lock.json; review.exclude: vendor/a.go".
+func (s skippedFiles) String() string {
+	var groups []string
+	for _, reason := range s.reasons {
+		files := s.files[reason]
+		list := files
+		if len(list) > 5 {
+			list = list[:5]
+		}
+		group := reason + ": " + strings.Join(list, ", ")
+		if more := len(files) - len(list); more > 0 {
+			group += fmt.Sprintf(" and %d more", more)
+		}
+		groups = append(groups, group)
+	}
+	noun := "files"
+	if s.count() == 1 {
+		noun = "file"
+	}
+	return fmt.Sprintf("Skipped %d %s: %s", s.count(), noun, strings.Join(groups, "; "))
+}
+
+// filterReviewDiff drops the files a review shouldn't see from diff: revly's
+// own .revly/ directory, files matched by .revlyignore or review.exclude,
+// and, when review.include is set, files it doesn't match.
+func filterReviewDiff(cfg config.ReviewConfig, diff []byte) ([]byte, skippedFiles, error) {
+	ignored, err := gitutils.LoadIgnoreFile(repo.Resolve(gitutils.IgnoreFile))
+	if err != nil {
+		return nil, skippedFiles{}, fmt.Errorf("reading %s: %w", gitutils.IgnoreFile, err)
+	}
+	exclude := gitutils.NewMatcher(cfg.Exclude)
+	include := gitutils.NewMatcher(cfg.Include)
+
+	var skipped skippedFiles
+	kept, _ := gitutils.FilterDiff(string(diff), func(path string) bool {
+		switch {
+		case stateMatcher.Match(path):
+			skipped.add(".revly", path)
+		case !include.Empty() && !include.Match(path):
+			skipped.add("not in review.include", path)
+		case exclude.Match(path):
+			skipped.add("review.exclude", path)
+		case ignored.Match(path):
+			skipped.add(gitutils.IgnoreFile, path)
+		default:
+			return true
+		}
+		return false
+	})
+	return []byte(kept), skipped, nil
+}
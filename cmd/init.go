@@ -1,83 +1,382 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/spf13/cobra"
+	"github.com/BurntSushi/toml"
+	"github.com/fatih/color"
 	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/llm"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var initCmd = &cobra.Command{
 	Use:   "init",
-	Short: "Initialize Revly config file",
-	Long: `Scaffolds a default Revly configuration file.
+	Short: "Set up revly for this repository or for your user",
+	Long: `
+Walks through choosing an LLM provider, its endpoint, the models to use and
+the environment variable holding your API key, checks that the models answer,
+and writes the config. It goes in revly.config.toml at the repository root,
+or in ~/.revly/config.toml to apply to every repository. .revly/, where
+revly keeps its cache and logs, is added to the repository's .gitignore.
 
-This includes:
-- LLM base URL set to OpenRouter.ai
-- Adds a list of free default models for different tasks (review, commit names, etc.)
-- Sets basic developer preferences like showDiff, pushOnCommit, etc.
+Every question can be answered with a flag instead; with --non-interactive
+(or when stdin isn't a terminal) the flags and defaults are used as they are.`,
+	Example: `
+	revly init
+		- Answer a few questions.
 
-You can customize everything in the generated config file.`,
+	revly init --non-interactive --provider openai --models gpt-4o-mini --key-env OPENAI_API_KEY
+		- Set up without prompts, e.g. in CI or a dotfiles script.
 
+	revly init --non-interactive --provider ollama --models qwen2.5-coder --scope user
+		- A local Ollama server, for every repository.
+`,
 	Run: func(cmd *cobra.Command, args []string) {
-		createDefaultConfig()
-	},
-}
+		flags := cmd.Flags()
+		nonInteractive, _ := flags.GetBool("non-interactive")
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			nonInteractive = true
+		}
+		w := &wizard{in: bufio.NewReader(os.Stdin), interactive: !nonInteractive}
+
+		provider, _ := flags.GetString("provider")
+		baseURL, _ := flags.GetString("base-url")
+		models, _ := flags.GetStringSlice("models")
+		keyEnv, _ := flags.GetString("key-env")
+		scope, _ := flags.GetString("scope")
+		skipCheck, _ := flags.GetBool("skip-check")
+		force, _ := flags.GetBool("force")
+
+		color.Cyan("Setting up revly.")
+
+		// Provider
+		providers := []string{"openrouter", "openai", "anthropic", "gemini", "ollama", "openai-compatible"}
+		if !flags.Changed("provider") {
+			provider = w.choose("LLM provider", providers, provider)
+		}
+		if !contains(providers, provider) {
+			color.Red("Unknown provider %q (use one of %s)", provider, strings.Join(providers, ", "))
+			return
+		}
 
-func createDefaultConfig() {
-	configPaths := []string{"revly.config.toml"}
+		// Endpoint
+		if !flags.Changed("base-url") {
+			baseURL = w.ask("Endpoint", llm.DefaultBaseURL(provider))
+		}
+		if baseURL == "" {
+			color.Red("Provider %s needs an endpoint (--base-url).", provider)
+			return
+		}
 
-	fmt.Println("Revly: Initializing configuration...")
+		// Models
+		if !flags.Changed("models") {
+			answer := w.ask("Models, in order of preference (comma separated)", strings.Join(defaultModels(provider), ", "))
+			models = splitList(answer)
+		}
+		if len(models) == 0 {
+			color.Red("At least one model is needed (--models).")
+			return
+		}
 
-	for _, path := range configPaths {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			fmt.Printf("Creating config at '%s'...\n", path)
+		// API key
+		cfg := config.LLMConfig{Provider: provider, BaseURL: baseURL, Models: models, RequestTimeout: 30 * time.Second}
+		needsKey := llm.RequiresAPIKey(cfg)
+		if needsKey && !flags.Changed("key-env") {
+			keyEnv = w.ask("Environment variable holding the API key", keyEnv)
+		}
+		if needsKey {
+			cfg.KeyEnv = keyEnv
+		}
 
-			err := os.WriteFile(path, []byte(config.DefaultConfig), 0644)
-			if err != nil {
-				fmt.Printf("Failed to create %s: %v\n", path, err)
+		// Scope
+		if !flags.Changed("scope") {
+			def := "repo"
+			if !repo.InRepo() {
+				def = "user"
+			}
+			scope = w.choose("Save to the repository config (repo) or your user config (user)", []string{"repo", "user"}, def)
+		}
+		path := repo.ConfigFile()
+		switch scope {
+		case "repo":
+		case "user":
+			path = config.UserFile()
+		default:
+			color.Red("--scope must be repo or user, not %q", scope)
+			return
+		}
+		if _, err := os.Stat(path); err == nil && !force {
+			if !w.confirm(fmt.Sprintf("%s already exists. Replace it?", path), false) {
+				fmt.Println("Keeping the existing config. Rerun with --force to replace it.")
 				return
 			}
+		}
+
+		// Connectivity check
+		pasted := ""
+		if !skipCheck {
+			apiKey := ""
+			if needsKey {
+				if cred, err := llm.ResolveKey(cfg); err == nil {
+					apiKey = cred.Key
+				} else if w.interactive {
+					fmt.Printf("No API key found in %s. Paste one to test with, or press Enter to skip: ", keyEnv)
+					secret, _ := term.ReadPassword(int(os.Stdin.Fd()))
+					fmt.Println()
+					apiKey = strings.TrimSpace(string(secret))
+					pasted = apiKey
+				}
+			}
+			if needsKey && apiKey == "" {
+				color.Yellow("Skipping the connection check: no API key in %s.", keyEnv)
+			} else {
+				working := checkModels(cmd.Context(), cfg, apiKey)
+				switch {
+				case len(working) == 0:
+					pasted = ""
+					if !w.confirm("No model answered. Save the config anyway?", !w.interactive) {
+						return
+					}
+				case len(working) < len(models) && w.confirm(fmt.Sprintf("Keep only the %d model(s) that answered?", len(working)), false):
+					models = working
+				}
+			}
+		}
 
-			fmt.Println("Done.")
-			fmt.Println()
-			fmt.Println("	Base URL set to: https://openrouter.ai/api/v1")
-			fmt.Println("	Added default models for:")
-			fmt.Println("   → Added default free OpenRouter Models for config:")
-			fmt.Println("      - qwen/qwen3-coder:free")
-			fmt.Println("      - qwen/qwen3-235b-a22b-2507:free")
-			fmt.Println("      - moonshotai/kimi-k2:free")
-			fmt.Println("      - cognitivecomputations/dolphin-mistral-24b-venice-edition:free")
-			fmt.Println("      - tngtech/deepseek-r1t2-chimera:free")
-			fmt.Println("      - moonshotai/kimi-dev-72b:free")
-			fmt.Println("      - deepseek/deepseek-r1-0528-qwen3-8b:free")
-			fmt.Println("      - tencent/hunyuan-a13b-instruct:free")
-			fmt.Println("      - mistralai/mistral-small-3.2-24b-instruct:free")
-			fmt.Println("      - deepseek/deepseek-r1-0528:free")
-			fmt.Println("      - tngtech/deepseek-r1t-chimera:free")
-			fmt.Println("      - microsoft/mai-ds-r1:free")
-			fmt.Println("      - moonshotai/kimi-vl-a3b-thinking:free")
-			fmt.Println("      - nvidia/llama-3.1-nemotron-ultra-253b-v1:free")
-			fmt.Println("   Edit them to add your preferred models.")
-
-			fmt.Println()
-			fmt.Println("[Tip]: You can now edit this config to switch to custom endpoints, override model preferences, or tweak behavior flags like:")
-			fmt.Println("   - provider")
-			fmt.Println("   - base_url")
-			fmt.Println("   - models")
-			fmt.Println("   - showDiff")
-			fmt.Println("   - pushOnCommitByDefault")
-			fmt.Println("   - logLevel")
-			fmt.Printf("\nTo customize, open '%s' in your editor.\n", path)
+		// Write the config
+		if err := writeInitConfig(path, provider, baseURL, models, cfg.KeyEnv); err != nil {
+			color.Red("Failed to write %s: %v", path, err)
 			return
 		}
+		fmt.Println()
+		color.Green("Wrote %s", path)
+
+		if pasted != "" && w.confirm(fmt.Sprintf("Save the key you pasted in %s?", llm.CredentialsFile()), true) {
+			if err := llm.SaveCredential(llm.CredentialName(cfg), pasted); err != nil {
+				color.Yellow("Couldn't save the key: %v", err)
+			} else {
+				fmt.Printf("Saved the key for %s\n", llm.CredentialName(cfg))
+			}
+		}
+
+		if repo.InRepo() {
+			added, err := ignoreStateDir()
+			switch {
+			case err != nil:
+				color.Yellow("Couldn't update .gitignore: %v", err)
+			case added:
+				fmt.Printf("Added %s/ to .gitignore\n", repo.StateName)
+			}
+		}
+
+		fmt.Println()
+		fmt.Println("Next:")
+		if _, err := llm.ResolveKey(cfg); err != nil {
+			fmt.Printf("  export %s=your-api-key   or run 'revly auth login'\n", keyEnv)
+		}
+		fmt.Println("  revly review              review your uncommitted changes")
+		fmt.Println("  revly config list         see every setting and where it comes from")
+	},
+}
+
+// wizard asks questions on stdin, or takes the defaults when not interactive.
+type wizard struct {
+	in          *bufio.Reader
+	interactive bool
+}
+
+func (w *wizard) ask(question, def string) string {
+	if !w.interactive {
+		return def
+	}
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, _ := w.in.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// choose asks for one of options, by name or number.
+func (w *wizard) choose(question string, options []string, def string) string {
+	if !w.interactive {
+		return def
+	}
+	for {
+		fmt.Println(question + ":")
+		for i, o := range options {
+			fmt.Printf("  %d) %s\n", i+1, o)
+		}
+		answer := w.ask("Choose", def)
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return options[n-1]
+		}
+		if contains(options, answer) {
+			return answer
+		}
+		color.Yellow("Please pick one of the options.")
+	}
+}
+
+func (w *wizard) confirm(question string, def bool) bool {
+	if !w.interactive {
+		return def
+	}
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	switch strings.ToLower(w.ask(question+" ("+hint+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// defaultModels suggests models for a provider. OpenRouter gets the free
+// models listed in the default config.
+func defaultModels(provider string) []string {
+	switch provider {
+	case "openrouter":
+		var cfg config.RevlyConfig
+		if _, err := toml.Decode(config.DefaultConfig, &cfg); err == nil {
+			return cfg.LLM.Models
+		}
+	case "openai":
+		return []string{"gpt-4o-mini"}
+	case "anthropic":
+		return []string{"claude-3-5-haiku-latest"}
+	case "gemini":
+		return []string{"gemini-2.0-flash"}
+	case "ollama":
+		return []string{"qwen2.5-coder"}
+	}
+	return nil
+}
+
+// checkModels sends every model a tiny request at once and reports each
+// result. It returns the models that answered, in their original order.
+func checkModels(ctx context.Context, cfg config.LLMConfig, apiKey string) []string {
+	fmt.Printf("\nChecking %d model(s) at %s...\n", len(cfg.Models), cfg.BaseURL)
+	errs := make([]error, len(cfg.Models))
+	took := make([]time.Duration, len(cfg.Models))
+	var wg sync.WaitGroup
+	for i, model := range cfg.Models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			took[i], errs[i] = llm.CheckModel(ctx, cfg, apiKey, model)
+		}()
+	}
+	wg.Wait()
+
+	var working []string
+	for i, model := range cfg.Models {
+		if errs[i] != nil {
+			color.Red("  ✗ %s: %v", model, errs[i])
+			continue
+		}
+		color.Green("  ✓ %s (%s)", model, took[i].Round(10*time.Millisecond))
+		working = append(working, model)
+	}
+	return working
+}
+
+// writeInitConfig writes the default config template to path with the
+// wizard's answers filled in.
+func writeInitConfig(path, provider, baseURL string, models []string, keyEnv string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(config.DefaultConfig), 0644); err != nil {
+		return err
+	}
+	set := map[string]string{
+		"llm.provider": provider,
+		"llm.base_url": baseURL,
+		"llm.models":   strings.Join(models, ","),
+	}
+	if keyEnv != "" && keyEnv != "LLM_API_KEY" {
+		set["llm.key_env"] = keyEnv
+	}
+	for _, key := range []string{"llm.provider", "llm.base_url", "llm.models", "llm.key_env"} {
+		if value, ok := set[key]; ok {
+			if err := config.Set(path, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	// The template's api_base_url is OpenRouter's; base_url covers the rest.
+	_, err := config.Unset(path, "llm.api_base_url")
+	return err
+}
+
+// ignoreStateDir adds .revly/ to the repository's .gitignore unless a line
+// already covers it.
+func ignoreStateDir() (bool, error) {
+	path := filepath.Join(repo.Root(), ".gitignore")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		switch strings.TrimSpace(line) {
+		case repo.StateName, repo.StateName + "/", "/" + repo.StateName, "/" + repo.StateName + "/":
+			return false, nil
+		}
+	}
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
 	}
+	content += repo.StateName + "/\n"
+	return true, os.WriteFile(path, []byte(content), 0644)
+}
 
-	fmt.Println("A config file already exists. Skipping creation.")
-	fmt.Println("To regenerate, delete the file and rerun `revly init`.")
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
-}
\ No newline at end of file
+	initCmd.Flags().Bool("non-interactive", false, "Don't ask questions; use the flags and defaults")
+	initCmd.Flags().String("provider", "openrouter", "LLM provider: openrouter, openai, anthropic, gemini, ollama or openai-compatible")
+	initCmd.Flags().String("base-url", "", "API endpoint (default depends on the provider)")
+	initCmd.Flags().StringSlice("models", nil, "Models to use, in order of preference (default depends on the provider)")
+	initCmd.Flags().String("key-env", "LLM_API_KEY", "Environment variable holding the API key")
+	initCmd.Flags().String("scope", "repo", "Where to save the config: repo or user")
+	initCmd.Flags().Bool("skip-check", false, "Don't test the endpoint and models")
+	initCmd.Flags().Bool("force", false, "Replace an existing config without asking")
+}
@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"time"
 
+	"github.com/fatih/color"
 	"github.com/nareshkarthigeyan/revly/internals/cache"
 	"github.com/nareshkarthigeyan/revly/internals/gitutils"
 	"github.com/nareshkarthigeyan/revly/internals/llm"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
 	"github.com/spf13/cobra"
 )
 
@@ -18,23 +22,29 @@ var pairCmd = &cobra.Command{
 	Long:  `Watches your code for changes and provides live AI feedback on your current diffs.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		interval, _ := cmd.Flags().GetInt("interval")
+		if _, err := exec.LookPath("rsync"); err != nil {
+			color.Red("revly pair needs rsync to snapshot your working tree, and it isn't installed.")
+			fmt.Println("Install it, then run 'revly doctor' to check the rest of your setup.")
+			return
+		}
 		log.Printf("Starting pair programming mode with %d second interval...", interval)
 
 		// Create .revly directory if it doesn't exist
-		if _, err := os.Stat(".revly"); os.IsNotExist(err) {
-			os.Mkdir(".revly", 0755)
+		if _, err := os.Stat(repo.State()); os.IsNotExist(err) {
+			os.Mkdir(repo.State(), 0755)
 		}
 
 		// Set up logging
-		logFile, err := os.OpenFile(".revly/pair.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		logPath := repo.State("pair.log")
+		logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			log.Fatalf("Failed to open log file: %v", err)
 		}
 		defer logFile.Close()
 		log.SetOutput(logFile)
 
-		// Create initial snapshot
-		initialSnapshotPath := ".revly/snapshots/initial"
+		// Create initial snapshot (snapshot paths are relative to the repo root)
+		initialSnapshotPath := filepath.Join(repo.StateName, "snapshots", "initial")
 		if err := gitutils.CreateSnapshot(initialSnapshotPath); err != nil {
 			log.Fatalf("Failed to create initial snapshot: %v", err)
 		}
@@ -42,9 +52,21 @@ var pairCmd = &cobra.Command{
 		ticker := time.NewTicker(time.Duration(interval) * time.Second)
 		defer ticker.Stop()
 
-		for range ticker.C {
+		ctx := cmd.Context()
+		suggestions := 0
+		defer func() {
+			fmt.Printf("\nPair session ended. %d suggestion(s) given; see %s.\n", suggestions, logPath)
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
 			// Create current snapshot
-			currentSnapshotPath := ".revly/snapshots/current"
+			currentSnapshotPath := filepath.Join(repo.StateName, "snapshots", "current")
 			if err := gitutils.CreateSnapshot(currentSnapshotPath); err != nil {
 				log.Printf("Failed to create current snapshot: %v", err)
 				continue
@@ -61,13 +83,21 @@ var pairCmd = &cobra.Command{
 				continue
 			}
 
-			key := cache.Key(diff)
-			if _, err := cache.Load(key); err == nil {
+			key, meta, err := cacheSlot("pair", diff)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			if _, _, err := cache.Load("pair", key); err == nil {
 				// fmt.Println("No new changes detected.")
 				continue
 			}
 
-			comment, err := llm.GetPairProgrammingComment(string(diff))
+			callCtx, tally := llm.WithTally(ctx)
+			comment, err := llm.GetPairProgrammingComment(callCtx, string(diff))
+			if ctx.Err() != nil {
+				return
+			}
 			if err != nil {
 				fmt.Printf("Error getting comment: %v\n", err)
 				continue
@@ -76,7 +106,8 @@ var pairCmd = &cobra.Command{
 			if comment != "" {
 				fmt.Printf("Suggestion: %s\n", comment)
 				log.Printf("Suggestion: %s", comment)
-				cache.Save(key, []byte(comment))
+				saveToCache(key, meta, tally, []byte(comment))
+				suggestions++
 			}
 		}
 	},
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/prompts"
+	"github.com/spf13/cobra"
+)
+
+var promptsCmd = &cobra.Command{
+	Use:   "prompts",
+	Short: "Show or export the prompt templates sent to the model",
+	Long: `
+The system prompts for review, commit and pair are Go text/template files.
+Revly ships defaults, and a repository can override any of them by placing a
+file of the same name (review.tmpl, reduce.tmpl, commit.tmpl, pair.tmpl) in
+.revly/prompts, or in the directory set by [prompts] dir in revly.config.toml.
+
+Templates can use these variables:
+
+	{{.RepoName}}    Name of the repository's root directory
+	{{.Language}}    Most common language among tracked files
+	{{.Branch}}      Checked-out branch (empty when HEAD is detached)
+	{{.Guidelines}}  Team guidelines from [prompts] guidelines or guidelines_file
+
+The review and reduce prompts are always followed by the JSON schema revly
+needs to parse findings, so overrides only need to describe how to review.`,
+	Example: `
+	revly prompts show
+		- Lists the prompts and where each one is loaded from.
+
+	revly prompts show review
+		- Prints the review prompt as it will be sent.
+
+	revly prompts export
+		- Copies the built-in templates into .revly/prompts for editing.
+`,
+}
+
+var promptsShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Print a prompt as it will be sent, or list all prompts",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			return
+		}
+
+		if len(args) == 0 {
+			for _, name := range prompts.Names() {
+				t, err := prompts.Load(cfg.Prompts, name)
+				if err != nil {
+					color.Red("%s: %v", name, err)
+					continue
+				}
+				fmt.Printf("%-8s %s\n", name, t.Origin)
+			}
+			return
+		}
+
+		t, err := prompts.Load(cfg.Prompts, args[0])
+		if err != nil {
+			color.Red("%v", err)
+			return
+		}
+
+		raw, _ := cmd.Flags().GetBool("raw")
+		if raw {
+			fmt.Print(t.Source)
+			return
+		}
+
+		vars, err := prompts.CurrentVars(cfg.Prompts)
+		if err != nil {
+			color.Red("%v", err)
+			return
+		}
+		text, err := t.Execute(vars)
+		if err != nil {
+			color.Red("%v", err)
+			return
+		}
+		color.Cyan("# %s prompt (%s)", t.Name, t.Origin)
+		fmt.Println(text)
+	},
+}
+
+var promptsExportCmd = &cobra.Command{
+	Use:   "export [name...]",
+	Short: "Write the built-in templates to the override directory",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			return
+		}
+
+		dir, _ := cmd.Flags().GetString("dir")
+		if dir == "" {
+			dir = prompts.Dir(cfg.Prompts)
+		}
+		force, _ := cmd.Flags().GetBool("force")
+
+		names := args
+		if len(names) == 0 {
+			names = prompts.Names()
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			color.Red("Failed to create %s: %v", dir, err)
+			return
+		}
+		for _, name := range names {
+			source, err := prompts.Default(name)
+			if err != nil {
+				color.Red("%v", err)
+				continue
+			}
+			path := filepath.Join(dir, name+".tmpl")
+			if _, err := os.Stat(path); err == nil && !force {
+				color.Yellow("Skipping %s: it already exists (use --force to overwrite)", path)
+				continue
+			}
+			if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+				color.Red("Failed to write %s: %v", path, err)
+				continue
+			}
+			color.Green("Wrote %s", path)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(promptsCmd)
+	promptsCmd.AddCommand(promptsShowCmd, promptsExportCmd)
+	promptsShowCmd.Flags().Bool("raw", false, "Print the template source instead of rendering it")
+	promptsExportCmd.Flags().String("dir", "", "Directory to write to (default .revly/prompts or [prompts] dir)")
+	promptsExportCmd.Flags().Bool("force", false, "Overwrite templates that already exist")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/x/ansi"
+	"golang.org/x/term"
+)
+
+// liveRefresh throttles re-rendering while a response streams in; glamour
+// re-renders the whole document each time.
+const liveRefresh = 120 * time.Millisecond
+
+// liveMarkdown re-renders streamed markdown in place. Each frame moves the
+// cursor back over the previous one and redraws it, so headings, lists and
+// code fences settle into shape as the text arrives.
+type liveMarkdown struct {
+	renderer *glamour.TermRenderer
+	buf      strings.Builder
+	rows     int
+	last     time.Time
+}
+
+func newLiveMarkdown(renderer *glamour.TermRenderer) *liveMarkdown {
+	return &liveMarkdown{renderer: renderer}
+}
+
+// Write appends a streamed chunk and redraws if the refresh interval passed.
+func (l *liveMarkdown) Write(chunk string) {
+	l.buf.WriteString(chunk)
+	if time.Since(l.last) >= liveRefresh {
+		l.draw()
+	}
+}
+
+// Set replaces the content, for callers that rebuild the document as data
+// arrives rather than appending to it.
+func (l *liveMarkdown) Set(content string) {
+	l.buf.Reset()
+	l.Write(content)
+}
+
+// Flush draws the final frame.
+func (l *liveMarkdown) Flush() {
+	l.draw()
+}
+
+func (l *liveMarkdown) draw() {
+	rendered, err := l.renderer.Render(l.buf.String())
+	if err != nil {
+		rendered = l.buf.String()
+	}
+	lines := strings.Split(strings.TrimRight(highlightSeverities(rendered), "\n"), "\n")
+
+	width, height := terminalSize()
+
+	// Rows that scrolled off the top of the screen can't be redrawn. They
+	// were rendered from a prefix of the same text, so they are left alone
+	// and only the visible tail of the new frame is printed.
+	up := l.rows
+	if up > height-1 {
+		up = height - 1
+	}
+	skip := l.rows - up
+
+	var frame strings.Builder
+	if up > 0 {
+		fmt.Fprintf(&frame, "\033[%dA", up)
+	}
+	frame.WriteString("\r\033[J")
+
+	rows := 0
+	for _, line := range lines {
+		n := lineRows(line, width)
+		if rows+n > skip {
+			frame.WriteString(line)
+			frame.WriteString("\n")
+		}
+		rows += n
+	}
+	fmt.Print(frame.String())
+
+	l.rows = rows
+	l.last = time.Now()
+}
+
+// lineRows is the number of terminal rows line occupies once wrapped.
+func lineRows(line string, width int) int {
+	w := ansi.StringWidth(line)
+	if w == 0 || width <= 0 {
+		return 1
+	}
+	return (w + width - 1) / width
+}
+
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+func terminalSize() (width, height int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
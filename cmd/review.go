@@ -4,39 +4,114 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/charmbracelet/glamour"
 	"github.com/fatih/color"
 	"github.com/nareshkarthigeyan/revly/internals/cache"
+	"github.com/nareshkarthigeyan/revly/internals/config"
 	"github.com/nareshkarthigeyan/revly/internals/llm"
 	"github.com/spf13/cobra"
 	// "revly/internal/logging"
 )
 
-var severityPatterns = map[*regexp.Regexp]func(string) string{
-	regexp.MustCompile(`(?m)^[CRITICAL]$`): func(_ string) string {
-		return color.New(color.FgRed, color.Bold).Sprint("[CRITICAL]")
-	},
-	regexp.MustCompile(`(?m)^[WARNING]$`): func(_ string) string {
-		return color.New(color.FgYellow, color.Bold).Sprint("[WARNING]")
-	},
-	regexp.MustCompile(`(?m)^[INFO]$`): func(_ string) string {
-		return color.New(color.FgBlue).Sprint("[INFO]")
-	},
+// severityPatterns match the severity tags in rendered output. Glamour styles
+// "[" separately from the word after it, so escape codes may sit in between.
+var severityPatterns = []struct {
+	pattern *regexp.Regexp
+	tag     string
+	color   *color.Color
+}{
+	{regexp.MustCompile(`\[(?:\x1b\[[0-9;]*m)*CRITICAL\]`), "[CRITICAL]", color.New(color.FgRed, color.Bold)},
+	{regexp.MustCompile(`\[(?:\x1b\[[0-9;]*m)*WARNING\]`), "[WARNING]", color.New(color.FgYellow, color.Bold)},
+	{regexp.MustCompile(`\[(?:\x1b\[[0-9;]*m)*INFO\]`), "[INFO]", color.New(color.FgBlue)},
 }
 
 func highlightSeverities(text string) string {
-	for pattern, apply := range severityPatterns {
-		text = pattern.ReplaceAllStringFunc(text, apply)
+	for _, s := range severityPatterns {
+		text = s.pattern.ReplaceAllString(text, s.color.Sprint(s.tag))
 	}
 	return text
 }
 
+// reviewMarkdown lays out a review for glamour: the summary, then each
+// finding under a heading carrying its severity tag and location.
+func reviewMarkdown(r llm.Review) string {
+	var b strings.Builder
+	if r.Summary != "" {
+		fmt.Fprintf(&b, "## Summary\n\n%s\n\n", r.Summary)
+	}
+	if len(r.Findings) == 0 {
+		b.WriteString("No issues found.\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "## Findings (%d)\n\n", len(r.Findings))
+	for _, f := range r.Findings {
+		writeFinding(&b, f, "")
+	}
+	return b.String()
+}
+
+// consensusMarkdown is reviewMarkdown for a multi-model review: each finding
+// also says which models raised it.
+func consensusMarkdown(r llm.ConsensusReview) string {
+	var b strings.Builder
+	if r.Summary != "" {
+		fmt.Fprintf(&b, "## Summary\n\n%s\n\n", r.Summary)
+	}
+	fmt.Fprintf(&b, "Reviewed by %d models: %s\n\n", len(r.Models), strings.Join(r.Models, ", "))
+	failed := make([]string, 0, len(r.Failed))
+	for model := range r.Failed {
+		failed = append(failed, model)
+	}
+	sort.Strings(failed)
+	for _, model := range failed {
+		fmt.Fprintf(&b, "* `%s` failed: %s\n", model, r.Failed[model])
+	}
+	if len(r.Failed) > 0 {
+		b.WriteString("\n")
+	}
+	if len(r.Findings) == 0 {
+		b.WriteString("No issues found.\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "## Findings (%d)\n\n", len(r.Findings))
+	for _, f := range r.Findings {
+		note := fmt.Sprintf("*Raised by %d of %d models (%.0f%%): %s*", len(f.Models), len(r.Models), f.Agreement*100, strings.Join(f.Models, ", "))
+		writeFinding(&b, f.Finding, note)
+	}
+	return b.String()
+}
+
+func writeFinding(b *strings.Builder, f llm.Finding, note string) {
+	location := f.File
+	switch {
+	case f.StartLine > 0 && f.EndLine > f.StartLine:
+		location = fmt.Sprintf("%s:%d-%d", f.File, f.StartLine, f.EndLine)
+	case f.StartLine > 0:
+		location = fmt.Sprintf("%s:%d", f.File, f.StartLine)
+	}
+	fmt.Fprintf(b, "### [%s] `%s` (%s)\n\n", strings.ToUpper(f.Severity), location, f.Category)
+	if note != "" {
+		fmt.Fprintf(b, "%s\n\n", note)
+	}
+	fmt.Fprintf(b, "%s\n\n", f.Message)
+	if f.Suggestion != "" {
+		fmt.Fprintf(b, "**Suggestion:** %s\n\n", f.Suggestion)
+	}
+}
+
 // reviewCmd represents the review command
 var reviewCmd = &cobra.Command{
 	Use:   "review",
@@ -47,8 +122,20 @@ var reviewCmd = &cobra.Command{
 	--staged, -s        Review only staged changes (git diff --cached)
 	--commit, -c <hash> Review a specific commit by hash
 	--head              Review the latest commit (HEAD)
+	--no-stream         Wait for the complete review instead of streaming it
+	--json              Print the findings as JSON instead of rendering them
+	--consensus N       Review with the first N models at once and score agreement
+	--hide-unique       With --consensus, hide findings only one model raised
+	--no-cache          Neither read nor write the review cache
+	--refresh           Ignore a cached review and replace it with a new one
+	--no-ignore         Review every file, ignoring .revlyignore and review.exclude/include
+	--tools             Let the model read files, grep and read the git log of the repository
+
+	If no flags are provided, it reviews unstaged changes in your working directory.
 
-	If no flags are provided, it reviews unstaged changes in your working directory.`,
+	Files matched by .revlyignore at the repository root (in .gitignore syntax)
+	or by review.exclude are left out, as are files outside review.include when
+	it is set, and revly's own .revly/ directory.`,
 
 	Example: `
 	
@@ -67,11 +154,28 @@ var reviewCmd = &cobra.Command{
 	revly review --commit
 	revly review --head
 		- Reviews the most recent commit (HEAD). If -c / --commit is provided without a value, HEAD is assumed.
+
+	revly review --json > review.json
+		- Writes the findings as JSON for other tools to consume.
+
+	revly review --tools
+		- Lets the model read the code around the diff before it reviews,
+		  within the [review.tools] budget.
+
+	revly review --consensus 3 --hide-unique
+		- Reviews with the first three review models and keeps only findings
+		  at least two of them agree on.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		commit, _ := cmd.Flags().GetString("commit")
 		staged, _ := cmd.Flags().GetBool("staged")
 		head, _ := cmd.Flags().GetBool("head")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		// Keep stdout clean for the JSON document.
+		if asJSON {
+			color.Output = os.Stderr
+		}
 
 		var diff []byte
 		var err error
@@ -79,11 +183,11 @@ var reviewCmd = &cobra.Command{
 		switch {
 		case head:
 			color.Cyan("Fetching diff for latest commit (HEAD)...")
-			diff, err = exec.Command("git", "show", "HEAD").Output()
+			diff, err = exec.Command("git", "show", "--diff-merges=first-parent", "HEAD").Output()
 
 		case commit != "":
 			color.Cyan("Fetching diff for commit <%s>...", commit)
-			diff, err = exec.Command("git", "show", commit).Output()
+			diff, err = exec.Command("git", "show", "--diff-merges=first-parent", commit).Output()
 
 		case staged:
 			color.Cyan("Fetching staged diff...")
@@ -99,12 +203,36 @@ var reviewCmd = &cobra.Command{
 			return
 		}
 
+		if noIgnore, _ := cmd.Flags().GetBool("no-ignore"); !noIgnore {
+			cfg, err := config.GetConfig()
+			if err != nil {
+				color.Red("Error loading config: %v", err)
+				return
+			}
+			var skipped skippedFiles
+			diff, skipped, err = filterReviewDiff(cfg.Review, diff)
+			if err != nil {
+				color.Red("Error: %v", err)
+				return
+			}
+			if skipped.count() > 0 {
+				color.Yellow("%s", skipped)
+			}
+		}
+
 		if strings.TrimSpace(string(diff)) == "" {
 			color.Yellow("No changes to review.")
 			return
 		}
 
-		key := cache.Key(diff)
+		noCache, _ := cmd.Flags().GetBool("no-cache")
+		refresh, _ := cmd.Flags().GetBool("refresh")
+		slot := reviewSlot{save: !noCache}
+		slot.key, slot.meta, err = cacheSlot("review", diff)
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
 
 		renderer, err := glamour.NewTermRenderer(
 			glamour.WithAutoStyle(),
@@ -120,21 +248,52 @@ var reviewCmd = &cobra.Command{
 			color.Yellow("=== END DIFF ===")
 		}
 
-		var output string
-		if cached, err := cache.Load(key); err == nil {
-			output = string(cached)
-		} else {
+		consensus, _ := cmd.Flags().GetInt("consensus")
+		if consensus > 0 {
+			hideUnique, _ := cmd.Flags().GetBool("hide-unique")
+			consensusReview(cmd.Context(), renderer, string(diff), consensus, hideUnique, asJSON)
+			return
+		}
+
+		var review llm.Review
+		found, cancelled := false, false
+		if !noCache && !refresh {
+			if meta, cached, err := cache.Load("review", slot.key); err == nil && json.Unmarshal(cached, &review) == nil {
+				found = true
+				color.Cyan("Using the review cached at %s (--refresh to redo it).", meta.CreatedAt.Local().Format("2006-01-02 15:04"))
+			}
+		}
+		if !found {
+			ctx, tally := llm.WithTally(cmd.Context())
 			color.Green("Sending to AI...")
-			resp, err := llm.ReviewDiffWithLLM(string(diff))
-			if err != nil {
+			noStream, _ := cmd.Flags().GetBool("no-stream")
+			if !noStream && !asJSON && isTerminal() {
+				streamReview(ctx, renderer, slot, tally, string(diff))
+				return
+			}
+			review, err = llm.ReviewDiffWithLLM(ctx, string(diff))
+			if errors.Is(err, context.Canceled) {
+				if asJSON || len(review.Findings) == 0 && review.Summary == "" {
+					color.Yellow("Review cancelled.")
+					return
+				}
+				cancelled = true
+			} else if err != nil {
 				color.Red("Error from AI: %v", err)
 				return
+			} else {
+				saveReview(slot, tally, review)
 			}
-			_ = cache.Save(key, []byte(resp))
-			output = resp
 		}
 
-		rendered, err := renderer.Render(output)
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(review)
+			return
+		}
+
+		rendered, err := renderer.Render(reviewMarkdown(review))
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -142,10 +301,121 @@ var reviewCmd = &cobra.Command{
 
 		color.Green("\n=== AI Review ===")
 		fmt.Println(coloredOutput)
+		if cancelled {
+			color.Yellow("=== REVIEW CANCELLED: partial review shown above ===")
+			return
+		}
 		color.Green("=== END OF REVIEW ===")
 	},
 }
 
+// streamReview renders the review progressively as findings stream in.
+// Only complete reviews are cached.
+func streamReview(ctx context.Context, renderer *glamour.TermRenderer, slot reviewSlot, tally *llm.Tally, diff string) {
+	live := newLiveMarkdown(renderer)
+	started := false
+	review, err := llm.ReviewDiffWithLLMStream(ctx, diff, func(partial llm.Review) {
+		if !started {
+			color.Green("\n=== AI Review ===")
+			started = true
+		}
+		live.Set(reviewMarkdown(partial))
+	})
+	partial := len(review.Findings) > 0 || review.Summary != ""
+	if errors.Is(err, context.Canceled) {
+		if !partial {
+			color.Yellow("Review cancelled.")
+			return
+		}
+		// A chunked review returns the parts that finished, which may not
+		// have streamed at all.
+		if !started {
+			color.Green("\n=== AI Review ===")
+		}
+		live.Set(reviewMarkdown(review))
+		live.Flush()
+		color.Yellow("=== REVIEW CANCELLED: partial review shown above ===")
+		return
+	}
+	if err != nil {
+		if started && partial {
+			live.Flush()
+			color.Yellow("=== REVIEW INCOMPLETE ===")
+		}
+		color.Red("Error from AI: %v", err)
+		return
+	}
+
+	// The final review is parsed in full and may have been repaired or
+	// merged, so it replaces whatever was streamed.
+	if !started {
+		color.Green("\n=== AI Review ===")
+	}
+	live.Set(reviewMarkdown(review))
+	live.Flush()
+	saveReview(slot, tally, review)
+	color.Green("=== END OF REVIEW ===")
+}
+
+// consensusReview fans the diff out to several models. The result isn't
+// cached, since the cache holds single-model reviews.
+func consensusReview(ctx context.Context, renderer *glamour.TermRenderer, diff string, n int, hideUnique, asJSON bool) {
+	color.Green("Sending to %d models...", n)
+	review, err := llm.ReviewDiffWithConsensus(ctx, diff, n)
+	if errors.Is(err, context.Canceled) {
+		color.Yellow("Review cancelled.")
+		return
+	}
+	if err != nil {
+		color.Red("Error from AI: %v", err)
+		return
+	}
+
+	if hideUnique {
+		if len(review.Models) < 2 {
+			color.Yellow("Only %s answered, so findings can't be compared; showing all of them.", review.Models[0])
+		} else {
+			total := len(review.Findings)
+			review.DropUnique()
+			if hidden := total - len(review.Findings); hidden > 0 {
+				color.Yellow("Hid %d finding(s) raised by only one model.", hidden)
+			}
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(review)
+		return
+	}
+
+	rendered, err := renderer.Render(consensusMarkdown(review))
+	if err != nil {
+		log.Fatal(err)
+	}
+	color.Green("\n=== AI Review ===")
+	fmt.Println(highlightSeverities(rendered))
+	color.Green("=== END OF REVIEW ===")
+}
+
+// reviewSlot is where a review is cached; save is false with --no-cache.
+type reviewSlot struct {
+	key  string
+	meta cache.Meta
+	save bool
+}
+
+func saveReview(slot reviewSlot, tally *llm.Tally, review llm.Review) {
+	if !slot.save {
+		return
+	}
+	data, err := json.Marshal(review)
+	if err == nil {
+		saveToCache(slot.key, slot.meta, tally, data)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(reviewCmd)
 	reviewCmd.Flags().Bool("diff", false, "Display the Git diff before running the review")
@@ -153,6 +423,14 @@ func init() {
 	reviewCmd.Flags().Lookup("commit").NoOptDefVal = "HEAD"
 	reviewCmd.Flags().BoolP("staged", "s", false, "Review only staged changes")
 	reviewCmd.Flags().Bool("head", false, "Review the latest commit (HEAD)")
+	reviewCmd.Flags().Bool("no-stream", false, "Wait for the full review instead of rendering it as it streams in")
+	reviewCmd.Flags().Bool("json", false, "Print the findings as JSON")
+	reviewCmd.Flags().Int("consensus", 0, "Review with the first N review models concurrently and report how many agree on each finding")
+	reviewCmd.Flags().Bool("hide-unique", false, "With --consensus, hide findings raised by only one model")
+	reviewCmd.Flags().Bool("no-cache", false, "Don't read or write the review cache")
+	reviewCmd.Flags().Bool("refresh", false, "Ignore any cached review and cache the new one")
+	reviewCmd.Flags().Bool("no-ignore", false, "Review every file, ignoring .revlyignore and review.exclude/include")
+	reviewCmd.Flags().Bool("tools", false, "Let the model look around the repository (read_file, grep, list_dir, git_log) before answering; same as --set review.tools.enabled=true")
 
 	// Here you will define your flags and configuration settings.
 
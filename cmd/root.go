@@ -4,18 +4,42 @@ Copyright © 2025 K V Naresh Karthigeyan nareshkarthigeyan.2005@gmail.com
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/nareshkarthigeyan/revly/internals/config"
 	"github.com/spf13/cobra"
 )
 
 var Version = "0.1.0" // or inject via ldflags
+
+// configFlags are command flags that stand for a config value. They are
+// applied like --set, after it, on the commands that define them.
+var configFlags = []struct{ flag, pair string }{
+	{"tools", "review.tools.enabled=true"},
+}
+
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "revly",
 	Short: "Revly is an AI-powered code review CLI tool",
 	Long:  "Revly is a CLI tool that uses LLMs to analyze \ngit diffs and suggest code improvements,\nreview both staged and unstaged changes,\nand provide actionable feedback on code quality.\nDo not wait for PR reviews, get instant feedback on your code changes.",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Register --set and --profile before anything loads the config.
+		pairs, _ := cmd.Flags().GetStringArray("set")
+		for _, f := range configFlags {
+			if on, err := cmd.Flags().GetBool(f.flag); err == nil && on {
+				pairs = append(pairs, f.pair)
+			}
+		}
+		config.SetOverrides(pairs)
+		profile, _ := cmd.Flags().GetString("profile")
+		config.SetProfile(profile)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Revly CLI - AI Code Review Assistant\n\nTry `revly init` to get started. \nFor more help, use `revly --help`.")
 	},
@@ -32,14 +56,24 @@ func Execute() {
 		}
 	}
 	
-	err := rootCmd.Execute()
+	// Ctrl-C cancels the command's context so in-flight LLM requests stop
+	// and commands can report what they finished. A second Ctrl-C exits.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
 func init() {
-
+	rootCmd.PersistentFlags().StringArray("set", nil, "Override a config key for this run, e.g. --set llm.timeout=10m (repeatable)")
+	rootCmd.PersistentFlags().String("profile", "", "Use a [profiles.<name>] section of the config (or set REVLY_PROFILE)")
 }
 
 
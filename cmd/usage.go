@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/usage"
+	"github.com/spf13/cobra"
+)
+
+// usageGroup is the aggregate of ledger records sharing a key.
+type usageGroup struct {
+	Key              string  `json:"key"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	AvgLatencyMs     int64   `json:"avg_latency_ms"`
+	Estimated        bool    `json:"estimated"`
+
+	totalLatency int64
+}
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report token usage and estimated cost of LLM calls",
+	Long: `
+Every LLM call revly makes is recorded in .revly/usage.jsonl with its model,
+token counts, latency and estimated cost. 'usage' totals them by day, by
+command (review, commit, pair) and by model.
+
+Costs come from the [pricing] table in revly.config.toml, in USD per million
+tokens. Models without a price count as free. Token counts marked with ~ were
+estimated because the provider did not report them.
+
+	[pricing]
+	"openai/gpt-4o" = { prompt = 2.5, completion = 10.0 }
+	"*:free" = { prompt = 0, completion = 0 }`,
+	Example: `
+	revly usage
+		- Totals for the last 30 days, by day, command and model.
+
+	revly usage --since 24h --by model
+		- Only the last day, grouped by model.
+
+	revly usage --json
+		- Machine-readable totals.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sinceFlag, _ := cmd.Flags().GetString("since")
+		by, _ := cmd.Flags().GetStringSlice("by")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		since, err := parseSince(sinceFlag)
+		if err != nil {
+			color.Red("Invalid --since: %v", err)
+			return
+		}
+
+		records, err := usage.Load()
+		if err != nil {
+			color.Red("Error reading usage ledger: %v", err)
+			return
+		}
+
+		var selected []usage.Record
+		for _, r := range records {
+			if !r.Time.Before(since) {
+				selected = append(selected, r)
+			}
+		}
+
+		groupings := map[string]func(usage.Record) string{
+			"day":     func(r usage.Record) string { return r.Time.Local().Format("2006-01-02") },
+			"command": func(r usage.Record) string { return r.Command },
+			"model":   func(r usage.Record) string { return r.Model },
+		}
+		for _, b := range by {
+			if _, ok := groupings[b]; !ok {
+				color.Red("Unknown grouping %q (use day, command or model)", b)
+				return
+			}
+		}
+
+		total := groupUsage(selected, func(usage.Record) string { return "total" }, false)
+		report := map[string][]usageGroup{}
+		for _, b := range by {
+			report[b] = groupUsage(selected, groupings[b], b == "day")
+		}
+
+		if asJSON {
+			out := map[string]any{"since": since, "by": report}
+			if len(total) > 0 {
+				out["total"] = total[0]
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(out)
+			return
+		}
+
+		if len(selected) == 0 {
+			color.Yellow("No LLM calls recorded since %s.", since.Local().Format("2006-01-02 15:04"))
+			return
+		}
+
+		color.Cyan("LLM usage since %s", since.Local().Format("2006-01-02 15:04"))
+		fmt.Println()
+		printUsageTable("TOTAL", total)
+		for _, b := range by {
+			fmt.Println()
+			printUsageTable("BY "+strings.ToUpper(b), report[b])
+		}
+	},
+}
+
+// groupUsage aggregates records by key, largest cost first (then most calls),
+// or in key order when byKey is set, which keeps days chronological.
+func groupUsage(records []usage.Record, key func(usage.Record) string, byKey bool) []usageGroup {
+	index := map[string]*usageGroup{}
+	var groups []*usageGroup
+	for _, r := range records {
+		k := key(r)
+		g, ok := index[k]
+		if !ok {
+			g = &usageGroup{Key: k}
+			index[k] = g
+			groups = append(groups, g)
+		}
+		g.Calls++
+		g.PromptTokens += r.PromptTokens
+		g.CompletionTokens += r.CompletionTokens
+		g.CostUSD += r.CostUSD
+		g.totalLatency += r.LatencyMs
+		g.Estimated = g.Estimated || r.Estimated
+	}
+
+	out := make([]usageGroup, len(groups))
+	for i, g := range groups {
+		g.AvgLatencyMs = g.totalLatency / int64(g.Calls)
+		out[i] = *g
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if byKey {
+			return out[i].Key < out[j].Key
+		}
+		if out[i].CostUSD != out[j].CostUSD {
+			return out[i].CostUSD > out[j].CostUSD
+		}
+		return out[i].Calls > out[j].Calls
+	})
+	return out
+}
+
+func printUsageTable(title string, groups []usageGroup) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "%s\tCALLS\tPROMPT\tCOMPLETION\tAVG LATENCY\tCOST\t\n", title)
+	for _, g := range groups {
+		approx := ""
+		if g.Estimated {
+			approx = "~"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s%d\t%s%d\t%s\t$%.4f\t\n",
+			g.Key, g.Calls, approx, g.PromptTokens, approx, g.CompletionTokens,
+			(time.Duration(g.AvgLatencyMs) * time.Millisecond).Round(10*time.Millisecond), g.CostUSD)
+	}
+	w.Flush()
+}
+
+// parseSince accepts a Go duration ("36h") or a number of days ("7d").
+func parseSince(s string) (time.Time, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Now().AddDate(0, 0, -days), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-d), nil
+}
+
+func init() {
+	rootCmd.AddCommand(usageCmd)
+	usageCmd.Flags().String("since", "30d", "Only include calls newer than this (e.g. 24h, 7d)")
+	usageCmd.Flags().StringSlice("by", []string{"day", "command", "model"}, "Groupings to report: day, command, model")
+	usageCmd.Flags().Bool("json", false, "Print the report as JSON")
+}
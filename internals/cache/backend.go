@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// Backend stores encoded entries by task and key. Get returns an error
+// wrapping fs.ErrNotExist for a missing entry.
+type Backend interface {
+	Get(task, key string) ([]byte, error)
+	Put(task, key string, entry []byte) error
+}
+
+// local is the cache in the repository, which every lookup tries first.
+func local() *dirBackend {
+	return &dirBackend{root: cacheDir()}
+}
+
+func cacheDir() string {
+	return repo.State("cache")
+}
+
+// dirBackend keeps entries as files under root/<task>/<key>. It backs both
+// the local cache and a shared directory on a network filesystem.
+type dirBackend struct {
+	root string
+}
+
+func (d *dirBackend) Get(task, key string) ([]byte, error) {
+	var raw []byte
+	err := d.withLock(false, func() (err error) {
+		raw, err = os.ReadFile(filepath.Join(d.root, task, key))
+		return err
+	})
+	return raw, err
+}
+
+// Put writes the entry to a temporary file and renames it into place, so
+// readers see either the old entry or the complete new one.
+func (d *dirBackend) Put(task, key string, entry []byte) error {
+	dir := filepath.Join(d.root, task)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return d.withLock(true, func() error {
+		return writeAtomic(filepath.Join(dir, key), entry)
+	})
+}
+
+// touch marks an entry as used now, for LRU eviction.
+func (d *dirBackend) touch(task, key string) {
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(d.root, task, key), now, now)
+}
+
+// lockName is the file locked around reads and writes of a cache directory,
+// so concurrent revly processes (a pair session and a review, say) don't see
+// each other's half-written entries.
+const lockName = ".lock"
+
+// withLock runs fn holding the directory's lock, shared for readers and
+// exclusive for writers.
+func (d *dirBackend) withLock(exclusive bool, fn func() error) error {
+	f, err := os.OpenFile(filepath.Join(d.root, lockName), os.O_RDWR|os.O_CREATE, 0644)
+	if errors.Is(err, fs.ErrNotExist) {
+		// No cache directory yet, so nothing to race with.
+		return fn()
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f, exclusive); err != nil {
+		return fmt.Errorf("locking cache: %w", err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+// tempPrefix marks files being written; List skips them and Prune removes
+// ones left behind by a crash.
+const tempPrefix = ".tmp-"
+
+func writeAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// httpBackend talks to any server that answers GET and PUT on
+// <base>/<task>/<key>, such as a WebDAV share or a small object store
+// gateway. 404 is a miss.
+type httpBackend struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+func (h *httpBackend) url(task, key string) string {
+	return h.base + "/" + url.PathEscape(task) + "/" + url.PathEscape(key)
+}
+
+func (h *httpBackend) do(method, task, key string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, h.url(task, key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return h.client.Do(req)
+}
+
+func (h *httpBackend) Get(task, key string) ([]byte, error) {
+	resp, err := h.do(http.MethodGet, task, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%s/%s: %w", task, key, fs.ErrNotExist)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("GET %s: %s", h.url(task, key), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (h *httpBackend) Put(task, key string, entry []byte) error {
+	resp, err := h.do(http.MethodPut, task, key, entry)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("PUT %s: %s", h.url(task, key), resp.Status)
+	}
+	return nil
+}
+
+var (
+	remoteOnce     sync.Once
+	remoteBackend  Backend
+	remoteReadOnly bool
+	remoteErr      error
+)
+
+// Remote returns the shared cache configured by [cache.remote], or nil when
+// there is none, and whether revly may only read from it.
+func Remote() (Backend, bool, error) {
+	remoteOnce.Do(func() {
+		cfg, _ := config.GetConfig()
+		r := cfg.Cache.Remote
+		remoteReadOnly = r.ReadOnly
+		remoteBackend, remoteErr = newRemote(r)
+	})
+	return remoteBackend, remoteReadOnly, remoteErr
+}
+
+func newRemote(r config.CacheRemoteConfig) (Backend, error) {
+	switch r.Type {
+	case "":
+		return nil, nil
+	case "dir":
+		if r.Path == "" {
+			return nil, errors.New(`[cache.remote] type "dir" needs a path`)
+		}
+		return &dirBackend{root: repo.Resolve(r.Path)}, nil
+	case "http":
+		u, err := url.Parse(r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf(`[cache.remote] type "http" needs an http(s) url, not %q`, r.URL)
+		}
+		h := &httpBackend{
+			base:   strings.TrimSuffix(u.String(), "/"),
+			client: &http.Client{Timeout: r.Timeout},
+		}
+		if r.TokenEnv != "" {
+			h.token = os.Getenv(r.TokenEnv)
+		}
+		return h, nil
+	}
+	return nil, fmt.Errorf(`[cache.remote] type must be "dir" or "http", not %q`, r.Type)
+}
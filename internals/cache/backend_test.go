@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// objectStore is a server answering GET and PUT, as a shared cache must.
+type objectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	auth    []string
+}
+
+func (s *objectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path] = data
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPBackend(t *testing.T) {
+	store := &objectStore{objects: map[string][]byte{}}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+	t.Setenv("TEST_CACHE_TOKEN", "s3cret")
+
+	b, err := newRemote(config.CacheRemoteConfig{Type: "http", URL: srv.URL + "/revly/", TokenEnv: "TEST_CACHE_TOKEN", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get("review", "k"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of a missing entry: err = %v, want fs.ErrNotExist", err)
+	}
+	if err := b.Put("review", "k", []byte("entry")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := b.Get("review", "k"); err != nil || string(got) != "entry" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	if _, ok := store.objects["/revly/review/k"]; !ok {
+		t.Errorf("entry stored at %v, want /revly/review/k", store.objects)
+	}
+	for _, auth := range store.auth {
+		if auth != "Bearer s3cret" {
+			t.Errorf("Authorization = %q, want the token from TEST_CACHE_TOKEN", auth)
+		}
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+	b, _ = newRemote(config.CacheRemoteConfig{Type: "http", URL: failing.URL})
+	if _, err := b.Get("review", "k"); err == nil || errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Get from a server refusing it: err = %v", err)
+	}
+	if err := b.Put("review", "k", []byte("entry")); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put to a server refusing it: err = %v", err)
+	}
+}
+
+func TestNewRemote(t *testing.T) {
+	tests := []struct {
+		remote config.CacheRemoteConfig
+		err    string
+	}{
+		{config.CacheRemoteConfig{}, ""},
+		{config.CacheRemoteConfig{Type: "dir", Path: "/mnt/cache"}, ""},
+		{config.CacheRemoteConfig{Type: "dir"}, "needs a path"},
+		{config.CacheRemoteConfig{Type: "http", URL: "https://cache.example.com"}, ""},
+		{config.CacheRemoteConfig{Type: "http"}, "needs an http(s) url"},
+		{config.CacheRemoteConfig{Type: "http", URL: "ftp://cache.example.com"}, "needs an http(s) url"},
+		{config.CacheRemoteConfig{Type: "s3"}, `not "s3"`},
+	}
+	for _, tt := range tests {
+		b, err := newRemote(tt.remote)
+		if tt.err == "" && err != nil {
+			t.Errorf("newRemote(%+v): %v", tt.remote, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("newRemote(%+v): err = %v, want one containing %q", tt.remote, err, tt.err)
+		}
+		if (b == nil) != (tt.remote.Type == "" || tt.err != "") {
+			t.Errorf("newRemote(%+v) = %v", tt.remote, b)
+		}
+	}
+}
+
+// useRemote makes b the shared cache for the rest of the test.
+func useRemote(t *testing.T, b Backend, readOnly bool) {
+	t.Helper()
+	remoteOnce.Do(func() {})
+	remoteBackend, remoteReadOnly, remoteErr = b, readOnly, nil
+	t.Cleanup(func() { remoteBackend, remoteReadOnly = nil, false })
+}
+
+func TestSharedCache(t *testing.T) {
+	shared := &dirBackend{root: t.TempDir()}
+	useRemote(t, shared, false)
+
+	key := Key("review", []string{"m"}, "p", []byte(t.Name()))
+	if err := Save(key, Meta{Task: "review"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shared.Get("review", key); err != nil {
+		t.Fatalf("Save didn't upload the entry: %v", err)
+	}
+
+	// A teammate's entry is read through and kept locally.
+	if err := os.Remove(filepath.Join(cacheDir(), "review", key)); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := Load("review", key); err != nil || string(data) != "{}" {
+		t.Fatalf("Load from the shared cache = %q, %v", data, err)
+	}
+	if _, err := local().Get("review", key); err != nil {
+		t.Errorf("the shared entry wasn't copied locally: %v", err)
+	}
+
+	// A damaged download is a miss.
+	os.Remove(filepath.Join(cacheDir(), "review", key))
+	if err := shared.Put("review", key, []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load("review", key); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Load of a damaged shared entry: err = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestReadOnlySharedCache(t *testing.T) {
+	shared := &dirBackend{root: t.TempDir()}
+	useRemote(t, shared, true)
+
+	key := Key("review", []string{"m"}, "p", []byte(t.Name()))
+	if err := Save(key, Meta{Task: "review"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shared.Get("review", key); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a read-only shared cache was written to: %v", err)
+	}
+}
@@ -1,31 +1,144 @@
 package cache
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
-const cacheDir = ".revly/cache"
+var (
+	// ErrCorrupt is returned by Load for an entry whose header can't be read
+	// or whose contents don't match the checksum in it.
+	ErrCorrupt = errors.New("corrupt cache entry")
+	// ErrExpired is returned by Load for an entry older than the TTL.
+	ErrExpired = errors.New("expired cache entry")
+)
+
+// Meta is the JSON header stored at the top of every entry.
+type Meta struct {
+	Task      string    `json:"task"`
+	CreatedAt time.Time `json:"created_at"`
+	// Models is the fallback list the request was made with; Model is the
+	// one (or ones, comma separated) that answered.
+	Models     []string `json:"models"`
+	Model      string   `json:"model,omitempty"`
+	PromptHash string   `json:"prompt_hash"`
+
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
 
-func init() {
-	os.MkdirAll(cacheDir, 0755)
+	// Checksum is the SHA-256 of the body, set by Save.
+	Checksum string `json:"sha256"`
 }
 
-func Key(data []byte) string {
+// Key identifies a cached answer. Changing the task, the models, or the
+// prompt (through its hash) gives a new key, so stale answers are never
+// served after a config change.
+func Key(task string, models []string, promptHash string, input []byte) string {
 	hasher := sha256.New()
-	hasher.Write(data)
+	fmt.Fprintf(hasher, "%s\x00%s\x00%s\x00", task, strings.Join(models, "\x01"), promptHash)
+	hasher.Write(input)
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-func Save(key string, data []byte) error {
-	cacheFile := filepath.Join(cacheDir, key)
-	return ioutil.WriteFile(cacheFile, data, 0644)
+// Save stores data under meta.Task, with meta as its header. CreatedAt is
+// filled in if unset. The entry is written locally and, unless the remote is
+// read-only, uploaded to the shared cache.
+func Save(key string, meta Meta, data []byte) error {
+	if meta.Task == "" {
+		return errors.New("cache entry has no task")
+	}
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = time.Now()
+	}
+	meta.Checksum = checksum(data)
+	header, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.WriteByte('\n')
+	buf.Write(data)
+
+	if err := local().Put(meta.Task, key, buf.Bytes()); err != nil {
+		return err
+	}
+	autoPrune()
+
+	remote, readOnly, err := Remote()
+	if err != nil || remote == nil || readOnly {
+		return err
+	}
+	if err := remote.Put(meta.Task, key, buf.Bytes()); err != nil {
+		return fmt.Errorf("uploading to the shared cache: %w", err)
+	}
+	return nil
+}
+
+// Load returns an entry saved for task under key, looking in the shared
+// cache when the local one misses and keeping a local copy of what it finds.
+// Expired entries are misses. A hit marks the entry as recently used, for
+// eviction.
+func Load(task, key string) (Meta, []byte, error) {
+	raw, err := local().Get(task, key)
+	if err == nil {
+		var meta Meta
+		var data []byte
+		if meta, data, err = check(raw); err == nil {
+			local().touch(task, key)
+			return meta, data, nil
+		}
+	}
+
+	remote, _, remoteErr := Remote()
+	if remote == nil || remoteErr != nil {
+		return Meta{}, nil, err
+	}
+	raw, err = remote.Get(task, key)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	meta, data, err := check(raw)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	_ = local().Put(task, key, raw)
+	return meta, data, nil
+}
+
+// check decodes an entry and rejects it if it has expired.
+func check(raw []byte) (Meta, []byte, error) {
+	meta, data, err := decode(raw)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	if CurrentPolicy().Expired(meta) {
+		return Meta{}, nil, ErrExpired
+	}
+	return meta, data, nil
+}
+
+// decode splits an entry into its header and body, checking the body
+// against the header's checksum.
+func decode(raw []byte) (Meta, []byte, error) {
+	header, data, ok := bytes.Cut(raw, []byte("\n"))
+	var meta Meta
+	if !ok || json.Unmarshal(header, &meta) != nil || meta.Task == "" {
+		return Meta{}, nil, ErrCorrupt
+	}
+	if meta.Checksum != checksum(data) {
+		return Meta{}, nil, ErrCorrupt
+	}
+	return meta, data, nil
 }
 
-func Load(key string) ([]byte, error) {
-	cacheFile := filepath.Join(cacheDir, key)
-	return ioutil.ReadFile(cacheFile)
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// TestMain runs the tests in a scratch repository, whose .revly/cache they
+// fill and empty.
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+const testConfig = `version = 1
+
+[llm]
+models = ["m"]
+
+[cache]
+ttl = "1h"
+`
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "revly-cache-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "repo")
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "git init: %v\n%s", err, out)
+		return 1
+	}
+	if err := os.WriteFile(filepath.Join(root, repo.ConfigName), []byte(testConfig), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "REVLY_") {
+			os.Unsetenv(name)
+		}
+	}
+	os.Setenv("HOME", filepath.Join(dir, "home"))
+	if err := os.Chdir(root); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return m.Run()
+}
+
+func TestKey(t *testing.T) {
+	base := Key("review", []string{"a", "b"}, "p1", []byte("diff"))
+	if base != Key("review", []string{"a", "b"}, "p1", []byte("diff")) {
+		t.Fatal("the same request has two keys")
+	}
+	for name, key := range map[string]string{
+		"task":          Key("pair", []string{"a", "b"}, "p1", []byte("diff")),
+		"model order":   Key("review", []string{"b", "a"}, "p1", []byte("diff")),
+		"model list":    Key("review", []string{"a\x00b"}, "p1", []byte("diff")),
+		"prompt":        Key("review", []string{"a", "b"}, "p2", []byte("diff")),
+		"input":         Key("review", []string{"a", "b"}, "p1", []byte("diff2")),
+		"field borders": Key("review", []string{"a", "b"}, "p1d", []byte("iff")),
+	} {
+		if key == base {
+			t.Errorf("changing the %s kept the key", name)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	key := Key("review", []string{"m"}, "p", []byte(t.Name()))
+	meta := Meta{Task: "review", Models: []string{"m"}, Model: "m", PromptHash: "p", PromptTokens: 10, CompletionTokens: 2}
+	before := time.Now()
+	if err := Save(key, meta, []byte(`{"summary": "ok"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, data, err := Load("review", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"summary": "ok"}` {
+		t.Errorf("data = %q", data)
+	}
+	if got.CreatedAt.Before(before) || got.Checksum == "" {
+		t.Errorf("Save didn't stamp the entry: %+v", got)
+	}
+	got.CreatedAt, got.Checksum = time.Time{}, ""
+	if !reflect.DeepEqual(got, meta) {
+		t.Errorf("meta = %+v, want %+v", got, meta)
+	}
+	if _, err := os.Stat(filepath.Join(repo.Root(), ".revly", "cache", "review", key)); err != nil {
+		t.Errorf("entry isn't under .revly/cache/review: %v", err)
+	}
+
+	if _, _, err := Load("pair", key); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("another task's entry was served: %v", err)
+	}
+	if err := Save(key, Meta{}, nil); err == nil {
+		t.Error("an entry without a task was saved")
+	}
+}
+
+func TestConcurrentSaveLoad(t *testing.T) {
+	key := Key("review", []string{"m"}, "p", []byte(t.Name()))
+	bodies := []string{strings.Repeat("a", 64<<10), strings.Repeat("b", 64<<10)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(body string) {
+			defer wg.Done()
+			if err := Save(key, Meta{Task: "review"}, []byte(body)); err != nil {
+				t.Error(err)
+			}
+		}(bodies[i%2])
+		go func() {
+			defer wg.Done()
+			_, data, err := Load("review", key)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Load during a write: %v", err)
+			}
+			if err == nil && string(data) != bodies[0] && string(data) != bodies[1] {
+				t.Errorf("Load returned a torn entry of %d bytes", len(data))
+			}
+		}()
+	}
+	wg.Wait()
+
+	temps, _ := filepath.Glob(filepath.Join(cacheDir(), "review", tempPrefix+"*"))
+	if len(temps) != 0 {
+		t.Errorf("writes left temporary files behind: %q", temps)
+	}
+}
+
+func TestLoadRejectsCorruptEntries(t *testing.T) {
+	key := Key("review", []string{"m"}, "p", []byte(t.Name()))
+	if err := Save(key, Meta{Task: "review"}, []byte(`{"summary": "ok"}`)); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(cacheDir(), "review", key)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, entry := range map[string][]byte{
+		"truncated":   raw[:len(raw)-3],
+		"no header":   []byte(`{"summary": "ok"}`),
+		"wrong task":  []byte(strings.Replace(string(raw), `"task":"review"`, `"task":""`, 1)),
+		"edited body": []byte(strings.Replace(string(raw), "ok", "no", 1)),
+	} {
+		if err := os.WriteFile(path, entry, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Load("review", key); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: err = %v, want ErrCorrupt", name, err)
+		}
+	}
+}
+
+func TestPruneRemovesStaleTempFiles(t *testing.T) {
+	dir := filepath.Join(cacheDir(), "review")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stale, fresh := filepath.Join(dir, tempPrefix+"stale"), filepath.Join(dir, tempPrefix+"fresh")
+	for _, path := range []string{stale, fresh} {
+		if err := os.WriteFile(path, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleTemp)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Key, tempPrefix) {
+			t.Errorf("List included the temporary file %s", e.Key)
+		}
+	}
+	if _, err := Prune(Policy{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a stale temporary file survived Prune: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("Prune removed a file still being written: %v", err)
+	}
+	os.Remove(fresh)
+}
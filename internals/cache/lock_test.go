@@ -0,0 +1,73 @@
+//go:build unix || windows
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriterLockBlocksReaders(t *testing.T) {
+	d := &dirBackend{root: t.TempDir()}
+	if err := d.Put("review", "k", []byte("entry")); err != nil {
+		t.Fatal(err)
+	}
+
+	locked, release := make(chan struct{}), make(chan struct{})
+	writerDone := make(chan error)
+	go func() {
+		writerDone <- d.withLock(true, func() error {
+			close(locked)
+			<-release
+			return nil
+		})
+	}()
+	<-locked
+
+	read := make(chan error)
+	go func() {
+		_, err := d.Get("review", "k")
+		read <- err
+	}()
+	select {
+	case <-read:
+		t.Fatal("a read went ahead while a writer held the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-writerDone; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read never got the lock")
+	}
+}
+
+func TestReadersShareTheLock(t *testing.T) {
+	d := &dirBackend{root: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(d.root, lockName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	err := d.withLock(false, func() error {
+		go func() { done <- d.withLock(false, func() error { return nil }) }()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Error("a second reader waited for the first")
+			return nil
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// Policy bounds the cache. Zero values disable the corresponding limit.
+type Policy struct {
+	TTL     time.Duration
+	MaxSize int64
+}
+
+// CurrentPolicy returns the policy set by [cache] in the config.
+func CurrentPolicy() Policy {
+	cfg, _ := config.GetConfig()
+	return Policy{TTL: cfg.Cache.TTL, MaxSize: int64(cfg.Cache.MaxSizeMB) << 20}
+}
+
+// Expired reports whether an entry with meta is past the TTL.
+func (p Policy) Expired(meta Meta) bool {
+	return p.TTL > 0 && time.Since(meta.CreatedAt) > p.TTL
+}
+
+// Entry describes one file in the cache. Corrupt entries (empty, truncated,
+// or written by revly versions before entries had headers) have no Meta.
+type Entry struct {
+	Task     string
+	Key      string
+	Meta     Meta
+	Size     int64
+	LastUsed time.Time
+	Corrupt  bool
+}
+
+func (e Entry) path() string {
+	return filepath.Join(cacheDir(), e.Task, e.Key)
+}
+
+// List returns every entry in the cache, most recently used first.
+func List() ([]Entry, error) {
+	var entries []Entry
+	err := local().withLock(false, func() (err error) {
+		entries, _, err = list()
+		return err
+	})
+	return entries, err
+}
+
+// list walks the cache without locking it. It also returns temporary files
+// older than staleTemp, left behind by writers that crashed.
+func list() ([]Entry, []string, error) {
+	var entries []Entry
+	var stale []string
+	err := filepath.WalkDir(cacheDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if strings.HasPrefix(d.Name(), tempPrefix) && time.Since(info.ModTime()) > staleTemp {
+				stale = append(stale, path)
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(cacheDir(), path)
+		e := Entry{Key: filepath.Base(rel), Size: info.Size(), LastUsed: info.ModTime()}
+		if dir := filepath.Dir(rel); dir != "." {
+			e.Task = filepath.ToSlash(dir)
+		}
+
+		raw, err := os.ReadFile(path)
+		if err == nil {
+			e.Meta, _, err = decode(raw)
+		}
+		e.Corrupt = err != nil || e.Task == "" || e.Meta.Task != e.Task
+		entries = append(entries, e)
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, stale, err
+}
+
+// staleTemp is how old a temporary file must be before Prune assumes its
+// writer is gone.
+const staleTemp = time.Hour
+
+// Find returns the entry whose key starts with prefix.
+func Find(prefix string) (Entry, error) {
+	entries, err := List()
+	if err != nil {
+		return Entry{}, err
+	}
+	var found []Entry
+	for _, e := range entries {
+		if strings.HasPrefix(e.Key, prefix) {
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Entry{}, fmt.Errorf("no cache entry matches %q", prefix)
+	case 1:
+		return found[0], nil
+	}
+	return Entry{}, fmt.Errorf("%d cache entries match %q; give more of the key", len(found), prefix)
+}
+
+// Read returns the raw contents of an entry.
+func Read(e Entry) ([]byte, error) {
+	var raw []byte
+	err := local().withLock(false, func() (err error) {
+		raw, err = os.ReadFile(e.path())
+		return err
+	})
+	return raw, err
+}
+
+// PruneReport counts what Prune removed, or would remove on a dry run.
+type PruneReport struct {
+	Corrupt int
+	Expired int
+	Evicted int
+	Freed   int64
+	// Remaining is the size of the cache afterwards.
+	Remaining int64
+}
+
+// Removed is the total number of entries pruned.
+func (r PruneReport) Removed() int {
+	return r.Corrupt + r.Expired + r.Evicted
+}
+
+// Prune removes corrupt and expired entries, then evicts the least recently
+// used ones until the cache fits in p.MaxSize. With dryRun nothing is deleted.
+func Prune(p Policy, dryRun bool) (PruneReport, error) {
+	var report PruneReport
+	err := local().withLock(true, func() error {
+		var err error
+		report, err = prune(p, dryRun)
+		return err
+	})
+	return report, err
+}
+
+func prune(p Policy, dryRun bool) (PruneReport, error) {
+	var report PruneReport
+	entries, stale, err := list()
+	if err != nil {
+		return report, err
+	}
+	if !dryRun {
+		for _, path := range stale {
+			os.Remove(path)
+		}
+	}
+
+	remove := func(e Entry, count *int) error {
+		if !dryRun {
+			if err := os.Remove(e.path()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		*count++
+		report.Freed += e.Size
+		return nil
+	}
+
+	var kept []Entry
+	for _, e := range entries {
+		switch {
+		case e.Corrupt:
+			err = remove(e, &report.Corrupt)
+		case p.Expired(e.Meta):
+			err = remove(e, &report.Expired)
+		default:
+			kept = append(kept, e)
+			report.Remaining += e.Size
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+
+	// kept is most recently used first, so evict from the end.
+	for i := len(kept) - 1; i >= 0 && p.MaxSize > 0 && report.Remaining > p.MaxSize; i-- {
+		if err := remove(kept[i], &report.Evicted); err != nil {
+			return report, err
+		}
+		report.Remaining -= kept[i].Size
+	}
+	return report, nil
+}
+
+// Clear removes every entry for task, or the whole cache when task is empty.
+func Clear(task string) (int, error) {
+	removed := 0
+	err := local().withLock(true, func() error {
+		entries, _, err := list()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if task != "" && e.Task != task {
+				continue
+			}
+			if err := os.Remove(e.path()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// pruneInterval throttles the pruning Save does, so a long pair session
+// keeps the cache bounded without walking it on every suggestion.
+const pruneInterval = time.Minute
+
+var (
+	pruneMu   sync.Mutex
+	lastPrune time.Time
+)
+
+func autoPrune() {
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+	if time.Since(lastPrune) < pruneInterval {
+		return
+	}
+	lastPrune = time.Now()
+	_, _ = Prune(CurrentPolicy(), false)
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// putEntry writes an entry straight into the local cache, bypassing Save
+// and the pruning it does, last used at lastUsed.
+func putEntry(t *testing.T, task, key string, created, lastUsed time.Time, data string) {
+	t.Helper()
+	meta := Meta{Task: task, CreatedAt: created, Checksum: checksum([]byte(data))}
+	header, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := local().Put(task, key, append(append(header, '\n'), data...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(cacheDir(), task, key), lastUsed, lastUsed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func keys(t *testing.T) []string {
+	t.Helper()
+	entries, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Task+"/"+e.Key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func emptyCache(t *testing.T) {
+	t.Helper()
+	if _, err := Clear(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	emptyCache(t)
+	now := time.Now()
+	body := strings.Repeat("x", 1000)
+	putEntry(t, "review", "expired", now.Add(-2*time.Hour), now, body)
+	putEntry(t, "review", "oldest", now, now.Add(-3*time.Minute), body)
+	putEntry(t, "review", "older", now, now.Add(-2*time.Minute), body)
+	putEntry(t, "pair", "newest", now, now.Add(-time.Minute), body)
+	if err := local().Put("review", "corrupt", []byte("not an entry")); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(body)) + 200
+
+	policy := Policy{TTL: time.Hour, MaxSize: 2 * size}
+	report, err := Prune(policy, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Corrupt != 1 || report.Expired != 1 || report.Evicted != 1 {
+		t.Errorf("dry run report = %+v, want one corrupt, one expired, one evicted", report)
+	}
+	if got := keys(t); len(got) != 5 {
+		t.Errorf("a dry run removed entries: %q", got)
+	}
+
+	if _, err := Prune(policy, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pair/newest", "review/older"}
+	if got := keys(t); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("kept %q, want %q", got, want)
+	}
+}
+
+func TestPruneWithoutLimits(t *testing.T) {
+	emptyCache(t)
+	now := time.Now()
+	putEntry(t, "review", "ancient", now.AddDate(-1, 0, 0), now.AddDate(-1, 0, 0), "old")
+	report, err := Prune(Policy{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Removed() != 0 || len(keys(t)) != 1 {
+		t.Errorf("a zero policy pruned %+v", report)
+	}
+}
+
+func TestLoadSkipsExpiredEntries(t *testing.T) {
+	emptyCache(t)
+	now := time.Now()
+	putEntry(t, "review", "stale", now.Add(-2*time.Hour), now, "{}")
+	putEntry(t, "review", "fresh", now.Add(-30*time.Minute), now, "{}")
+
+	if _, _, err := Load("review", "stale"); !errors.Is(err, ErrExpired) {
+		t.Errorf("Load of an entry past the ttl: err = %v, want ErrExpired", err)
+	}
+	if _, _, err := Load("review", "fresh"); err != nil {
+		t.Errorf("Load of a fresh entry: %v", err)
+	}
+}
+
+func TestLoadMarksEntriesUsed(t *testing.T) {
+	emptyCache(t)
+	now := time.Now()
+	putEntry(t, "review", "a", now, now.Add(-time.Hour), "{}")
+	if _, _, err := Load("review", "a"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || time.Since(entries[0].LastUsed) > time.Minute {
+		t.Errorf("a hit didn't mark the entry as used: %+v", entries)
+	}
+}
+
+func TestFindAndClear(t *testing.T) {
+	emptyCache(t)
+	now := time.Now()
+	putEntry(t, "review", "abc123", now, now, "{}")
+	putEntry(t, "review", "abd456", now, now, "{}")
+	putEntry(t, "pair", "ffe789", now, now, "{}")
+
+	if e, err := Find("abc"); err != nil || e.Key != "abc123" || e.Task != "review" {
+		t.Errorf("Find(abc) = %+v, %v", e, err)
+	}
+	if _, err := Find("ab"); err == nil || !strings.Contains(err.Error(), "2 cache entries match") {
+		t.Errorf("Find(ab) err = %v, want it ambiguous", err)
+	}
+	if _, err := Find("zz"); err == nil {
+		t.Error("Find(zz) found an entry")
+	}
+
+	if n, err := Clear("review"); err != nil || n != 2 {
+		t.Errorf("Clear(review) = %d, %v", n, err)
+	}
+	if got := keys(t); len(got) != 1 || got[0] != "pair/ffe789" {
+		t.Errorf("after clearing review: %q", got)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
 )
 
 type GitConfig struct {
@@ -15,57 +17,327 @@ type GitConfig struct {
 
 
 type LLMConfig struct {
+	Provider string   `toml:"provider"`
+	BaseURL  string   `toml:"base_url"`
 	Endpoint string   `toml:"api_base_url"`
 	Models   []string `toml:"models"`
+
+	// KeyEnv names the environment variable holding the API key, tried
+	// before LLM_API_KEY and the provider's usual variables.
+	KeyEnv string `toml:"key_env"`
+	// KeyCommand is a shell command printing the API key, such as
+	// "pass show openrouter". It is only read from the user config.
+	KeyCommand string `toml:"key_command"`
+
+	// MaxRetries is how many times a rate-limited or failing request is
+	// retried against the same model before moving on to the next one.
+	MaxRetries int `toml:"max_retries"`
+
+	// RequestTimeout bounds a single HTTP request, including reading a
+	// streamed response. Timeout bounds a whole command's worth of LLM calls
+	// across retries and fallback models. Zero disables either.
+	RequestTimeout time.Duration `toml:"request_timeout"`
+	Timeout        time.Duration `toml:"timeout"`
+
+	// ContextWindow overrides the built-in context size table for every
+	// configured model, in tokens.
+	ContextWindow int `toml:"context_window"`
+}
+
+// TaskConfig routes one kind of request (review, commit or pair) to its own
+// models. Unset fields fall back to [llm]; a nil Temperature or zero
+// MaxTokens leaves the provider's default.
+type TaskConfig struct {
+	Models      []string      `toml:"models"`
+	Temperature *float64      `toml:"temperature"`
+	MaxTokens   int           `toml:"max_tokens"`
+	Timeout     time.Duration `toml:"timeout"`
+}
+
+type ModelsConfig struct {
+	Review TaskConfig `toml:"review"`
+	Commit TaskConfig `toml:"commit"`
+	Pair   TaskConfig `toml:"pair"`
+}
+
+type PromptsConfig struct {
+	// Dir holds prompt templates overriding the built-in ones, named
+	// review.tmpl, commit.tmpl and so on. Defaults to .revly/prompts.
+	Dir string `toml:"dir"`
+	// Guidelines is team guidance passed to every prompt as {{.Guidelines}}.
+	Guidelines string `toml:"guidelines"`
+	// GuidelinesFile is read into {{.Guidelines}} when Guidelines is unset.
+	GuidelinesFile string `toml:"guidelines_file"`
+}
+
+type ReviewConfig struct {
+	// Concurrency is how many chunks of a large diff are reviewed at once.
+	Concurrency int `toml:"concurrency"`
+	// ChunkTokens caps the size of each chunk below the model's context window.
+	ChunkTokens int `toml:"chunk_tokens"`
+	// Exclude lists files to leave out of reviews, in .gitignore syntax, on
+	// top of those in .revlyignore.
+	Exclude []string `toml:"exclude"`
+	// Include, when set, limits reviews to the files it matches.
+	Include []string `toml:"include"`
+	// Tools lets the model look around the repository while it reviews.
+	Tools ReviewToolsConfig `toml:"tools"`
+}
+
+type ReviewToolsConfig struct {
+	// Enabled offers the model read_file, grep, list_dir and git_log, all
+	// read-only and confined to the repository.
+	Enabled bool `toml:"enabled"`
+	// MaxCalls caps the tool calls in one review, and MaxBytes the output
+	// they return in total.
+	MaxCalls int `toml:"max_calls"`
+	MaxBytes int `toml:"max_bytes"`
+}
+
+type CacheConfig struct {
+	// TTL is how long an entry is served after it was written; zero keeps
+	// entries until they are evicted.
+	TTL time.Duration `toml:"ttl"`
+	// MaxSizeMB caps the cache directory; the least recently used entries
+	// are evicted past it. Zero disables the cap.
+	MaxSizeMB int `toml:"max_size_mb"`
+	// Remote is a cache shared with teammates and CI, read when the local
+	// one misses.
+	Remote CacheRemoteConfig `toml:"remote"`
+}
+
+type CacheRemoteConfig struct {
+	// Type is "dir" for a shared directory or "http" for a server answering
+	// GET and PUT on <url>/<task>/<key>. Empty disables the shared cache.
+	Type string `toml:"type"`
+	Path string `toml:"path"`
+	URL  string `toml:"url"`
+	// TokenEnv names an environment variable holding a bearer token for http.
+	TokenEnv string `toml:"token_env"`
+	// ReadOnly only downloads, for machines that shouldn't publish reviews.
+	ReadOnly bool          `toml:"read_only"`
+	Timeout  time.Duration `toml:"timeout"`
+}
+
+type RedactConfig struct {
+	// Mode is "redact" to replace secrets with placeholders before anything
+	// is sent to the LLM, "block" to refuse to send it at all, or "off".
+	Mode string `toml:"mode"`
+	// Patterns are extra regular expressions for secrets; when one has a
+	// capture group, only the group is hidden.
+	Patterns []string `toml:"patterns"`
+	// Allow are regular expressions for values that look secret but aren't,
+	// such as test fixtures.
+	Allow []string `toml:"allow"`
+	// Entropy also hides long, random-looking string literals.
+	Entropy bool `toml:"entropy"`
+}
+
+// ModelPrice is what a model costs in USD per million tokens.
+type ModelPrice struct {
+	Prompt     float64 `toml:"prompt"`
+	Completion float64 `toml:"completion"`
 }
 
 type RevlyConfig struct {
-	LLM LLMConfig `toml:"llm"`
-	Git GitConfig `toml:"git"`
+	// Version is the schema version of the file; see SchemaVersion.
+	Version int                   `toml:"version"`
+	LLM     LLMConfig             `toml:"llm"`
+	Models  ModelsConfig          `toml:"models"`
+	Review  ReviewConfig          `toml:"review"`
+	Git     GitConfig             `toml:"git"`
+	Cache   CacheConfig           `toml:"cache"`
+	Prompts PromptsConfig         `toml:"prompts"`
+	Redact  RedactConfig          `toml:"redact"`
+	Pricing map[string]ModelPrice `toml:"pricing"`
+	// Profiles are named overrides of [llm], [models] and [git]; see
+	// ProfileConfig.
+	Profiles map[string]ProfileConfig `toml:"profiles"`
+}
+
+// defaults holds the values used for keys missing from the config file.
+func defaults() RevlyConfig {
+	return RevlyConfig{
+		LLM: LLMConfig{
+			MaxRetries:     2,
+			RequestTimeout: 2 * time.Minute,
+			Timeout:        5 * time.Minute,
+		},
+		Review: ReviewConfig{
+			Concurrency: 4,
+			Tools:       ReviewToolsConfig{MaxCalls: 20, MaxBytes: 100_000},
+		},
+		Cache: CacheConfig{
+			TTL:       30 * 24 * time.Hour,
+			MaxSizeMB: 50,
+			Remote:    CacheRemoteConfig{Timeout: 5 * time.Second},
+		},
+		Redact: RedactConfig{
+			Mode:    "redact",
+			Entropy: true,
+		},
+	}
+}
+
+// Task returns the settings for a task ("review", "commit" or "pair") with
+// the model list and timeout filled in from [llm] when the task doesn't set
+// them.
+func (c RevlyConfig) Task(name string) TaskConfig {
+	var t TaskConfig
+	switch name {
+	case "review":
+		t = c.Models.Review
+	case "commit":
+		t = c.Models.Commit
+	case "pair":
+		t = c.Models.Pair
+	}
+	if len(t.Models) == 0 {
+		t.Models = c.LLM.Models
+	}
+	if t.Timeout == 0 {
+		t.Timeout = c.LLM.Timeout
+	}
+	return t
 }
 
 var (
 	config     RevlyConfig
+	origins    map[string]string
+	problems   []Problem
 	configErr  error
 	loadedOnce sync.Once
 )
 
-// GetConfig loads and returns the parsed Revly config. Only loads once (singleton).
+// GetConfig loads and returns the Revly config. Layers are merged in order,
+// each overriding the keys it sets: built-in defaults, the user config, the
+// repository config, the active profile, REVLY_* environment variables, then
+// --set flags.
+// Files in an older format are migrated in memory, with a warning in
+// Problems; only
+// Migrate rewrites them. Unknown keys and invalid values are errors. Only
+// loads once (singleton).
 func GetConfig() (RevlyConfig, error) {
 	loadedOnce.Do(func() {
-		pathsToTry := []string{}
+		config = defaults()
+		origins = map[string]string{}
+		setByRepo = map[string]bool{}
+		profiles = map[string]*profile{}
 
-		// Current working directory
-		cwd, err := os.Getwd()
-		if err == nil {
-			pathsToTry = append(pathsToTry, filepath.Join(cwd, "revly.config.toml"))
+		var tried []string
+		for _, f := range Files() {
+			tried = append(tried, f.Path)
+			if !f.Exists() {
+				continue
+			}
+			data, err := os.ReadFile(f.Path)
+			if err != nil {
+				configErr = fmt.Errorf("failed to read revly config at %s: %w", f.Path, err)
+				return
+			}
+			problems = append(problems, outdated(f.Path, data)...)
+			data, _ = migrate(data)
+			fromRepo := f.Scope == "repo"
+			if fromRepo {
+				var raw map[string]any
+				if md, err := toml.Decode(string(data), &raw); err == nil {
+					problems = append(problems, userOnlyKeys(md, f.Path)...)
+				}
+			}
+			prev := config
+			md, err := toml.Decode(string(data), &config)
+			if fromRepo {
+				// Never use user-only values a repository supplied, even for
+				// commands that carry on despite an invalid config.
+				keepUserOnly(&config, prev)
+			}
+			if err != nil {
+				configErr = fmt.Errorf("failed to parse revly config at %s: %w", f.Path, err)
+				return
+			}
+			problems = append(problems, unknownKeys(md, f.Path)...)
+			record(md, f.Path, fromRepo)
+			if err := collectProfiles(profiles, f.Path, data); err != nil {
+				configErr = fmt.Errorf("failed to parse revly config at %s: %w", f.Path, err)
+				return
+			}
 		}
 
-		// ~/.revly/config.toml and ~/revly.config.toml
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			configErr = fmt.Errorf("unable to find user home directory: %w", err)
-			return
+		name, source, problem := selectProfile()
+		if problem != nil {
+			problems = append(problems, *problem)
 		}
-		pathsToTry = append(pathsToTry,
-			filepath.Join(homeDir, ".revly", "config.toml"),
-			filepath.Join(homeDir, "revly.config.toml"),
-		)
-
-		// Try loading from each path
-		for _, path := range pathsToTry {
-			if _, err := os.Stat(path); err == nil {
-				if _, err := toml.DecodeFile(path, &config); err != nil {
-					configErr = fmt.Errorf("failed to parse revly config at %s: %w", path, err)
-				} else {
-					configErr = nil
-				}
+		if name != "" {
+			mds, err := applyProfile(&config, name, profiles[name])
+			if err != nil {
+				configErr = err
 				return
 			}
+			for i, md := range mds {
+				record(md, "profile:"+name, profiles[name].layers[i].file == repo.ConfigFile())
+			}
+			activeProfile, profileSource = name, source
 		}
 
-		configErr = fmt.Errorf("revly config not found in: %v", pathsToTry)
+		if err := applyEnv(&config, os.Environ()); err != nil {
+			configErr = err
+			return
+		}
+		if err := applyOverrides(&config, overrides); err != nil {
+			configErr = err
+			return
+		}
+		if len(origins) == 0 {
+			configErr = fmt.Errorf("revly config not found in: %v", tried)
+			return
+		}
+		problems = append(problems, Check(config)...)
+		if hasErrors(problems) {
+			configErr = &ValidationError{Problems: problems}
+		}
 	})
 
 	return config, configErr
-}
\ No newline at end of file
+}
+
+// Problems returns everything wrong with the loaded config, warnings
+// included.
+func Problems() []Problem {
+	GetConfig()
+	return problems
+}
+
+// ValidateFile checks a single config file on top of the defaults, and each
+// profile it defines on top of that, as migrated to the current format.
+func ValidateFile(path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return validateData(path, data), nil
+}
+
+// validateData is ValidateFile for the contents of the file at path.
+func validateData(path string, data []byte) []Problem {
+	found := outdated(path, data)
+	migrated, _ := migrate(data)
+	cfg := defaults()
+	md, err := toml.Decode(string(migrated), &cfg)
+	if err != nil {
+		return append(found, Problem{File: path, Message: err.Error()})
+	}
+	found = append(found, unknownKeys(md, path)...)
+	if abs, err := filepath.Abs(path); err == nil && abs == repo.ConfigFile() {
+		found = append(found, userOnlyKeys(md, path)...)
+	}
+	for _, p := range Check(cfg) {
+		p.File = path
+		found = append(found, p)
+	}
+	base := func() RevlyConfig {
+		c := defaults()
+		toml.Decode(string(migrated), &c)
+		return c
+	}
+	return append(found, checkProfiles(path, migrated, base)...)
+}
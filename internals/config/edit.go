@@ -0,0 +1,213 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// Set writes key = value into the config file at path, creating it if
+// needed. The rest of the file, comments included, is left as it was. The
+// result must pass the checks of 'revly config validate' that the file
+// passed before, or nothing is written.
+func Set(path, key, value string) error {
+	keyPath, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	t, err := fieldType(keyPath)
+	if err != nil {
+		return err
+	}
+	literal := Literal(value, t)
+	if reason, ok := userOnlyReason(keyPath); ok && path == repo.ConfigFile() {
+		return fmt.Errorf("%s %s, so it can only be set in the user config (use --user)", key, reason)
+	}
+
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		lines = []string{fmt.Sprintf("version = %d", SchemaVersion)}
+	}
+	lines = setLine(lines, keyPath[:len(keyPath)-1], keyPath[len(keyPath)-1], literal)
+	return writeLines(path, lines)
+}
+
+// setLine sets leaf in table to a TOML literal, replacing its current
+// definition or adding one at the end of the table.
+func setLine(lines []string, table []string, leaf, literal string) []string {
+	line := toml.Key{leaf}.String() + " = " + literal
+	if start, end, ok := findKey(lines, table, leaf); ok {
+		indent := lines[start][:len(lines[start])-len(strings.TrimLeft(lines[start], " \t"))]
+		return splice(lines, start, end, indent+line)
+	}
+	if at, ok := tableEnd(lines, table); ok {
+		return splice(lines, at, at, line)
+	}
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+		lines = append(lines, "")
+	}
+	return append(lines, "["+toml.Key(table).String()+"]", line)
+}
+
+// Unset removes key from the config file at path, reporting whether it was
+// there.
+func Unset(path, key string) (bool, error) {
+	keyPath, err := splitKey(key)
+	if err != nil {
+		return false, err
+	}
+	lines, err := readLines(path)
+	if err != nil {
+		return false, err
+	}
+	start, end, ok := findKey(lines, keyPath[:len(keyPath)-1], keyPath[len(keyPath)-1])
+	if !ok {
+		return false, nil
+	}
+	return true, writeLines(path, splice(lines, start, end))
+}
+
+// splice replaces lines[start:end] with repl.
+func splice(lines []string, start, end int, repl ...string) []string {
+	out := append([]string{}, lines[:start]...)
+	out = append(out, repl...)
+	return append(out, lines[end:]...)
+}
+
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// writeLines writes lines to path unless that adds an error ValidateFile
+// would report. Errors the file already had don't block an unrelated edit.
+func writeLines(path string, lines []string) error {
+	data := strings.Join(lines, "\n") + "\n"
+	old, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	before := map[string]bool{}
+	for _, p := range validateData(path, old) {
+		before[p.String()] = true
+	}
+	for _, p := range validateData(path, []byte(data)) {
+		if !p.Warning && !before[p.String()] {
+			return fmt.Errorf("not writing %s, the result would not be valid: %s", path, p)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(data), 0644)
+}
+
+// tableHeader returns the key of a "[table]" line.
+func tableHeader(line string) ([]string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || strings.HasPrefix(line, "[[") {
+		return nil, false
+	}
+	end := strings.Index(line, "]")
+	if end < 0 {
+		return nil, false
+	}
+	path, err := splitKey(line[1:end])
+	return path, err == nil
+}
+
+func sameKey(a, b []string) bool {
+	return toml.Key(a).String() == toml.Key(b).String()
+}
+
+// findKey locates the lines [start, end) defining leaf in table, including
+// the continuation lines of a multi-line array.
+func findKey(lines []string, table []string, leaf string) (int, int, bool) {
+	var current []string
+	for i, line := range lines {
+		if h, ok := tableHeader(line); ok {
+			current = h
+			continue
+		}
+		if !sameKey(current, table) {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		trimmed := strings.TrimSpace(name)
+		if !ok || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if k, err := splitKey(trimmed); err != nil || !sameKey(k, []string{leaf}) {
+			continue
+		}
+		end := i + 1
+		for depth := brackets(value); depth > 0 && end < len(lines); end++ {
+			depth += brackets(lines[end])
+		}
+		return i, end, true
+	}
+	return 0, 0, false
+}
+
+// tableEnd returns where to add a key to table: after its last key, or
+// before the first table for top-level keys.
+func tableEnd(lines []string, table []string) (int, bool) {
+	var current []string
+	found := len(table) == 0
+	at := 0
+	for i, line := range lines {
+		if h, ok := tableHeader(line); ok {
+			if found && sameKey(current, table) {
+				return at, true
+			}
+			current = h
+			if sameKey(h, table) {
+				found, at = true, i+1
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if sameKey(current, table) && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			at = i + 1
+		}
+	}
+	return at, found
+}
+
+// brackets counts unclosed [ in a line, ignoring strings and comments.
+func brackets(line string) int {
+	depth := 0
+	quote := rune(0)
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return depth
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth
+}
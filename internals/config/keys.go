@@ -0,0 +1,234 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Keys lists every settable key of the schema, such as "llm.timeout". Keys
+// inside maps like [pricing] aren't fixed and are left out.
+func Keys() []string {
+	var keys []string
+	var walk func(prefix []string, t reflect.Type)
+	walk = func(prefix []string, t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := tomlName(f)
+			if name == "" {
+				continue
+			}
+			path := append(append([]string{}, prefix...), name)
+			switch {
+			case f.Type.Kind() == reflect.Struct:
+				walk(path, f.Type)
+			case f.Type.Kind() == reflect.Map:
+			default:
+				keys = append(keys, toml.Key(path).String())
+			}
+		}
+	}
+	walk(nil, reflect.TypeOf(RevlyConfig{}))
+	return keys
+}
+
+func tomlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+	if name == "-" || !f.IsExported() {
+		return ""
+	}
+	return name
+}
+
+// fieldType returns the Go type a key decodes into, or an error for a key
+// the schema doesn't have.
+func fieldType(path []string) (reflect.Type, error) {
+	t := reflect.TypeOf(RevlyConfig{})
+	for i, name := range path {
+		switch t.Kind() {
+		case reflect.Struct:
+			found := false
+			for j := 0; j < t.NumField(); j++ {
+				if tomlName(t.Field(j)) == name {
+					t, found = t.Field(j).Type, true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown config key %q", toml.Key(path[:i+1]).String())
+			}
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("unknown config key %q: %s is not a table", toml.Key(path).String(), toml.Key(path[:i]).String())
+		}
+	}
+	if t.Kind() == reflect.Struct || t.Kind() == reflect.Map {
+		return nil, fmt.Errorf("%s is a table, not a value", toml.Key(path).String())
+	}
+	return t, nil
+}
+
+// splitKey splits a dotted key, honouring quoted parts such as
+// pricing."openai/gpt-4o".prompt.
+func splitKey(key string) ([]string, error) {
+	var parts []string
+	var cur strings.Builder
+	quote := byte(0)
+	quoted := false
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote, quoted = c, true
+		case c == '.':
+			if cur.Len() == 0 && !quoted {
+				return nil, fmt.Errorf("invalid key %q", key)
+			}
+			parts = append(parts, cur.String())
+			cur.Reset()
+			quoted = false
+		case c == ' ' || c == '\t':
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	if quote != 0 || (cur.Len() == 0 && !quoted) {
+		return nil, fmt.Errorf("invalid key %q", key)
+	}
+	return append(parts, cur.String()), nil
+}
+
+// canonical normalises how a key is quoted, so origins can be looked up by
+// whatever spelling the user typed.
+func canonical(key string) string {
+	path, err := splitKey(key)
+	if err != nil {
+		return key
+	}
+	return toml.Key(path).String()
+}
+
+// Literal turns a command-line value into a TOML literal for type t.
+// Strings and durations don't need quotes, and lists can be given as
+// comma-separated values: --set llm.models=a,b.
+func Literal(value string, t reflect.Type) string {
+	value = strings.TrimSpace(value)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	quoted := strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'")
+	switch {
+	case t == durationType, t.Kind() == reflect.String:
+		if quoted {
+			return value
+		}
+		return quote(value)
+	case t.Kind() == reflect.Slice && !strings.HasPrefix(value, "["):
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, Literal(item, t.Elem()))
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return value
+}
+
+func quote(s string) string {
+	var buf bytes.Buffer
+	_ = toml.NewEncoder(&buf).Encode(map[string]string{"v": s})
+	return strings.TrimSpace(strings.TrimPrefix(buf.String(), "v = "))
+}
+
+// Entry is one effective config value.
+type Entry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
+// Entries returns every value that is set in cfg, as TOML literals, in
+// schema order.
+func Entries(cfg RevlyConfig) []Entry {
+	var entries []Entry
+	var walk func(prefix []string, v reflect.Value, inMap bool)
+	walk = func(prefix []string, v reflect.Value, inMap bool) {
+		switch v.Kind() {
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if name := tomlName(v.Type().Field(i)); name != "" {
+					walk(append(append([]string{}, prefix...), name), v.Field(i), inMap)
+				}
+			}
+		case reflect.Map:
+			keys := v.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			for _, k := range keys {
+				walk(append(append([]string{}, prefix...), k.String()), v.MapIndex(k), true)
+			}
+		case reflect.Pointer:
+			if !v.IsNil() {
+				walk(prefix, v.Elem(), inMap)
+			}
+		default:
+			key := toml.Key(prefix).String()
+			origin := Origin(key)
+			// Inside maps such as [profiles], only list what a file set.
+			if inMap && origin == OriginDefault {
+				return
+			}
+			entries = append(entries, Entry{Key: key, Value: formatValue(v), Origin: origin})
+		}
+	}
+	walk(nil, reflect.ValueOf(cfg), false)
+	return entries
+}
+
+// Lookup returns the entry for key, or every entry under it when key names
+// a table.
+func Lookup(cfg RevlyConfig, key string) ([]Entry, error) {
+	key = canonical(key)
+	var found []Entry
+	for _, e := range Entries(cfg) {
+		if e.Key == key || strings.HasPrefix(e.Key, key+".") {
+			found = append(found, e)
+		}
+	}
+	if len(found) > 0 {
+		return found, nil
+	}
+	path, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fieldType(path); err != nil {
+		return nil, err
+	}
+	return nil, errors.New(key + " is not set")
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return quote(time.Duration(v.Int()).String())
+	}
+	if v.Kind() == reflect.Slice && v.Len() == 0 {
+		return "[]"
+	}
+	var buf bytes.Buffer
+	_ = toml.NewEncoder(&buf).Encode(map[string]any{"v": v.Interface()})
+	return strings.TrimSpace(strings.TrimPrefix(buf.String(), "v = "))
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// OriginDefault is the origin of values nothing overrode.
+const OriginDefault = "default"
+
+// File is one config file layer.
+type File struct {
+	// Scope is "user" or "repo".
+	Scope string
+	Path  string
+}
+
+func (f File) Exists() bool {
+	_, err := os.Stat(f.Path)
+	return err == nil
+}
+
+// Files lists the config files in the order they are merged; later files
+// override earlier ones. ~/revly.config.toml is the older location of the
+// user config and is still read.
+func Files() []File {
+	var files []File
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files,
+			File{Scope: "user", Path: filepath.Join(home, "revly.config.toml")},
+			File{Scope: "user", Path: UserFile()},
+		)
+	}
+	return append(files, File{Scope: "repo", Path: repo.ConfigFile()})
+}
+
+// UserFile is the user config that 'revly config set --user' writes.
+func UserFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".revly", "config.toml")
+}
+
+// record notes origin as the source of every value md decoded. User-only
+// keys from the repository config were not applied, so aren't noted.
+func record(md toml.MetaData, origin string, fromRepo bool) {
+	for _, k := range md.Keys() {
+		if _, ok := userOnlyReason(k); ok && fromRepo {
+			continue
+		}
+		if md.Type(k...) != "Hash" {
+			origins[k.String()] = origin
+			if fromRepo {
+				setByRepo[k.String()] = true
+			} else {
+				delete(setByRepo, k.String())
+			}
+		}
+	}
+}
+
+// setByRepo holds the keys whose effective value came from the repository
+// config, directly or through a profile section in it.
+var setByRepo map[string]bool
+
+// SetByRepo reports whether the effective value of key came from the
+// repository config, directly or through a profile section in it.
+func SetByRepo(key string) bool {
+	GetConfig()
+	return setByRepo[canonical(key)]
+}
+
+// Origin returns where the effective value of key came from: a file path,
+// an environment variable, a flag, or OriginDefault.
+func Origin(key string) string {
+	if o, ok := origins[canonical(key)]; ok {
+		return o
+	}
+	return OriginDefault
+}
+
+const envPrefix = "REVLY_"
+
+// EnvName is the environment variable overriding key, e.g. REVLY_LLM_TIMEOUT
+// for llm.timeout.
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// applyEnv applies REVLY_* variables naming a config key. Other REVLY_*
+// variables are left to whatever reads them.
+func applyEnv(cfg *RevlyConfig, environ []string) error {
+	byName := map[string]string{}
+	for _, k := range Keys() {
+		if k != "version" {
+			byName[EnvName(k)] = k
+		}
+	}
+	var names []string
+	values := map[string]string{}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if _, ok := byName[name]; ok {
+			names = append(names, name)
+			values[name] = value
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := byName[name]
+		if err := apply(cfg, key, values[name]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		origins[key] = "env:" + name
+		delete(setByRepo, key)
+	}
+	return nil
+}
+
+var overrides []string
+
+// SetOverrides registers key=value pairs from --set flags. It must be called
+// before the config is first loaded.
+func SetOverrides(pairs []string) {
+	overrides = pairs
+}
+
+func applyOverrides(cfg *RevlyConfig, pairs []string) error {
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("--set %s: expected key=value", pair)
+		}
+		key = strings.TrimSpace(key)
+		if err := apply(cfg, key, value); err != nil {
+			return fmt.Errorf("--set %s: %w", key, err)
+		}
+		origins[canonical(key)] = "flag:--set"
+		delete(setByRepo, canonical(key))
+	}
+	return nil
+}
+
+// apply sets one key from a command-line style value.
+func apply(cfg *RevlyConfig, key, value string) error {
+	path, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	t, err := fieldType(path)
+	if err != nil {
+		return err
+	}
+	doc := toml.Key(path[len(path)-1:]).String() + " = " + Literal(value, t) + "\n"
+	if len(path) > 1 {
+		doc = "[" + toml.Key(path[:len(path)-1]).String() + "]\n" + doc
+	}
+	if _, err := toml.Decode(doc, cfg); err != nil {
+		return fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SchemaVersion is the config file format this revly writes, stored in the
+// top-level version key. Files without one are version 0.
+const SchemaVersion = 1
+
+// migrations[v] upgrades a file from version v to v+1, editing its lines in
+// place so comments survive, and describes what it changed.
+var migrations = []func(lines []string) ([]string, []string){
+	migrateV1,
+}
+
+// migrateV1 fixes files scaffolded by older versions of 'revly init', which
+// put the model list under [models] where it was never read, and had an
+// unused git.show_diff.
+func migrateV1(lines []string) ([]string, []string) {
+	var notes []string
+	if start, end, ok := findKey(lines, []string{"models"}, "models"); ok {
+		_, value, _ := strings.Cut(strings.Join(lines[start:end], "\n"), "=")
+		lines = splice(lines, start, end)
+		if _, _, ok := findKey(lines, []string{"llm"}, "models"); ok {
+			notes = append(notes, "removed [models] models, which [llm] models already replaces")
+		} else {
+			lines = setLine(lines, []string{"llm"}, "models", strings.TrimSpace(value))
+			notes = append(notes, "moved models from [models] to [llm]")
+		}
+	}
+	if start, end, ok := findKey(lines, []string{"git"}, "show_diff"); ok {
+		lines = splice(lines, start, end)
+		notes = append(notes, "removed git.show_diff, which was never used")
+	}
+	return lines, notes
+}
+
+// fileVersion reads the version key of a config file.
+func fileVersion(data []byte) (int, error) {
+	var head struct {
+		Version int `toml:"version"`
+	}
+	_, err := toml.Decode(string(data), &head)
+	return max(head.Version, 0), err
+}
+
+// migrate upgrades data to SchemaVersion. It returns data unchanged when it
+// is current or doesn't parse; decoding reports the latter.
+func migrate(data []byte) ([]byte, []string) {
+	version, err := fileVersion(data)
+	if err != nil || version >= SchemaVersion {
+		return data, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var notes []string
+	for v := version; v < SchemaVersion; v++ {
+		var n []string
+		lines, n = migrations[v](lines)
+		notes = append(notes, n...)
+	}
+	lines = setVersion(lines)
+	return []byte(strings.Join(lines, "\n") + "\n"), notes
+}
+
+// setVersion writes the version key, after the file's opening comments.
+func setVersion(lines []string) []string {
+	line := fmt.Sprintf("version = %d", SchemaVersion)
+	if start, end, ok := findKey(lines, nil, "version"); ok {
+		return splice(lines, start, end, line)
+	}
+	at := 0
+	for at < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[at]), "#") {
+		at++
+	}
+	if at == 0 {
+		return splice(lines, 0, 0, line, "")
+	}
+	return splice(lines, at, at, "", line)
+}
+
+// outdated warns when a file is in an older format. Loading migrates it in
+// memory; 'revly config migrate' rewrites it.
+func outdated(path string, data []byte) []Problem {
+	version, err := fileVersion(data)
+	if err != nil || version >= SchemaVersion {
+		return nil
+	}
+	return []Problem{{File: path, Key: "version", Warning: true,
+		Message: fmt.Sprintf("config version %d is older than %d; run 'revly config migrate' to upgrade the file", version, SchemaVersion)}}
+}
+
+// Migrate upgrades the config file at path to SchemaVersion in place,
+// keeping the original as <path>.bak with the same permissions, and returns
+// what it changed. upgraded is false when the file was already current.
+func Migrate(path string) (notes []string, upgraded bool, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := fileVersion(data); err != nil {
+		return nil, false, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	migrated, notes := migrate(data)
+	if string(migrated) == string(data) {
+		return nil, false, nil
+	}
+	mode := info.Mode().Perm()
+	if err := writeFileMode(path+".bak", data, mode); err != nil {
+		return nil, false, err
+	}
+	if err := writeFileMode(path, migrated, mode); err != nil {
+		return nil, false, err
+	}
+	return notes, true, nil
+}
+
+// writeFileMode writes data to path and leaves it with mode, even when the
+// file already existed with another.
+func writeFileMode(path string, data []byte, mode os.FileMode) error {
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// ProfileConfig is a [profiles.<name>] section. Its tables override the
+// top-level ones of the same name when the profile is active.
+type ProfileConfig struct {
+	// Match selects the profile automatically when a remote URL of the
+	// repository matches one of these globs, e.g. "*github.com?acme/*".
+	Match  []string     `toml:"match"`
+	LLM    LLMConfig    `toml:"llm"`
+	Models ModelsConfig `toml:"models"`
+	Git    GitConfig    `toml:"git"`
+}
+
+// profileLayer is one file's section for a profile, re-encoded as a document
+// holding only the keys it sets, so applying it overrides nothing else.
+type profileLayer struct {
+	file string
+	doc  string
+}
+
+type profile struct {
+	match  []string
+	layers []profileLayer
+}
+
+// ProfileEnv selects a profile when --profile isn't given.
+const ProfileEnv = "REVLY_PROFILE"
+
+var (
+	profiles      map[string]*profile
+	profileFlag   string
+	activeProfile string
+	profileSource string
+)
+
+// SetProfile selects a profile from the --profile flag. It must be called
+// before the config is first loaded.
+func SetProfile(name string) {
+	profileFlag = name
+}
+
+// Profile returns the active profile and what selected it: "--profile",
+// "env:REVLY_PROFILE" or "remote <url>". name is "" when none is active.
+func Profile() (name, source string) {
+	GetConfig()
+	return activeProfile, profileSource
+}
+
+// ProfileInfo describes a defined profile.
+type ProfileInfo struct {
+	Name  string
+	Match []string
+	Files []string
+}
+
+// Profiles lists the profiles defined across the config files, by name.
+func Profiles() []ProfileInfo {
+	GetConfig()
+	var infos []ProfileInfo
+	for _, name := range profileNames() {
+		p := profiles[name]
+		info := ProfileInfo{Name: name, Match: p.match}
+		for _, l := range p.layers {
+			info.Files = append(info.Files, l.file)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func profileNames() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectProfiles adds the [profiles.*] sections of one file to into. A later
+// file's match list replaces an earlier one's; their other keys merge.
+func collectProfiles(into map[string]*profile, file string, data []byte) error {
+	var raw struct {
+		Profiles map[string]map[string]any `toml:"profiles"`
+	}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return err
+	}
+	for name, section := range raw.Profiles {
+		p := into[name]
+		if p == nil {
+			p = &profile{}
+			into[name] = p
+		}
+		if match, ok := section["match"].([]any); ok {
+			p.match = nil
+			for _, m := range match {
+				if s, ok := m.(string); ok {
+					p.match = append(p.match, s)
+				}
+			}
+		}
+		delete(section, "match")
+
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(section); err != nil {
+			return err
+		}
+		p.layers = append(p.layers, profileLayer{file: file, doc: buf.String()})
+	}
+	return nil
+}
+
+// selectProfile picks the active profile: --profile, then REVLY_PROFILE,
+// then the one profile whose match patterns fit a remote of the repository.
+func selectProfile() (name, source string, problem *Problem) {
+	switch {
+	case profileFlag != "":
+		name, source = profileFlag, "--profile"
+	case os.Getenv(ProfileEnv) != "":
+		name, source = os.Getenv(ProfileEnv), "env:"+ProfileEnv
+	default:
+		return matchProfile()
+	}
+	if profiles[name] == nil {
+		defined := "none are defined"
+		if names := profileNames(); len(names) > 0 {
+			defined = "defined: " + strings.Join(names, ", ")
+		}
+		return "", "", &Problem{Key: "profiles", Message: fmt.Sprintf("profile %q selected by %s doesn't exist (%s)", name, source, defined)}
+	}
+	return name, source, nil
+}
+
+func matchProfile() (name, source string, problem *Problem) {
+	var remotes []string
+	fetched := false
+	var matched []string
+	var url string
+	for _, n := range profileNames() {
+		if len(profiles[n].match) == 0 {
+			continue
+		}
+		if !fetched {
+			remotes, fetched = repo.RemoteURLs(), true
+		}
+		if u, ok := matchRemote(profiles[n].match, remotes); ok {
+			matched = append(matched, n)
+			url = u
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", "", nil
+	case 1:
+		return matched[0], "remote " + url, nil
+	}
+	return "", "", &Problem{Key: "profiles", Message: fmt.Sprintf(
+		"the repository's remotes match profiles %s; choose one with --profile or %s", strings.Join(matched, " and "), ProfileEnv)}
+}
+
+// matchRemote returns the first remote URL matching one of the patterns.
+func matchRemote(patterns, remotes []string) (string, bool) {
+	for _, r := range remotes {
+		for _, p := range patterns {
+			if globRegexp(p).MatchString(r) {
+				return r, true
+			}
+		}
+	}
+	return "", false
+}
+
+// globRegexp compiles a pattern in which * matches any run of characters,
+// slashes included, and ? matches any single one.
+func globRegexp(pattern string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// applyProfile decodes a profile's sections over cfg, in file order, and
+// returns what each decoded. A section from the repository config can't set
+// user-only keys.
+func applyProfile(cfg *RevlyConfig, name string, p *profile) ([]toml.MetaData, error) {
+	var mds []toml.MetaData
+	for _, l := range p.layers {
+		prev := *cfg
+		md, err := toml.Decode(l.doc, cfg)
+		if l.file == repo.ConfigFile() {
+			keepUserOnly(cfg, prev)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply profile %s from %s: %w", name, l.file, err)
+		}
+		mds = append(mds, md)
+	}
+	return mds, nil
+}
+
+// checkProfiles validates every profile defined in one file by applying it
+// over base. Problems base already has aren't repeated.
+func checkProfiles(file string, data []byte, base func() RevlyConfig) []Problem {
+	defined := map[string]*profile{}
+	if err := collectProfiles(defined, file, data); err != nil {
+		return nil
+	}
+	var names []string
+	for name := range defined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := map[string]bool{}
+	for _, p := range Check(base()) {
+		seen[p.String()] = true
+	}
+	var found []Problem
+	for _, name := range names {
+		cfg := base()
+		if _, err := applyProfile(&cfg, name, defined[name]); err != nil {
+			found = append(found, Problem{File: file, Key: "profiles." + name, Message: err.Error()})
+			continue
+		}
+		for _, p := range Check(cfg) {
+			if seen[p.String()] {
+				continue
+			}
+			p.File = file
+			p.Key = "profiles." + name + "." + p.Key
+			found = append(found, p)
+		}
+	}
+	return found
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// Problem is something wrong with the configuration. Warnings don't stop
+// revly from running; errors do.
+type Problem struct {
+	// File is the config file the problem is in, or "" when it is in the
+	// merged result.
+	File    string `json:"file,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+	Warning bool   `json:"warning,omitempty"`
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.File != "" {
+		b.WriteString(p.File + ": ")
+	}
+	if p.Key != "" {
+		b.WriteString(p.Key + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ValidationError is returned by GetConfig when the config has errors.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, p := range e.Problems {
+		if !p.Warning {
+			msgs = append(msgs, p.String())
+		}
+	}
+	if len(msgs) == 1 {
+		return "invalid revly config: " + msgs[0]
+	}
+	return "invalid revly config:\n  " + strings.Join(msgs, "\n  ") + "\n(run 'revly config validate' for details)"
+}
+
+// hasErrors reports whether any problem is an error.
+func hasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// Providers are the accepted values of llm.provider; "" means openrouter.
+var Providers = []string{"openrouter", "openai", "openai-compatible", "compatible", "anthropic", "gemini", "google", "ollama"}
+
+// RedactModes are the accepted values of redact.mode.
+var RedactModes = []string{"redact", "block", "off"}
+
+// unknownKeys reports keys in a file that the schema doesn't have, with a
+// suggestion when the key exists in another table.
+func unknownKeys(md toml.MetaData, file string) []Problem {
+	var problems []Problem
+	reported := map[string]bool{}
+	for _, k := range md.Undecoded() {
+		// Only report the outermost unknown table, not each key inside it.
+		if len(k) > 1 && reported[k[:len(k)-1].String()] {
+			reported[k.String()] = true
+			continue
+		}
+		reported[k.String()] = true
+
+		msg := "unknown key"
+		if md.Type(k...) == "Hash" {
+			msg = "unknown table"
+		}
+		if k[0] == "profiles" && len(k) == 3 {
+			msg += "; profiles can only override llm, models and git"
+		} else if s := suggest(k[len(k)-1]); s != "" && s != k.String() {
+			msg += fmt.Sprintf("; did you mean %s?", s)
+		}
+		problems = append(problems, Problem{File: file, Key: k.String(), Message: msg})
+	}
+	return problems
+}
+
+// userOnly maps the keys a repository config may not set to why: a cloned
+// repository shouldn't be able to run commands, or choose where code and
+// secrets are sent.
+var userOnly = map[string]string{
+	"llm.key_command":        "runs a program",
+	"llm.key_env":            "chooses which secret is sent to the endpoint",
+	"cache.remote.url":       "receives reviewed code",
+	"cache.remote.token_env": "names a secret sent to the shared cache",
+}
+
+// userOnlyReason returns why key, directly or in a profile, is user-only.
+func userOnlyReason(key []string) (string, bool) {
+	if len(key) > 2 && key[0] == "profiles" {
+		key = key[2:]
+	}
+	reason, ok := userOnly[strings.Join(key, ".")]
+	return reason, ok
+}
+
+// keepUserOnly restores into cfg the user-only values of prev, the config
+// before a repository layer was decoded over it.
+func keepUserOnly(cfg *RevlyConfig, prev RevlyConfig) {
+	cfg.LLM.KeyCommand = prev.LLM.KeyCommand
+	cfg.LLM.KeyEnv = prev.LLM.KeyEnv
+	cfg.Cache.Remote.URL = prev.Cache.Remote.URL
+	cfg.Cache.Remote.TokenEnv = prev.Cache.Remote.TokenEnv
+}
+
+// userOnlyKeys reports the user-only keys a repository config sets.
+func userOnlyKeys(md toml.MetaData, file string) []Problem {
+	var problems []Problem
+	for _, k := range md.Keys() {
+		if reason, ok := userOnlyReason(k); ok {
+			problems = append(problems, Problem{File: file, Key: k.String(),
+				Message: fmt.Sprintf("%s %s, so it can only be set in the user config (revly config set --user)", k[len(k)-1], reason)})
+		}
+	}
+	return problems
+}
+
+// suggest names the schema keys ending in leaf that are nearest the top
+// level, e.g. "llm.models" for a stray "models".
+func suggest(leaf string) string {
+	var best []string
+	depth := 0
+	for _, k := range Keys() {
+		if k != leaf && !strings.HasSuffix(k, "."+leaf) {
+			continue
+		}
+		d := strings.Count(k, ".")
+		switch {
+		case len(best) == 0 || d < depth:
+			best, depth = []string{k}, d
+		case d == depth:
+			best = append(best, k)
+		}
+	}
+	switch len(best) {
+	case 0:
+		return ""
+	case 1:
+		return best[0]
+	}
+	return strings.Join(best[:len(best)-1], ", ") + " or " + best[len(best)-1]
+}
+
+// Check reports values that are out of range or don't fit together.
+func Check(c RevlyConfig) []Problem {
+	var problems []Problem
+	bad := func(key, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+	warn := func(key, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...), Warning: true})
+	}
+	nonNegative := func(key string, n int) {
+		if n < 0 {
+			bad(key, "must not be negative, got %d", n)
+		}
+	}
+	duration := func(key string, d time.Duration) {
+		if d < 0 {
+			bad(key, "must not be negative, got %s", d)
+		}
+	}
+	httpURL := func(key, raw string) {
+		if raw == "" {
+			return
+		}
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			bad(key, "must be an http(s) URL, got %q", raw)
+		}
+	}
+
+	if c.Version > SchemaVersion {
+		bad("version", "config version %d is newer than this revly understands (%d); upgrade revly", c.Version, SchemaVersion)
+	}
+
+	if c.LLM.Provider != "" && !contains(Providers, c.LLM.Provider) {
+		bad("llm.provider", "unknown provider %q (use one of %s)", c.LLM.Provider, strings.Join(Providers, ", "))
+	}
+	if (c.LLM.Provider == "openai-compatible" || c.LLM.Provider == "compatible") && c.LLM.BaseURL == "" && c.LLM.Endpoint == "" {
+		bad("llm.base_url", "is required for provider %q", c.LLM.Provider)
+	}
+	httpURL("llm.base_url", c.LLM.BaseURL)
+	httpURL("llm.api_base_url", c.LLM.Endpoint)
+	nonNegative("llm.max_retries", c.LLM.MaxRetries)
+	duration("llm.request_timeout", c.LLM.RequestTimeout)
+	duration("llm.timeout", c.LLM.Timeout)
+	nonNegative("llm.context_window", c.LLM.ContextWindow)
+
+	var noModels []string
+	for _, task := range []string{"review", "commit", "pair"} {
+		t := c.Task(task)
+		prefix := "models." + task
+		if len(t.Models) == 0 {
+			noModels = append(noModels, task)
+		}
+		if t.Temperature != nil && (*t.Temperature < 0 || *t.Temperature > 2) {
+			bad(prefix+".temperature", "must be between 0 and 2, got %g", *t.Temperature)
+		}
+		raw := map[string]TaskConfig{"review": c.Models.Review, "commit": c.Models.Commit, "pair": c.Models.Pair}[task]
+		nonNegative(prefix+".max_tokens", raw.MaxTokens)
+		duration(prefix+".timeout", raw.Timeout)
+	}
+	if len(noModels) > 0 {
+		warn("llm.models", "no models configured for %s", strings.Join(noModels, ", "))
+	}
+
+	if c.Review.Concurrency < 1 {
+		bad("review.concurrency", "must be at least 1, got %d", c.Review.Concurrency)
+	}
+	nonNegative("review.chunk_tokens", c.Review.ChunkTokens)
+	nonNegative("review.tools.max_calls", c.Review.Tools.MaxCalls)
+	nonNegative("review.tools.max_bytes", c.Review.Tools.MaxBytes)
+	if t := c.Review.Tools; t.Enabled && (t.MaxCalls == 0 || t.MaxBytes == 0) {
+		warn("review.tools", "tools are enabled but max_calls or max_bytes is 0, so no tool can run")
+	}
+
+	duration("cache.ttl", c.Cache.TTL)
+	nonNegative("cache.max_size_mb", c.Cache.MaxSizeMB)
+	switch r := c.Cache.Remote; r.Type {
+	case "":
+	case "dir":
+		if r.Path == "" {
+			bad("cache.remote.path", `is required for type "dir"`)
+		}
+	case "http":
+		if r.URL == "" {
+			bad("cache.remote.url", `is required for type "http"`)
+		}
+		httpURL("cache.remote.url", r.URL)
+		if r.TokenEnv != "" && os.Getenv(r.TokenEnv) == "" {
+			warn("cache.remote.token_env", "%s is not set", r.TokenEnv)
+		}
+	default:
+		bad("cache.remote.type", `must be "dir" or "http", got %q`, r.Type)
+	}
+	duration("cache.remote.timeout", c.Cache.Remote.Timeout)
+
+	if !contains(RedactModes, c.Redact.Mode) {
+		bad("redact.mode", "must be one of %s, got %q", strings.Join(RedactModes, ", "), c.Redact.Mode)
+	}
+	for i, p := range c.Redact.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			bad(fmt.Sprintf("redact.patterns[%d]", i), "%v", err)
+		}
+	}
+	for i, p := range c.Redact.Allow {
+		if _, err := regexp.Compile(p); err != nil {
+			bad(fmt.Sprintf("redact.allow[%d]", i), "%v", err)
+		}
+	}
+
+	if f := c.Prompts.GuidelinesFile; f != "" && c.Prompts.Guidelines == "" {
+		if _, err := os.Stat(repo.Resolve(f)); err != nil {
+			warn("prompts.guidelines_file", "%v", err)
+		}
+	}
+
+	var models []string
+	for m := range c.Pricing {
+		models = append(models, m)
+	}
+	sort.Strings(models)
+	for _, m := range models {
+		p := c.Pricing[m]
+		key := toml.Key{"pricing", m}.String()
+		if p.Prompt < 0 || p.Completion < 0 {
+			bad(key, "prices must not be negative")
+		}
+	}
+	return problems
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
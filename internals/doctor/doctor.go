@@ -0,0 +1,390 @@
+// Package doctor checks that everything revly depends on is in place: git and
+// the repository, the tools revly runs, the config, the API key, the LLM
+// endpoint and models, the cache and the terminal.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/cache"
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/llm"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+	"golang.org/x/term"
+)
+
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Check  string `json:"check"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Options controls which checks run.
+type Options struct {
+	// Network enables the endpoint and model checks. The model check sends
+	// each configured model a tiny prompt.
+	Network bool
+}
+
+// Run runs every check, in the order they are listed.
+func Run(ctx context.Context, opts Options) []Result {
+	var results []Result
+	results = append(results, checkGit()...)
+	results = append(results, checkRepo())
+	results = append(results, checkTools()...)
+	cfg, configResults := checkConfig()
+	results = append(results, configResults...)
+	results = append(results, checkKey(cfg.LLM))
+	if opts.Network {
+		results = append(results, checkEndpoint(ctx, cfg.LLM))
+		results = append(results, checkModels(ctx, cfg)...)
+	}
+	results = append(results, checkCache(cfg)...)
+	return append(results, checkTerminal())
+}
+
+// Failed reports whether any check failed.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// minGit is the oldest git with 'git show --diff-merges', which reviewing a
+// commit uses.
+var minGit = [2]int{2, 31}
+
+func checkGit() []Result {
+	if _, err := exec.LookPath("git"); err != nil {
+		return []Result{{"git", Fail, "git is not installed or not on PATH"}}
+	}
+	out, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		return []Result{{"git", Fail, fmt.Sprintf("git --version failed: %v", err)}}
+	}
+	version := strings.TrimPrefix(strings.TrimSpace(string(out)), "git version ")
+	m := regexp.MustCompile(`^(\d+)\.(\d+)`).FindStringSubmatch(version)
+	if m == nil {
+		return []Result{{"git", Warn, "couldn't parse the version: " + version}}
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	if major < minGit[0] || major == minGit[0] && minor < minGit[1] {
+		return []Result{{"git", Warn, fmt.Sprintf("%s is older than %d.%d; reviewing commits may fail", version, minGit[0], minGit[1])}}
+	}
+	return []Result{{"git", Pass, version}}
+}
+
+func checkRepo() Result {
+	if !repo.InRepo() {
+		return Result{"repository", Fail, "not inside a git repository; revly reviews the repository it runs in"}
+	}
+	root := repo.Root()
+	if exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD").Run() != nil {
+		return Result{"repository", Warn, root + " has no commits yet; --head and --commit reviews need one"}
+	}
+	out, err := exec.Command("git", "symbolic-ref", "--quiet", "--short", "HEAD").Output()
+	if err != nil {
+		return Result{"repository", Warn, root + " is on a detached HEAD"}
+	}
+	return Result{"repository", Pass, fmt.Sprintf("%s, on %s", root, strings.TrimSpace(string(out)))}
+}
+
+// tools are the programs revly runs besides git, and what needs them.
+var tools = []struct{ name, usedBy string }{
+	{"rsync", "revly pair"},
+}
+
+func checkTools() []Result {
+	var results []Result
+	for _, t := range tools {
+		path, err := exec.LookPath(t.name)
+		if err != nil {
+			results = append(results, Result{t.name, Warn, fmt.Sprintf("not installed; %s needs it", t.usedBy)})
+			continue
+		}
+		results = append(results, Result{t.name, Pass, path})
+	}
+	return results
+}
+
+func checkConfig() (config.RevlyConfig, []Result) {
+	var loaded []string
+	for _, f := range config.Files() {
+		if f.Exists() {
+			loaded = append(loaded, f.Path)
+		}
+	}
+	if len(loaded) == 0 {
+		return config.RevlyConfig{}, []Result{{"config", Fail, "no config file found; run 'revly init'"}}
+	}
+	results := []Result{{"config files", Pass, strings.Join(loaded, ", ")}}
+
+	cfg, err := config.GetConfig()
+	var invalid *config.ValidationError
+	if err != nil && !errors.As(err, &invalid) {
+		return cfg, append(results, Result{"config", Fail, err.Error()})
+	}
+	errs, warnings := 0, 0
+	for _, p := range config.Problems() {
+		status := Fail
+		if p.Warning {
+			status = Warn
+			warnings++
+		} else {
+			errs++
+		}
+		results = append(results, Result{"config", status, p.String()})
+	}
+	if errs == 0 && warnings == 0 {
+		results = append(results, Result{"config", Pass, "valid"})
+	}
+	if name, source := config.Profile(); name != "" {
+		results = append(results, Result{"profile", Pass, fmt.Sprintf("%s, selected by %s", name, source)})
+	}
+	return cfg, results
+}
+
+func checkKey(cfg config.LLMConfig) Result {
+	if !llm.RequiresAPIKey(cfg) {
+		return Result{"api key", Pass, cfg.Provider + " doesn't need one"}
+	}
+	cred, err := llm.ResolveKey(cfg)
+	if err == nil {
+		return Result{"api key", Pass, "found in " + cred.Source}
+	}
+	var missing *llm.MissingKeyError
+	if !errors.As(err, &missing) {
+		return Result{"api key", Fail, err.Error()}
+	}
+
+	// A key set under another provider's variable is an easy mistake.
+	read := map[string]bool{}
+	for _, name := range llm.KeyEnvs(cfg) {
+		read[name] = true
+	}
+	var others []string
+	for _, name := range llm.AllKeyEnvs() {
+		if !read[name] && os.Getenv(name) != "" {
+			others = append(others, name)
+		}
+	}
+	switch len(others) {
+	case 0:
+		return Result{"api key", Fail, err.Error()}
+	case 1:
+		return Result{"api key", Fail, fmt.Sprintf("%v; %s is set, so llm.key_env = %q may be what you want", err, others[0], others[0])}
+	}
+	return Result{"api key", Fail, fmt.Sprintf("%v; %s are set, so llm.key_env may need to name one of them", err, strings.Join(others, " and "))}
+}
+
+func checkEndpoint(ctx context.Context, cfg config.LLMConfig) Result {
+	endpoint := llm.EndpointURL(cfg)
+	if endpoint == "" {
+		return Result{"endpoint", Fail, "no endpoint configured; set llm.base_url"}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return Result{"endpoint", Fail, fmt.Sprintf("%q is not a valid URL", endpoint)}
+	}
+
+	// Any HTTP response at all means the host is reachable; whether the key
+	// and models work is the model check's job.
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.Scheme+"://"+u.Host, nil)
+	if err != nil {
+		return Result{"endpoint", Fail, err.Error()}
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Result{"endpoint", Fail, fmt.Sprintf("%s is unreachable: %v", endpoint, err)}
+	}
+	resp.Body.Close()
+	return Result{"endpoint", Pass, fmt.Sprintf("%s reachable in %s", endpoint, time.Since(start).Round(time.Millisecond))}
+}
+
+// checkModels sends every model any task uses a tiny prompt, all at once.
+func checkModels(ctx context.Context, cfg config.RevlyConfig) []Result {
+	var models []string
+	seen := map[string]bool{}
+	for _, task := range []string{"review", "commit", "pair"} {
+		for _, m := range cfg.Task(task).Models {
+			if !seen[m] {
+				seen[m] = true
+				models = append(models, m)
+			}
+		}
+	}
+	if len(models) == 0 {
+		return []Result{{"models", Fail, "no models configured; set llm.models"}}
+	}
+	cred, err := llm.ResolveKey(cfg.LLM)
+	if err != nil {
+		return []Result{{"models", Warn, "not checked: no API key"}}
+	}
+	key := cred.Key
+
+	results := make([]Result, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check := "model " + model
+			took, err := llm.CheckModel(ctx, cfg.LLM, key, model)
+			if err != nil {
+				results[i] = Result{check, Fail, err.Error()}
+				return
+			}
+			results[i] = Result{check, Pass, "answered in " + took.Round(10*time.Millisecond).String()}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func checkCache(cfg config.RevlyConfig) []Result {
+	dir := repo.State("cache")
+	if err := writable(dir); err != nil {
+		return []Result{{"cache", Fail, fmt.Sprintf("%s is not writable: %v", dir, err)}}
+	}
+	entries, err := cache.List()
+	if err != nil {
+		return []Result{{"cache", Fail, fmt.Sprintf("couldn't read %s: %v", dir, err)}}
+	}
+	var size int64
+	corrupt := 0
+	for _, e := range entries {
+		size += e.Size
+		if e.Corrupt {
+			corrupt++
+		}
+	}
+	limit := int64(cfg.Cache.MaxSizeMB) << 20
+	detail := fmt.Sprintf("%s: %d entries, %s", dir, len(entries), megabytes(size))
+	if len(entries) == 1 {
+		detail = fmt.Sprintf("%s: 1 entry, %s", dir, megabytes(size))
+	}
+	if limit > 0 {
+		detail += " of " + megabytes(limit)
+	}
+
+	var results []Result
+	switch {
+	case corrupt > 0:
+		results = append(results, Result{"cache", Warn, fmt.Sprintf("%s; %d corrupt, run 'revly cache prune'", detail, corrupt)})
+	case limit > 0 && size > limit:
+		results = append(results, Result{"cache", Warn, detail + "; over the limit, run 'revly cache prune'"})
+	default:
+		results = append(results, Result{"cache", Pass, detail})
+	}
+	if cfg.Cache.Remote.Type != "" {
+		results = append(results, checkRemote(cfg.Cache.Remote))
+	}
+	return results
+}
+
+func checkRemote(r config.CacheRemoteConfig) Result {
+	where := r.URL
+	if r.Type == "dir" {
+		where = repo.Resolve(r.Path)
+		if _, err := os.Stat(where); err != nil {
+			return Result{"shared cache", Fail, err.Error()}
+		}
+	}
+	backend, readOnly, err := cache.Remote()
+	if err != nil {
+		return Result{"shared cache", Fail, err.Error()}
+	}
+	// A key that can't exist: a clean miss shows the backend answers.
+	if _, err := backend.Get("doctor", "0000000000000000"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Result{"shared cache", Fail, fmt.Sprintf("%s: %v", where, err)}
+	}
+	mode := "read-write"
+	if readOnly {
+		mode = "read-only"
+	}
+	return Result{"shared cache", Pass, fmt.Sprintf("%s (%s)", where, mode)}
+}
+
+// writable checks that dir, or the nearest existing directory above it, can
+// be written to, without creating dir.
+func writable(dir string) error {
+	for {
+		if info, err := os.Stat(dir); err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".revly-doctor-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func megabytes(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+func checkTerminal() Result {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return Result{"terminal", Pass, "output is not a terminal; colors and spinners are off"}
+	}
+	termName := os.Getenv("TERM")
+	if termName == "dumb" {
+		return Result{"terminal", Warn, "TERM=dumb; reviews are shown without colors"}
+	}
+	var parts []string
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		parts = append(parts, fmt.Sprintf("%d columns", width))
+	}
+	if color.NoColor {
+		parts = append(parts, "colors off")
+	} else {
+		parts = append(parts, "colors on")
+	}
+	if termName != "" {
+		parts = append(parts, "TERM="+termName)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		parts = append(parts, "stdin is not a terminal, so prompts take their defaults")
+	}
+	return Result{"terminal", Pass, strings.Join(parts, ", ")}
+}
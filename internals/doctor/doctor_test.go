@@ -0,0 +1,176 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/fakellm"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// TestMain runs the checks in a scratch repository with one commit, a shared
+// cache directory and a config pointing at the fake LLM server.
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "revly-doctor-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(fakellm.New(fakellm.Options{}))
+	defer srv.Close()
+
+	root := filepath.Join(dir, "repo")
+	for _, args := range [][]string{
+		{"init", "-q", root},
+		{"-C", root, "-c", "user.name=revly", "-c", "user.email=revly@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "git %s: %v\n%s", args[0], err, out)
+			return 1
+		}
+	}
+	shared := filepath.Join(dir, "shared")
+	if err := os.Mkdir(shared, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cfg := fmt.Sprintf(`version = 1
+
+[llm]
+provider = "openai-compatible"
+base_url = %q
+models = ["fake-model"]
+
+[cache.remote]
+type = "dir"
+path = %q
+`, srv.URL+"/v1", shared)
+	if err := os.WriteFile(filepath.Join(root, repo.ConfigName), []byte(cfg), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "REVLY_") || strings.HasSuffix(name, "_API_KEY") || name == "OPENROUTER_KEY" {
+			os.Unsetenv(name)
+		}
+	}
+	os.Setenv("HOME", filepath.Join(dir, "home"))
+	os.Setenv("LLM_API_KEY", "test-key")
+	if err := os.Chdir(root); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return m.Run()
+}
+
+func TestRun(t *testing.T) {
+	results := Run(context.Background(), Options{Network: true})
+	if Failed(results) {
+		t.Errorf("a check failed: %+v", results)
+	}
+	got := map[string]Result{}
+	for _, r := range results {
+		got[r.Check] = r
+	}
+	tests := []struct {
+		check  string
+		status Status
+		detail string
+	}{
+		{"repository", Pass, ", on "},
+		{"config", Pass, "valid"},
+		{"api key", Pass, "found in env:LLM_API_KEY"},
+		{"endpoint", Pass, "reachable"},
+		{"model fake-model", Pass, "answered in"},
+		{"cache", Pass, "0 entries"},
+		{"shared cache", Pass, "(read-write)"},
+	}
+	for _, tt := range tests {
+		r, ok := got[tt.check]
+		if !ok {
+			t.Errorf("no %s check in %+v", tt.check, results)
+			continue
+		}
+		if r.Status != tt.status || !strings.Contains(r.Detail, tt.detail) {
+			t.Errorf("%s = %s %q, want %s and %q", tt.check, r.Status, r.Detail, tt.status, tt.detail)
+		}
+	}
+
+	offline := Run(context.Background(), Options{})
+	for _, r := range offline {
+		if r.Check == "endpoint" || strings.HasPrefix(r.Check, "model ") {
+			t.Errorf("Run without Network ran the %s check", r.Check)
+		}
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	t.Setenv("LLM_API_KEY", "")
+	t.Setenv("OPENAI_API_KEY", "sk-elsewhere")
+
+	if r := checkKey(config.LLMConfig{Provider: "ollama"}); r.Status != Pass || !strings.Contains(r.Detail, "doesn't need one") {
+		t.Errorf("ollama: %+v", r)
+	}
+	r := checkKey(config.LLMConfig{Provider: "anthropic"})
+	if r.Status != Fail || !strings.Contains(r.Detail, `llm.key_env = "OPENAI_API_KEY"`) {
+		t.Errorf("a key under another provider's variable: %+v, want a hint to use it", r)
+	}
+	if r := checkKey(config.LLMConfig{Provider: "anthropic", KeyEnv: "OPENAI_API_KEY"}); r.Status != Pass {
+		t.Errorf("with key_env: %+v", r)
+	}
+}
+
+func TestCheckCache(t *testing.T) {
+	dir := filepath.Join(repo.State("cache"), "review")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := filepath.Join(dir, "0123abcd")
+	if err := os.WriteFile(corrupt, []byte("not an entry"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(corrupt)
+
+	results := checkCache(config.RevlyConfig{})
+	if len(results) != 1 || results[0].Status != Warn || !strings.Contains(results[0].Detail, "1 corrupt") {
+		t.Errorf("checkCache = %+v, want a warning about the corrupt entry", results)
+	}
+
+	r := checkRemote(config.CacheRemoteConfig{Type: "dir", Path: filepath.Join(t.TempDir(), "missing")})
+	if r.Status != Fail {
+		t.Errorf("a missing shared directory: %+v", r)
+	}
+}
+
+func TestWritable(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "a", "b")
+	if err := writable(nested); err != nil {
+		t.Errorf("writable(%s): %v", nested, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Error("writable created the directory it checked")
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writable(filepath.Join(file, "cache")); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("writable under a file: err = %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+// Package fakellm is a local OpenAI-compatible chat completions server for
+// exercising revly without a real provider. Replies come from a script of
+// rules, or from canned answers that fit each of revly's prompts.
+package fakellm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Rule is one scripted reply. A request matches when every field that is
+// set matches; the first matching rule with uses left answers.
+type Rule struct {
+	// Model is a glob matched against the requested model.
+	Model string `toml:"model"`
+	// Match is a substring of the request's messages, system prompt included.
+	Match string `toml:"match"`
+
+	// Content is the reply, or File names a file holding it.
+	Content string `toml:"content"`
+	File    string `toml:"file"`
+
+	// Tool, when the request offers tools, answers with a call to it with
+	// Arguments (a JSON object) instead of Content.
+	Tool      string `toml:"tool"`
+	Arguments string `toml:"arguments"`
+
+	// Status, when not 2xx, answers with an error payload instead.
+	Status     int           `toml:"status"`
+	RetryAfter time.Duration `toml:"retry_after"`
+
+	// Latency is added before answering, on top of the server's latency.
+	Latency time.Duration `toml:"latency"`
+	// Times limits how many requests the rule answers; 0 is unlimited.
+	Times int `toml:"times"`
+}
+
+// Script is the file format for --script.
+type Script struct {
+	Rules []Rule `toml:"rule"`
+}
+
+// LoadScript reads a TOML script.
+func LoadScript(file string) (Script, error) {
+	var s Script
+	if _, err := toml.DecodeFile(file, &s); err != nil {
+		return s, fmt.Errorf("reading script %s: %w", file, err)
+	}
+	for i, r := range s.Rules {
+		if r.File == "" {
+			continue
+		}
+		data, err := os.ReadFile(r.File)
+		if err != nil {
+			return s, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		s.Rules[i].Content = string(data)
+	}
+	return s, nil
+}
+
+// Options configure a Server.
+type Options struct {
+	Script Script
+	// Latency delays every response; ChunkDelay paces streamed chunks.
+	Latency    time.Duration
+	ChunkDelay time.Duration
+	// ErrorRate is the fraction of requests answered with ErrorStatus.
+	ErrorRate   float64
+	ErrorStatus int
+	// Seed makes error injection repeatable.
+	Seed int64
+	// Log, if set, receives one line per request.
+	Log func(format string, args ...any)
+}
+
+// Server is an http.Handler serving /chat/completions and /models under
+// both / and /v1/.
+type Server struct {
+	opts Options
+
+	mu    sync.Mutex
+	used  []int
+	rng   *rand.Rand
+	calls int
+}
+
+func New(opts Options) *Server {
+	if opts.ErrorStatus == 0 {
+		opts.ErrorStatus = http.StatusServiceUnavailable
+	}
+	return &Server{
+		opts: opts,
+		used: make([]int, len(opts.Script.Rules)),
+		rng:  rand.New(rand.NewSource(opts.Seed)),
+	}
+}
+
+type chatRequest struct {
+	Model    string            `json:"model"`
+	Stream   bool              `json:"stream"`
+	Tools    []json.RawMessage `json:"tools"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/v1")
+	switch {
+	case p == "/models" && r.Method == http.MethodGet:
+		s.models(w)
+	case p == "/chat/completions" && r.Method == http.MethodPost:
+		s.chat(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found: "+r.Method+" "+r.URL.Path, 0)
+	}
+}
+
+func (s *Server) models(w http.ResponseWriter) {
+	seen := map[string]bool{}
+	data := []map[string]string{{"id": "fake"}}
+	for _, r := range s.opts.Script.Rules {
+		if r.Model != "" && !strings.ContainsAny(r.Model, "*?[") && !seen[r.Model] {
+			seen[r.Model] = true
+			data = append(data, map[string]string{"id": r.Model})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+}
+
+func (s *Server) chat(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error(), 0)
+		return
+	}
+	var prompt strings.Builder
+	for _, m := range req.Messages {
+		prompt.WriteString(m.Content)
+		prompt.WriteString("\n")
+	}
+
+	rule, injected := s.pick(req.Model, prompt.String(), len(req.Tools) > 0)
+	s.logf("%s model=%s stream=%t rule=%s", r.URL.Path, req.Model, req.Stream, describe(rule, injected))
+
+	delay := s.opts.Latency
+	if rule != nil {
+		delay += rule.Latency
+	}
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	switch {
+	case injected:
+		writeError(w, s.opts.ErrorStatus, "injected error", time.Second)
+		return
+	case rule != nil && rule.Status != 0 && (rule.Status < 200 || rule.Status > 299):
+		writeError(w, rule.Status, fmt.Sprintf("scripted %d response", rule.Status), rule.RetryAfter)
+		return
+	}
+
+	content := cannedReply(prompt.String())
+	if rule != nil {
+		content = rule.Content
+	}
+	usage := map[string]int{
+		"prompt_tokens":     len(prompt.String())/4 + 1,
+		"completion_tokens": len(content)/4 + 1,
+	}
+
+	if rule != nil && rule.Tool != "" {
+		s.toolCall(w, req, rule, usage)
+		return
+	}
+
+	if !req.Stream {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"id":      "fake-completion",
+			"object":  "chat.completion",
+			"model":   req.Model,
+			"choices": []any{map[string]any{"index": 0, "message": map[string]string{"role": "assistant", "content": content}, "finish_reason": "stop"}},
+			"usage":   usage,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for _, piece := range chunks(content) {
+		send(map[string]any{"model": req.Model, "choices": []any{map[string]any{"index": 0, "delta": map[string]string{"content": piece}}}})
+		select {
+		case <-time.After(s.opts.ChunkDelay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	send(map[string]any{"model": req.Model, "choices": []any{}, "usage": usage})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// toolCall answers with a call to rule.Tool, streamed or not.
+func (s *Server) toolCall(w http.ResponseWriter, req chatRequest, rule *Rule, usage map[string]int) {
+	args := rule.Arguments
+	if args == "" {
+		args = "{}"
+	}
+	s.mu.Lock()
+	s.calls++
+	id := fmt.Sprintf("call_fake_%d", s.calls)
+	s.mu.Unlock()
+	call := map[string]any{"id": id, "type": "function", "function": map[string]string{"name": rule.Tool, "arguments": args}}
+
+	if !req.Stream {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"id":      "fake-completion",
+			"object":  "chat.completion",
+			"model":   req.Model,
+			"choices": []any{map[string]any{"index": 0, "message": map[string]any{"role": "assistant", "content": nil, "tool_calls": []any{call}}, "finish_reason": "tool_calls"}},
+			"usage":   usage,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	call["index"] = 0
+	data, _ := json.Marshal(map[string]any{"model": req.Model, "choices": []any{map[string]any{"index": 0, "delta": map[string]any{"tool_calls": []any{call}}, "finish_reason": "tool_calls"}}})
+	fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", data)
+}
+
+// pick chooses the rule for a request and whether to inject an error. Tool
+// rules only answer requests that offer tools.
+func (s *Server) pick(model, prompt string, tools bool) (*Rule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.opts.ErrorRate > 0 && s.rng.Float64() < s.opts.ErrorRate {
+		return nil, true
+	}
+	for i := range s.opts.Script.Rules {
+		r := &s.opts.Script.Rules[i]
+		if r.Times > 0 && s.used[i] >= r.Times {
+			continue
+		}
+		if r.Tool != "" && !tools {
+			continue
+		}
+		if r.Model != "" {
+			if ok, _ := path.Match(r.Model, model); !ok {
+				continue
+			}
+		}
+		if r.Match != "" && !strings.Contains(prompt, r.Match) {
+			continue
+		}
+		s.used[i]++
+		return r, false
+	}
+	return nil, false
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.opts.Log != nil {
+		s.opts.Log(format, args...)
+	}
+}
+
+func describe(r *Rule, injected bool) string {
+	switch {
+	case injected:
+		return "injected-error"
+	case r == nil:
+		return "canned"
+	case r.Tool != "":
+		return "tool:" + r.Tool
+	case r.Match != "":
+		return strconv.Quote(r.Match)
+	case r.Model != "":
+		return r.Model
+	}
+	return "catch-all"
+}
+
+// cannedReply answers in the shape each of revly's prompts asks for, so the
+// commands work against the server with no script at all.
+func cannedReply(prompt string) string {
+	switch {
+	case strings.Contains(prompt, `"findings"`):
+		return `{"summary": "Reviewed by the fake LLM server.", "findings": []}`
+	case strings.Contains(prompt, "commit message"):
+		return "chore: update files"
+	default:
+		return "Looks good, keep going."
+	}
+}
+
+// chunks splits s into word-sized pieces for streaming.
+func chunks(s string) []string {
+	var out []string
+	start := 0
+	for i := 1; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\n' {
+			out = append(out, s[start:i])
+			start = i
+		}
+	}
+	return append(out, s[start:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string, retryAfter time.Duration) {
+	if status == http.StatusTooManyRequests && retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second)/time.Second)))
+	}
+	writeJSON(w, status, map[string]any{"error": map[string]any{"message": message, "code": status}})
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"os"
 	"os/exec"
+
+	"github.com/nareshkarthigeyan/revly/internals/repo"
 )
 
 func GetGitDiff() (string, error) {
@@ -24,18 +26,23 @@ func GetWorkingDiff() ([]byte, error) {
 	return exec.Command("git", "diff").Output()
 }
 
+// CreateSnapshot copies the working tree to path. Like DiffSnapshots, it
+// takes paths relative to the repository root, whatever the working
+// directory.
 func CreateSnapshot(path string) error {
 	// Create the directory if it doesn't exist
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		os.MkdirAll(path, 0755)
+	if _, err := os.Stat(repo.Resolve(path)); os.IsNotExist(err) {
+		os.MkdirAll(repo.Resolve(path), 0755)
 	}
 	// Use rsync to copy the files
-	cmd := exec.Command("rsync", "-a", "--exclude", ".git", "--exclude", ".revly", ".", path)
+	cmd := exec.Command("rsync", "-a", "--exclude", ".git", "--exclude", repo.StateName, ".", path)
+	cmd.Dir = repo.Root()
 	return cmd.Run()
 }
 
 func DiffSnapshots(path1, path2 string) ([]byte, error) {
 	cmd := exec.Command("git", "diff", "--no-index", path1, path2)
+	cmd.Dir = repo.Root()
 	output, err := cmd.Output()
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
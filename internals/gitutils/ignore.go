@@ -0,0 +1,182 @@
+package gitutils
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile lists files revly keeps from the model, in .gitignore syntax,
+// at the repository root.
+const IgnoreFile = ".revlyignore"
+
+// Matcher matches paths against patterns in .gitignore syntax: later
+// patterns override earlier ones, "!" re-includes, a trailing "/" only
+// matches directories, a "/" anywhere but the end anchors the pattern to the
+// root, and "**" spans directories. A file inside a matched directory
+// matches too.
+type Matcher struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewMatcher compiles patterns, one per element. Blank patterns and
+// comments are skipped.
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{}
+	for _, p := range patterns {
+		if r, ok := compileIgnore(p); ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return m
+}
+
+// LoadIgnoreFile reads a .gitignore-style file. A missing file matches
+// nothing.
+func LoadIgnoreFile(path string) (*Matcher, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Matcher{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewMatcher(strings.Split(string(data), "\n")), nil
+}
+
+// Empty reports whether m has no patterns.
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.rules) == 0
+}
+
+// Match reports whether path, relative to the root and using "/", is
+// matched by the patterns itself or through one of its parent directories.
+func (m *Matcher) Match(path string) bool {
+	return m.matchPath(path, false)
+}
+
+// MatchDir is Match for a directory, which patterns ending in "/" match too.
+func (m *Matcher) MatchDir(path string) bool {
+	return m.matchPath(path, true)
+}
+
+func (m *Matcher) matchPath(path string, isDir bool) bool {
+	if m.Empty() {
+		return false
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(strings.Join(parts, "/"), isDir)
+}
+
+func (m *Matcher) match(path string, isDir bool) bool {
+	matched := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(path) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+func compileIgnore(pattern string) (ignoreRule, bool) {
+	p := strings.TrimRight(pattern, " \t\r")
+	if p == "" || strings.HasPrefix(p, "#") {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	if strings.HasPrefix(p, "!") {
+		r.negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return ignoreRule{}, false
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "/**") && i+3 == len(p):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(p):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(p[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// FilterDiff drops the files keep rejects from a diff, returning what is
+// left and the paths of the dropped files.
+func FilterDiff(diff string, keep func(path string) bool) (string, []string) {
+	preamble, files := ParseDiff(diff)
+	var b strings.Builder
+	b.WriteString(preamble)
+	var skipped []string
+	for _, f := range files {
+		if keep(f.Path) {
+			b.WriteString(f.String())
+		} else {
+			skipped = append(skipped, f.Path)
+		}
+	}
+	return b.String(), skipped
+}
@@ -0,0 +1,90 @@
+package gitutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{"no patterns", nil, "main.go", false},
+		{"comments and blanks", []string{"# go.sum", "", "   "}, "go.sum", false},
+		{"basename anywhere", []string{"go.sum"}, "tools/go.sum", true},
+		{"glob", []string{"*.lock"}, "web/yarn.lock", true},
+		{"glob stays in one segment", []string{"*.go"}, "main.go.orig", false},
+		{"anchored", []string{"/vendor"}, "vendor/a.go", true},
+		{"anchored not nested", []string{"/vendor"}, "lib/vendor/a.go", false},
+		{"slash in middle anchors", []string{"docs/*.md"}, "docs/a.md", true},
+		{"slash in middle anchors, nested", []string{"docs/*.md"}, "site/docs/a.md", false},
+		{"dir only matches dirs", []string{"build/"}, "build", false},
+		{"dir only matches files inside", []string{"build/"}, "build/out.js", true},
+		{"double star prefix", []string{"**/testdata"}, "a/b/testdata/x.json", true},
+		{"double star suffix", []string{"gen/**"}, "gen/a/b.go", true},
+		{"double star middle", []string{"a/**/b.go"}, "a/x/y/b.go", true},
+		{"double star middle, zero dirs", []string{"a/**/b.go"}, "a/b.go", true},
+		{"question mark", []string{"file?.txt"}, "file1.txt", true},
+		{"class", []string{"file[0-9].txt"}, "filex.txt", false},
+		{"negated class", []string{"file[!0-9].txt"}, "filex.txt", true},
+		{"negation re-includes", []string{"*.pb.go", "!keep.pb.go"}, "keep.pb.go", false},
+		{"later pattern wins", []string{"!keep.pb.go", "*.pb.go"}, "keep.pb.go", true},
+		{"escaped bang", []string{`\!important`}, "!important", true},
+		{"escaped hash", []string{`\#notes`}, "#notes", true},
+		{"trailing spaces ignored", []string{"go.sum   "}, "go.sum", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewMatcher(tt.patterns).Match(tt.path); got != tt.want {
+				t.Errorf("NewMatcher(%q).Match(%q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDir(t *testing.T) {
+	m := NewMatcher([]string{"build/", "/gen", "*.tmp"})
+	for path, want := range map[string]bool{
+		"build":     true,
+		"web/build": true,
+		"gen":       true,
+		"web/gen":   false,
+		"src":       false,
+		"cache.tmp": true,
+	} {
+		if got := m.MatchDir(path); got != want {
+			t.Errorf("MatchDir(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestLoadIgnoreFileMissing(t *testing.T) {
+	m, err := LoadIgnoreFile(t.TempDir() + "/.revlyignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Empty() || m.Match("anything") {
+		t.Errorf("a missing ignore file should match nothing")
+	}
+}
+
+func TestFilterDiff(t *testing.T) {
+	diff := "commit abc\n\n" +
+		"diff --git a/go.sum b/go.sum\n--- a/go.sum\n+++ b/go.sum\n@@ -1 +1 @@\n-a\n+b\n" +
+		"diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-x\n+y\n"
+	m := NewMatcher([]string{"go.sum"})
+
+	kept, skipped := FilterDiff(diff, func(path string) bool { return !m.Match(path) })
+
+	want := "commit abc\n\n" +
+		"diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-x\n+y\n"
+	if kept != want {
+		t.Errorf("kept =\n%s\nwant\n%s", kept, want)
+	}
+	if !reflect.DeepEqual(skipped, []string{"go.sum"}) {
+		t.Errorf("skipped = %q, want [go.sum]", skipped)
+	}
+}
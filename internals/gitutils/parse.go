@@ -0,0 +1,118 @@
+package gitutils
+
+import "strings"
+
+// FileDiff is one file's section of a unified diff.
+type FileDiff struct {
+	// Path is the file's new path, or its old path if it was deleted.
+	Path string
+	// Header runs from the "diff --git" line up to the first hunk.
+	Header string
+	// Hunks each start at their "@@" line.
+	Hunks []string
+}
+
+// String reassembles the file's section of the diff.
+func (f FileDiff) String() string {
+	return f.Header + strings.Join(f.Hunks, "")
+}
+
+// ParseDiff splits git diff or git show output into per-file sections.
+// Anything before the first file (the commit header printed by git show)
+// is returned as the preamble. Combined diffs of merge commits are handled
+// too. Joining the preamble and every file's String gives back the input.
+func ParseDiff(diff string) (preamble string, files []FileDiff) {
+	var pre strings.Builder
+	var cur *FileDiff
+	var hunk strings.Builder
+
+	endHunk := func() {
+		if cur != nil && hunk.Len() > 0 {
+			cur.Hunks = append(cur.Hunks, hunk.String())
+			hunk.Reset()
+		}
+	}
+	endFile := func() {
+		endHunk()
+		if cur != nil {
+			files = append(files, *cur)
+			cur = nil
+		}
+	}
+
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case isFileHeader(line):
+			endFile()
+			cur = &FileDiff{Header: line, Path: pathFromDiffLine(line)}
+		case cur == nil:
+			pre.WriteString(line)
+		case strings.HasPrefix(line, "@@"):
+			endHunk()
+			hunk.WriteString(line)
+		case hunk.Len() > 0:
+			hunk.WriteString(line)
+		default:
+			cur.Header += line
+			if p, ok := pathFromFileLine(line); ok {
+				cur.Path = p
+			}
+		}
+	}
+	endFile()
+
+	return pre.String(), files
+}
+
+func isFileHeader(line string) bool {
+	return strings.HasPrefix(line, "diff --git ") ||
+		strings.HasPrefix(line, "diff --cc ") ||
+		strings.HasPrefix(line, "diff --combined ")
+}
+
+// pathFromDiffLine is a first guess at the path, used until the ---/+++
+// lines (absent for binary files and pure renames) give a reliable one.
+func pathFromDiffLine(line string) string {
+	line = strings.TrimRight(line, "\n")
+	for _, prefix := range []string{"diff --cc ", "diff --combined "} {
+		if strings.HasPrefix(line, prefix) {
+			return unquote(strings.TrimPrefix(line, prefix))
+		}
+	}
+	rest := strings.TrimPrefix(line, "diff --git ")
+	if i := strings.LastIndex(rest, " b/"); i >= 0 {
+		return unquote(rest[i+3:])
+	}
+	return unquote(rest)
+}
+
+// pathFromFileLine reads the path from "+++ b/x", or from "--- a/x" when the
+// file was deleted and the +++ side is /dev/null.
+func pathFromFileLine(line string) (string, bool) {
+	line = strings.TrimRight(line, "\n")
+	var p string
+	switch {
+	case strings.HasPrefix(line, "+++ "):
+		p = strings.TrimPrefix(line, "+++ ")
+	case strings.HasPrefix(line, "rename to "):
+		return unquote(strings.TrimPrefix(line, "rename to ")), true
+	default:
+		return "", false
+	}
+	p = unquote(p)
+	if p == "/dev/null" {
+		return "", false
+	}
+	if strings.HasPrefix(p, "b/") {
+		p = p[2:]
+	}
+	return p, true
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Trim(s, `"`)
+}
@@ -0,0 +1,116 @@
+package gitutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		diff      string
+		preamble  string
+		paths     []string
+		hunkCount []int
+	}{
+		{
+			name:  "empty",
+			diff:  "",
+			paths: nil,
+		},
+		{
+			name: "modified file",
+			diff: "diff --git a/main.go b/main.go\nindex 1..2 100644\n--- a/main.go\n+++ b/main.go\n" +
+				"@@ -1,2 +1,2 @@\n-a\n+b\n c\n@@ -10 +10 @@\n-d\n+e\n",
+			paths:     []string{"main.go"},
+			hunkCount: []int{2},
+		},
+		{
+			name: "git show preamble",
+			diff: "commit 0123\nAuthor: A <a@b>\n\n    Fix it\n\n" +
+				"diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n",
+			preamble:  "commit 0123\nAuthor: A <a@b>\n\n    Fix it\n\n",
+			paths:     []string{"a.go"},
+			hunkCount: []int{1},
+		},
+		{
+			name: "several files",
+			diff: "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n" +
+				"diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1 +1 @@\n-a\n+b\n",
+			paths:     []string{"a.go", "b.go"},
+			hunkCount: []int{1, 1},
+		},
+		{
+			name:      "deleted file keeps its old path",
+			diff:      "diff --git a/old.go b/old.go\ndeleted file mode 100644\n--- a/old.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+			paths:     []string{"old.go"},
+			hunkCount: []int{1},
+		},
+		{
+			name:      "new file",
+			diff:      "diff --git a/new.go b/new.go\nnew file mode 100644\n--- /dev/null\n+++ b/new.go\n@@ -0,0 +1 @@\n+a\n",
+			paths:     []string{"new.go"},
+			hunkCount: []int{1},
+		},
+		{
+			name:      "pure rename",
+			diff:      "diff --git a/old name.go b/new name.go\nsimilarity index 100%\nrename from old name.go\nrename to new name.go\n",
+			paths:     []string{"new name.go"},
+			hunkCount: []int{0},
+		},
+		{
+			name:      "binary file",
+			diff:      "diff --git a/logo.png b/logo.png\nindex 1..2 100644\nBinary files a/logo.png and b/logo.png differ\n",
+			paths:     []string{"logo.png"},
+			hunkCount: []int{0},
+		},
+		{
+			name:      "quoted path",
+			diff:      "diff --git \"a/sp ace.go\" \"b/sp ace.go\"\n--- \"a/sp ace.go\"\n+++ \"b/sp ace.go\"\n@@ -1 +1 @@\n-a\n+b\n",
+			paths:     []string{"sp ace.go"},
+			hunkCount: []int{1},
+		},
+		{
+			name:      "combined diff of a merge",
+			diff:      "diff --cc conflict.go\nindex 1,2..3\n--- a/conflict.go\n+++ b/conflict.go\n@@@ -1,1 -1,1 +1,1 @@@\n- a\n -b\n++c\n",
+			paths:     []string{"conflict.go"},
+			hunkCount: []int{1},
+		},
+		{
+			name:      "no trailing newline",
+			diff:      "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b",
+			paths:     []string{"a.go"},
+			hunkCount: []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preamble, files := ParseDiff(tt.diff)
+			if preamble != tt.preamble {
+				t.Errorf("preamble = %q, want %q", preamble, tt.preamble)
+			}
+			if len(files) != len(tt.paths) {
+				t.Fatalf("got %d files, want %d", len(files), len(tt.paths))
+			}
+			var joined strings.Builder
+			joined.WriteString(preamble)
+			for i, f := range files {
+				if f.Path != tt.paths[i] {
+					t.Errorf("files[%d].Path = %q, want %q", i, f.Path, tt.paths[i])
+				}
+				if len(f.Hunks) != tt.hunkCount[i] {
+					t.Errorf("files[%d] has %d hunks, want %d", i, len(f.Hunks), tt.hunkCount[i])
+				}
+				for _, h := range f.Hunks {
+					if !strings.HasPrefix(h, "@@") {
+						t.Errorf("files[%d] hunk doesn't start at its @@ line: %q", i, h)
+					}
+				}
+				joined.WriteString(f.String())
+			}
+			if joined.String() != tt.diff {
+				t.Errorf("preamble and files don't reassemble the diff:\n%q\nwant\n%q", joined.String(), tt.diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package gitutils
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// RepoName is the name of the directory at the root of the current
+// repository, or of the working directory outside a repository.
+func RepoName() string {
+	return filepath.Base(repo.Root())
+}
+
+// CurrentBranch returns the checked-out branch, or "" when HEAD is detached
+// or this isn't a repository.
+func CurrentBranch() string {
+	out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	branch := strings.TrimSpace(string(out))
+	if err != nil || branch == "HEAD" {
+		return ""
+	}
+	return branch
+}
+
+// TrackedFiles lists the files git tracks in the current repository,
+// relative to its root.
+func TrackedFiles() ([]string, error) {
+	cmd := exec.Command("git", "ls-files")
+	cmd.Dir = repo.Root()
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,208 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+const anthropicVersion = "2023-06-01"
+
+// anthropicDefaultMaxTokens is sent because the Messages API requires max_tokens.
+const anthropicDefaultMaxTokens = 4096
+
+// anthropicProvider talks to Anthropic's native Messages API.
+type anthropicProvider struct {
+	x        *executor
+	endpoint string
+	apiKey   string
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	MaxTokens int                `json:"max_tokens"`
+	Stream    bool               `json:"stream,omitempty"`
+
+	Temperature *float64 `json:"temperature,omitempty"`
+}
+
+// anthropicMessage holds either a string, for plain messages, or content
+// blocks, for tool calls and their results.
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+// anthropicBlock is a text, tool_use or tool_result content block.
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	Model   string           `json:"model"`
+	Content []anthropicBlock `json:"content"`
+	Usage   anthropicUsage   `json:"usage"`
+}
+
+// anthropicStreamEvent covers the events we read: message_start carries the
+// input token count, content_block_delta the text, message_delta the output
+// token count.
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newAnthropicProvider(x *executor, base, apiKey string) *anthropicProvider {
+	return &anthropicProvider{x: x, endpoint: base + "/messages", apiKey: apiKey}
+}
+
+func (p *anthropicProvider) Name() string { return "anthropic" }
+
+func (p *anthropicProvider) Complete(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	var out anthropicResponse
+	if err := p.x.postJSON(ctx, p.endpoint, p.headers(), p.body(req, false), &out); err != nil {
+		return ChatResponse{}, err
+	}
+
+	var text strings.Builder
+	var calls []ToolCall
+	for i, block := range out.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			calls = append(calls, ToolCall{ID: toolCallID(block.ID, i), Name: block.Name, Arguments: block.Input})
+		}
+	}
+	if text.Len() == 0 && len(calls) == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	usage := Usage{PromptTokens: out.Usage.InputTokens, CompletionTokens: out.Usage.OutputTokens}
+	return ChatResponse{Model: req.Model, Content: text.String(), ToolCalls: calls, Usage: usage}, nil
+}
+
+func (p *anthropicProvider) Stream(ctx context.Context, req ChatRequest, onChunk func(string)) (ChatResponse, error) {
+	resp, err := p.x.post(ctx, p.endpoint, p.headers(), p.body(req, true))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var usage Usage
+	err = readSSE(resp.Body, func(_, data string) error {
+		var ev anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return malformed("invalid stream event: %v", err)
+		}
+		switch ev.Type {
+		case "message_start":
+			usage.PromptTokens = ev.Message.Usage.InputTokens
+		case "message_delta":
+			usage.CompletionTokens = ev.Usage.OutputTokens
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" {
+				content.WriteString(ev.Delta.Text)
+				onChunk(ev.Delta.Text)
+			}
+		case "error":
+			return streamError(ev.Error.Message, ev.Error.Type)
+		}
+		return nil
+	})
+	if err != nil {
+		return ChatResponse{Model: req.Model, Content: content.String()}, err
+	}
+	if content.Len() == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	return ChatResponse{Model: req.Model, Content: content.String(), Usage: usage}, nil
+}
+
+func (p *anthropicProvider) headers() map[string]string {
+	return map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": anthropicVersion,
+	}
+}
+
+func (p *anthropicProvider) body(req ChatRequest, stream bool) anthropicRequest {
+	body := anthropicRequest{
+		Model:       req.Model,
+		System:      req.System,
+		Messages:    anthropicMessages(req.Messages),
+		MaxTokens:   anthropicDefaultMaxTokens,
+		Stream:      stream,
+		Temperature: req.Temperature,
+	}
+	if req.MaxTokens > 0 {
+		body.MaxTokens = req.MaxTokens
+	}
+	for _, t := range req.Tools {
+		body.Tools = append(body.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+	}
+	return body
+}
+
+// anthropicMessages encodes tool calls as tool_use blocks and their results
+// as tool_result blocks, merging consecutive results into one user turn as
+// the API requires.
+func anthropicMessages(messages []Message) []anthropicMessage {
+	var out []anthropicMessage
+	for _, m := range messages {
+		switch {
+		case m.Role == "tool":
+			result := anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}
+			if n := len(out); n > 0 && out[n-1].Role == "user" {
+				if blocks, ok := out[n-1].Content.([]anthropicBlock); ok {
+					out[n-1].Content = append(blocks, result)
+					continue
+				}
+			}
+			out = append(out, anthropicMessage{Role: "user", Content: []anthropicBlock{result}})
+		case len(m.ToolCalls) > 0:
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, c := range m.ToolCalls {
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: c.ID, Name: c.Name, Input: toolArguments(c.Arguments)})
+			}
+			out = append(out, anthropicMessage{Role: m.Role, Content: blocks})
+		default:
+			out = append(out, anthropicMessage{Role: m.Role, Content: m.Content})
+		}
+	}
+	return out
+}
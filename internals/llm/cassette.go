@@ -0,0 +1,249 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cassettes let the review, commit and pair commands run without a network:
+// with REVLY_CASSETTE set, every provider request is answered from (or, in
+// record mode, saved to) that file.
+//
+//	REVLY_CASSETTE=testdata/review.json REVLY_CASSETTE_MODE=record revly review
+//	REVLY_CASSETTE=testdata/review.json revly review
+const (
+	cassetteEnv     = "REVLY_CASSETTE"
+	cassetteModeEnv = "REVLY_CASSETTE_MODE"
+)
+
+// errNoRecording is returned in replay mode for a request the cassette
+// doesn't have. It is not retried.
+var errNoRecording = errors.New("no recorded response for this request in the cassette")
+
+// recordedHeaders are the response headers worth keeping; the rest are
+// timestamps and tracing noise.
+var recordedHeaders = []string{"Content-Type", "Retry-After", "Retry-After-Ms"}
+
+type cassetteFile struct {
+	Interactions []interaction `json:"interactions"`
+}
+
+// interaction is one request and the response it got. Request headers are
+// never stored, so API keys don't end up in fixtures.
+type interaction struct {
+	Request struct {
+		Method string          `json:"method"`
+		URL    string          `json:"url"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"request"`
+	Response struct {
+		Status  int               `json:"status"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Body    string            `json:"body"`
+	} `json:"response"`
+}
+
+// cassette is an http.RoundTripper that records or replays interactions.
+// Requests are matched on method, URL and body; when the same request was
+// recorded several times the responses are replayed in order, repeating the
+// last one.
+type cassette struct {
+	path   string
+	record bool
+	next   http.RoundTripper
+
+	mu     sync.Mutex
+	file   cassetteFile
+	byKey  map[string][]int
+	served map[string]int
+}
+
+var (
+	cassetteOnce sync.Once
+	cassetteRT   *cassette
+	cassetteErr  error
+)
+
+// cassetteTransport returns the transport configured by REVLY_CASSETTE, or
+// nil to use the default one. It is shared by every request in the process.
+func cassetteTransport() (http.RoundTripper, error) {
+	cassetteOnce.Do(func() {
+		path := os.Getenv(cassetteEnv)
+		if path == "" {
+			return
+		}
+		mode := os.Getenv(cassetteModeEnv)
+		switch mode {
+		case "", "replay", "record":
+		default:
+			cassetteErr = fmt.Errorf("%s must be record or replay, not %q", cassetteModeEnv, mode)
+			return
+		}
+		cassetteRT, cassetteErr = loadCassette(path, mode == "record")
+	})
+	if cassetteRT == nil {
+		return nil, cassetteErr
+	}
+	return cassetteRT, cassetteErr
+}
+
+// loadCassette reads path. In record mode a missing file starts an empty
+// cassette and new interactions are appended to the existing ones.
+func loadCassette(path string, record bool) (*cassette, error) {
+	c := &cassette{path: path, record: record, next: http.DefaultTransport, served: map[string]int{}}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &c.file); err != nil {
+			return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist) && record:
+	default:
+		return nil, fmt.Errorf("reading cassette: %w", err)
+	}
+
+	c.byKey = map[string][]int{}
+	for i, in := range c.file.Interactions {
+		key := interactionKey(in.Request.Method, in.Request.URL, in.Request.Body)
+		c.byKey[key] = append(c.byKey[key], i)
+	}
+	return c, nil
+}
+
+func (c *cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	key := interactionKey(req.Method, req.URL.String(), body)
+
+	if !c.record {
+		return c.replay(req, key)
+	}
+
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// The whole response is read up front so it can be saved; a recorded
+	// stream arrives all at once.
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	var in interaction
+	in.Request.Method = req.Method
+	in.Request.URL = req.URL.String()
+	in.Request.Body = rawJSON(body)
+	in.Response.Status = resp.StatusCode
+	in.Response.Body = string(respBody)
+	for _, h := range recordedHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			if in.Response.Headers == nil {
+				in.Response.Headers = map[string]string{}
+			}
+			in.Response.Headers[h] = v
+		}
+	}
+
+	if err := c.append(key, in); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *cassette) replay(req *http.Request, key string) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	indexes := c.byKey[key]
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("%w (record it with %s=record)", errNoRecording, cassetteModeEnv)
+	}
+	n := c.served[key]
+	if n >= len(indexes) {
+		n = len(indexes) - 1
+	}
+	c.served[key]++
+
+	in := c.file.Interactions[indexes[n]]
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+		StatusCode:    in.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader([]byte(in.Response.Body))),
+		ContentLength: int64(len(in.Response.Body)),
+		Request:       req,
+	}
+	for k, v := range in.Response.Headers {
+		resp.Header.Set(k, v)
+	}
+	return resp, nil
+}
+
+// append adds an interaction and rewrites the cassette, so a recording
+// survives the command being interrupted.
+func (c *cassette) append(key string, in interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.file.Interactions = append(c.file.Interactions, in)
+	c.byKey[key] = append(c.byKey[key], len(c.file.Interactions)-1)
+
+	data, err := json.MarshalIndent(c.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("writing cassette: %w", err)
+		}
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("writing cassette: %w", err)
+	}
+	return nil
+}
+
+// interactionKey identifies a request. JSON bodies are compacted first so a
+// hand-edited cassette still matches.
+func interactionKey(method, url string, body []byte) string {
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		body = compact.Bytes()
+	}
+	sum := sha256.Sum256(body)
+	return method + " " + url + " " + hex.EncodeToString(sum[:])
+}
+
+// rawJSON keeps body as structured JSON in the cassette when it is JSON.
+func rawJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
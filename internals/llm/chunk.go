@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"strings"
+
+	"github.com/nareshkarthigeyan/revly/internals/gitutils"
+)
+
+// splitDiff cuts diff into pieces that each fit in budget tokens. Whole files
+// are packed together where possible; a file that is too big on its own is
+// split between hunks, and a hunk that is too big is split between lines.
+// Every piece of a split file repeats the file header so the model knows
+// where it is. The git show preamble (commit message) is kept, trimmed, at
+// the top of every chunk.
+func splitDiff(diff string, budget int, count func(string) int) []string {
+	preamble, files := gitutils.ParseDiff(diff)
+	if preamble != "" {
+		preamble = truncateToTokens(preamble, budget/8, count)
+	}
+	budget -= count(preamble)
+
+	var chunks []string
+	var cur strings.Builder
+	curTokens := 0
+
+	flush := func() {
+		if cur.Len() > 0 {
+			chunks = append(chunks, preamble+cur.String())
+			cur.Reset()
+			curTokens = 0
+		}
+	}
+	add := func(piece string) {
+		n := count(piece)
+		if curTokens > 0 && curTokens+n > budget {
+			flush()
+		}
+		cur.WriteString(piece)
+		curTokens += n
+	}
+
+	for _, f := range files {
+		if count(f.String()) <= budget {
+			add(f.String())
+			continue
+		}
+		for _, h := range f.Hunks {
+			if count(f.Header+h) <= budget {
+				add(f.Header + h)
+				continue
+			}
+			for _, part := range splitHunk(h, budget-count(f.Header), count) {
+				add(f.Header + part)
+			}
+		}
+		if len(f.Hunks) == 0 {
+			add(truncateToTokens(f.Header, budget, count))
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// splitHunk breaks an oversized hunk into line-aligned parts, each starting
+// with the original @@ line so the line numbers stay meaningful.
+func splitHunk(hunk string, budget int, count func(string) int) []string {
+	lines := strings.SplitAfter(hunk, "\n")
+	header := strings.TrimRight(lines[0], "\n") + " (continued)\n"
+
+	var parts []string
+	var cur strings.Builder
+	cur.WriteString(lines[0])
+	curTokens := count(lines[0])
+
+	for _, line := range lines[1:] {
+		n := count(line)
+		if curTokens+n > budget && curTokens > count(header) {
+			parts = append(parts, cur.String())
+			cur.Reset()
+			cur.WriteString(header)
+			curTokens = count(header)
+		}
+		cur.WriteString(line)
+		curTokens += n
+	}
+	return append(parts, cur.String())
+}
+
+// truncateToTokens cuts s at a line boundary so it fits in budget tokens.
+func truncateToTokens(s string, budget int, count func(string) int) string {
+	if count(s) <= budget {
+		return s
+	}
+	var out strings.Builder
+	used := 0
+	for _, line := range strings.SplitAfter(s, "\n") {
+		n := count(line)
+		if used+n > budget {
+			break
+		}
+		out.WriteString(line)
+		used += n
+	}
+	out.WriteString("[... truncated ...]\n")
+	return out.String()
+}
@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/fakellm"
+)
+
+// countLines stands in for a tokenizer: one token per line.
+func countLines(s string) int {
+	return strings.Count(s, "\n")
+}
+
+func fileDiff(name string, hunks ...int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", name, name, name, name)
+	for i, n := range hunks {
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", i*100+1, n, i*100+1, n)
+		for j := 0; j < n; j++ {
+			fmt.Fprintf(&b, "+%s hunk %d line %d\n", name, i, j)
+		}
+	}
+	return b.String()
+}
+
+func TestSplitDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		diff   string
+		budget int
+		chunks int
+	}{
+		{"fits in one chunk", fileDiff("a.go", 3) + fileDiff("b.go", 3), 100, 1},
+		{"whole files are packed together", fileDiff("a.go", 3) + fileDiff("b.go", 3) + fileDiff("c.go", 3), 16, 2},
+		{"big file split between hunks", fileDiff("a.go", 5, 5, 5), 12, 3},
+		{"big hunk split between lines", fileDiff("a.go", 30), 12, 4},
+		{"preamble is repeated", "commit 1\nAuthor: a\n\n    msg\n\n" + fileDiff("a.go", 4) + fileDiff("b.go", 4), 14, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitDiff(tt.diff, tt.budget, countLines)
+			if len(chunks) != tt.chunks {
+				t.Fatalf("got %d chunks, want %d:\n%s", len(chunks), tt.chunks, strings.Join(chunks, "\n-----\n"))
+			}
+			first, _, _ := strings.Cut(chunks[0], "diff --git ")
+			for i, c := range chunks {
+				if n := countLines(c); n > tt.budget {
+					t.Errorf("chunk %d is %d tokens, over the budget of %d", i, n, tt.budget)
+				}
+				if pre, _, ok := strings.Cut(c, "diff --git "); !ok || pre != first {
+					t.Errorf("chunk %d doesn't start with the shared preamble and a file header:\n%s", i, c)
+				}
+			}
+			// Every added line ends up in exactly one chunk.
+			all := strings.Join(chunks, "")
+			for _, line := range strings.Split(tt.diff, "\n") {
+				if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
+					if n := strings.Count(all, line+"\n"); n != 1 {
+						t.Errorf("%q appears %d times across the chunks", line, n)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSplitDiffContinuedHunksKeepTheirLineNumbers(t *testing.T) {
+	chunks := splitDiff(fileDiff("a.go", 30), 12, countLines)
+	for i, c := range chunks[1:] {
+		if !strings.Contains(c, "@@ -1,30 +1,30 @@ (continued)\n") {
+			t.Errorf("chunk %d doesn't repeat the hunk header:\n%s", i+1, c)
+		}
+	}
+}
+
+func TestSplitDiffTrimsThePreamble(t *testing.T) {
+	preamble := "commit 1\nAuthor: a\n\n    subject\n\n    body\n"
+	chunks := splitDiff(preamble+fileDiff("a.go", 10)+fileDiff("b.go", 10), 32, countLines)
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+	for i, c := range chunks {
+		if !strings.HasPrefix(c, "commit 1\nAuthor: a\n\n    subject\n[... truncated ...]\ndiff --git ") {
+			t.Errorf("chunk %d doesn't start with the preamble cut to an eighth of the budget:\n%s", i, c)
+		}
+	}
+}
+
+func TestTruncateToTokens(t *testing.T) {
+	s := "one\ntwo\nthree\nfour\n"
+	if got := truncateToTokens(s, 10, countLines); got != s {
+		t.Errorf("text within the budget was changed: %q", got)
+	}
+	if got, want := truncateToTokens(s, 2, countLines), "one\ntwo\n[... truncated ...]\n"; got != want {
+		t.Errorf("truncateToTokens = %q, want %q", got, want)
+	}
+}
+
+func TestReviewInChunksKeepsFinishedPartsWhenCancelled(t *testing.T) {
+	srv := httptest.NewServer(fakellm.New(fakellm.Options{Script: fakellm.Script{Rules: []fakellm.Rule{
+		{Match: "This is part 1 of 2", Content: `{"summary": "Part one.", "findings": [` +
+			`{"file": "a.go", "start_line": 1, "end_line": 1, "severity": "warning", "category": "correctness", "message": "Unchecked error."}]}`},
+		{Match: "This is part 2 of 2", Content: `{"summary": "Part two.", "findings": []}`, Latency: time.Minute},
+	}}}))
+	defer srv.Close()
+
+	cfg := config.RevlyConfig{
+		LLM:    config.LLMConfig{Provider: "openai-compatible", BaseURL: srv.URL + "/v1", Models: []string{"fake"}},
+		Review: config.ReviewConfig{Concurrency: 2},
+		Redact: config.RedactConfig{Mode: "off"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := func(msg string) {
+		if strings.Contains(msg, "Reviewed part 1 of 2") {
+			cancel()
+		}
+	}
+	chunks := []string{fileDiff("a.go", 3), fileDiff("b.go", 3)}
+	r, err := reviewInChunks(ctx, cfg, "k", "Review.", chunks, []string{"a.go", "b.go"}, progress, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if r.Summary != "Part one." || len(r.Findings) != 1 || r.Findings[0].Message != "Unchecked error." {
+		t.Errorf("review = %+v, want the part reviewed before the cancellation", r)
+	}
+}
@@ -1,65 +1,33 @@
 package llm
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
-	"github.com/joho/godotenv"
 	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/gitutils"
 )
 
-type OpenRouterRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
+// ReviewDiffWithLLM reviews diff and returns its findings.
+func ReviewDiffWithLLM(ctx context.Context, diff string) (Review, error) {
+	return reviewDiff(ctx, diff, nil)
 }
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// ReviewDiffWithLLMStream is ReviewDiffWithLLM, but onProgress is called with
+// the review so far each time the summary or another finding has streamed in.
+// If the stream is interrupted, whatever was received is returned along with
+// the error.
+func ReviewDiffWithLLMStream(ctx context.Context, diff string, onProgress func(Review)) (Review, error) {
+	return reviewDiff(ctx, diff, onProgress)
 }
 
-type OpenRouterResponse struct {
-	Choices []struct {
-		Message Message `json:"message"`
-	} `json:"choices"`
-}
-
-func ReviewDiffWithLLM(diff string) (string, error) {
-	cfg, err := config.GetConfig()
+func reviewDiff(ctx context.Context, diff string, onProgress func(Review)) (Review, error) {
+	cfg, apiKey, diff, err := reviewSetup(diff)
 	if err != nil {
-		return "", err
-	}
-
-	endpoint := cfg.LLM.Endpoint
-	models := cfg.LLM.Models
-
-	if err := godotenv.Load(); err != nil {
-		log.Println("WARNING: .env file not found, continuing with environment variables.")
-	}
-
-	apiKey := os.Getenv("LLM_API_KEY")
-	if apiKey == "" {
-		red := color.New(color.FgRed).SprintFunc()
-		cyan := color.New(color.FgCyan).SprintFunc()
-
-		fmt.Println(red("	Missing LLM_API_KEY."))
-		fmt.Println("   Add it in an .env file within your current working directory.")
-		fmt.Println("   or, Set it with:", cyan("export LLM_API_KEY=your-api-key"))
-		os.Exit(1)
-	}
-
-	color.Magenta("Diff length: %d bytes\n", len(diff))
-	if len(diff) < 50 {
-		return "", fmt.Errorf("diff too small or empty")
+		return Review{}, err
 	}
 
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
@@ -67,80 +35,74 @@ func ReviewDiffWithLLM(diff string) (string, error) {
 	s.Start()
 	defer s.Stop()
 
-	var lastErr error
-	for _, model := range models {
-		body := OpenRouterRequest{
-			Model: model,
-			Messages: []Message{
-				{Role: "system", Content: `You are Revly, a state-of-the-art AI code review assistant built by Naresh Karthigeyan. 
-					You are acting as a highly experienced senior software engineer with deep expertise in modern software development practices. 
-					Your task is to review Git code diffs with a focus on: Correctness, Performance, Readability, Maintainability, Security. 
-					Provide clear, specific, and actionable feedback. Be friendly and constructive, but don’t hesitate to point out serious issues when necessary. 
-					Speak as if you’re mentoring a peer, not criticizing a junior. 
-					Use markdown formatting for code snippets and lists. Have a clean, readable formatting.
-					Start the message by giving a kind greeting and a huge summary about the diff changes first -  not more than 150 words.
-					Format each issue as:
-					'
-					[SEVERITY] File Name: Line <line number>:
-					<brief summary>
-					Suggestion:
-					<actionable recommendation>
-					Explanation:
-					<concise reasoning or tradeoff>
-					'
-					Use one of the following severity levels: 
-					Label each finding with a tag: [CRITICAL], [WARNING], or [INFO]. These should appear at the beginning of each issue.
-					[CRITICAL]: Functional bugs, security issues, or performance bottlenecks that must be fixed.
-					[WARNING]: Bad practices, readability or maintainability concerns that should be addressed.
-					[INFO]: Optional improvements, style suggestions, or minor clarity enhancements.
-					Don’t suggest changes that are already present in the diff.
-					Don’t hallucinate context beyond what’s in the diff.
-					If context is missing, point that out explicitly. You are not a general assistant. Only review the code. Do not explain what you are or engage in meta-discussion.
-					End the review with a positive, concise summary if appropriate. Add a suggestions: section where you either give suggestions to improve / remove / add new features. Your goal is to help developers ship better code, faster, with confidence.`},
-				{Role: "user", Content: fmt.Sprintf("Please review this Git diff:\n\n%s", diff)},
-			},
-			Stream: false,
-		}
-
-		jsonBody, err := json.Marshal(body)
-		if err != nil {
-			lastErr = err
-			continue
+	if onProgress != nil {
+		next := onProgress
+		onProgress = func(r Review) {
+			s.Stop()
+			next(r)
 		}
+	}
+	progress := func(msg string) {
+		s.Lock()
+		s.Suffix = msg
+		s.Unlock()
+	}
 
-		req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonBody))
-		if err != nil {
-			lastErr = err
-			continue
-		}
+	ctx, cancel := withTimeout(ctx, cfg, "review")
+	defer cancel()
 
-		req.Header.Set("Authorization", "Bearer "+apiKey)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("OpenRouter-Referer", "https://github.com/nareshkarthigeyan/revly")
+	return reviewWith(ctx, cfg, apiKey, diff, progress, onProgress)
+}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-		defer resp.Body.Close()
+// reviewSetup loads what every review needs, redacts secrets from the diff
+// and rejects diffs too small to be worth sending.
+func reviewSetup(diff string) (config.RevlyConfig, string, string, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return cfg, "", "", err
+	}
 
-		bodyBytes, _ := io.ReadAll(resp.Body)
+	apiKey, err := resolveKey(cfg.LLM)
+	if err != nil {
+		return cfg, "", "", err
+	}
 
-		var result OpenRouterResponse
-		if err := json.Unmarshal(bodyBytes, &result); err != nil {
-			lastErr = err
-			continue
-		}
+	color.Magenta("Diff length: %d bytes\n", len(diff))
+	if len(diff) < 50 {
+		return cfg, "", "", fmt.Errorf("diff too small or empty")
+	}
+	diff, err = redactInput(cfg, diff)
+	if err != nil {
+		return cfg, "", "", err
+	}
+	return cfg, apiKey, diff, nil
+}
 
-		if len(result.Choices) == 0 {
-			lastErr = fmt.Errorf("LLM returned no response for model %s", model)
-			continue
-		}
+// reviewWith reviews diff with the review models in cfg, in one request if
+// it fits and in chunks otherwise. progress receives status messages for the
+// chunked path.
+func reviewWith(ctx context.Context, cfg config.RevlyConfig, apiKey, diff string, progress func(string), onProgress func(Review)) (Review, error) {
+	system, err := systemPrompt(cfg, "review")
+	if err != nil {
+		return Review{}, err
+	}
+	ctx = withTools(ctx, cfg, func(call string) {
+		progress(fmt.Sprintf(" Looking around the repository: %s...", call))
+	})
+
+	user := fmt.Sprintf("Please review this Git diff:\n\n%s", diff)
+	budget := promptBudget(cfg, system)
+	if maxTokens(cfg, user) <= budget {
+		return completeReview(ctx, cfg, apiKey, newRequest(system, user), onProgress)
+	}
 
-		return result.Choices[0].Message.Content, nil
+	chunks := splitDiff(diff, budget, func(s string) int { return maxTokens(cfg, s) })
+	_, files := gitutils.ParseDiff(diff)
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
 	}
 
-	return "", lastErr
-}
\ No newline at end of file
+	progress(fmt.Sprintf(" Diff is too large for one request, reviewing it in %d parts...", len(chunks)))
+	return reviewInChunks(ctx, cfg, apiKey, system, chunks, paths, progress, onProgress)
+}
@@ -0,0 +1,253 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/briandowns/spinner"
+)
+
+// lineSlack is how far apart two findings' line ranges may be and still be
+// about the same code; models often disagree by a line or two.
+const lineSlack = 3
+
+// ConsensusFinding is a finding together with the models that raised it.
+type ConsensusFinding struct {
+	Finding
+	Models []string `json:"models"`
+	// Agreement is the share of the models that answered which raised it.
+	Agreement float64 `json:"agreement"`
+}
+
+// ConsensusReview is the merged result of reviewing one diff with several
+// models.
+type ConsensusReview struct {
+	Summary string `json:"summary"`
+	// Models lists the models that answered; Failed maps the rest to why.
+	Models   []string           `json:"models"`
+	Failed   map[string]string  `json:"failed,omitempty"`
+	Findings []ConsensusFinding `json:"findings"`
+}
+
+// DropUnique removes findings that only one model raised.
+func (r *ConsensusReview) DropUnique() {
+	kept := r.Findings[:0]
+	for _, f := range r.Findings {
+		if len(f.Models) > 1 {
+			kept = append(kept, f)
+		}
+	}
+	r.Findings = kept
+}
+
+// ReviewDiffWithConsensus reviews diff with the first n review models at the
+// same time and merges their findings. Findings that several models raised
+// about the same lines are clustered into one, with an agreement score.
+func ReviewDiffWithConsensus(ctx context.Context, diff string, n int) (ConsensusReview, error) {
+	cfg, apiKey, diff, err := reviewSetup(diff)
+	if err != nil {
+		return ConsensusReview{}, err
+	}
+
+	models := cfg.Task("review").Models
+	if n < 2 {
+		return ConsensusReview{}, fmt.Errorf("consensus needs at least 2 models, got %d", n)
+	}
+	if len(models) < n {
+		return ConsensusReview{}, fmt.Errorf("consensus of %d needs %d review models, but only %d are configured", n, n, len(models))
+	}
+	models = models[:n]
+
+	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+	s.Suffix = fmt.Sprintf(" Reviewing with %d models...", n)
+	s.Start()
+	defer s.Stop()
+
+	ctx, cancel := withTimeout(ctx, cfg, "review")
+	defer cancel()
+
+	reviews := make([]Review, n)
+	var done atomic.Int32
+	errs := runConcurrently(ctx, n, n, func(ctx context.Context, i int) error {
+		one := cfg
+		one.Models.Review.Models = []string{models[i]}
+		var err error
+		reviews[i], err = reviewWith(ctx, one, apiKey, diff, func(string) {}, nil)
+
+		s.Lock()
+		s.Suffix = fmt.Sprintf(" Reviewed with %d of %d models...", done.Add(1), n)
+		s.Unlock()
+		return err
+	})
+	if ctx.Err() != nil {
+		return ConsensusReview{}, ctx.Err()
+	}
+
+	var answered []string
+	var results []Review
+	failed := map[string]string{}
+	var failures []error
+	for i, err := range errs {
+		if err != nil {
+			if IsAuthError(err) {
+				return ConsensusReview{}, err
+			}
+			failed[models[i]] = err.Error()
+			failures = append(failures, fmt.Errorf("%s: %w", models[i], err))
+			continue
+		}
+		answered = append(answered, models[i])
+		results = append(results, reviews[i])
+	}
+	if len(answered) == 0 {
+		return ConsensusReview{}, fmt.Errorf("no model could review the diff: %w", errors.Join(failures...))
+	}
+
+	out := clusterFindings(answered, results)
+	if len(failed) > 0 {
+		out.Failed = failed
+	}
+	return out, nil
+}
+
+// clusterFindings groups findings from different models that describe the
+// same issue. A cluster takes at most one finding per model and is reported
+// with its most severe member.
+func clusterFindings(models []string, reviews []Review) ConsensusReview {
+	type cluster struct {
+		members []Finding
+		models  []string
+	}
+	var clusters []*cluster
+
+	for i, r := range reviews {
+		for _, f := range r.Findings {
+			var best *cluster
+			bestScore := 0.0
+			for _, c := range clusters {
+				if contains(c.models, models[i]) {
+					continue
+				}
+				for _, m := range c.members {
+					if score := similarity(m, f); score > bestScore {
+						best, bestScore = c, score
+					}
+				}
+			}
+			if best == nil {
+				best = &cluster{}
+				clusters = append(clusters, best)
+			}
+			best.members = append(best.members, f)
+			best.models = append(best.models, models[i])
+		}
+	}
+
+	out := ConsensusReview{Models: models}
+	for _, r := range reviews {
+		if r.Summary != "" {
+			out.Summary = r.Summary
+			break
+		}
+	}
+	for _, c := range clusters {
+		lead := c.members[0]
+		for _, m := range c.members[1:] {
+			if SeverityRank(m.Severity) < SeverityRank(lead.Severity) {
+				lead = m
+			}
+		}
+		out.Findings = append(out.Findings, ConsensusFinding{
+			Finding:   lead,
+			Models:    c.models,
+			Agreement: float64(len(c.models)) / float64(len(models)),
+		})
+	}
+
+	sort.SliceStable(out.Findings, func(i, j int) bool {
+		a, b := out.Findings[i], out.Findings[j]
+		if len(a.Models) != len(b.Models) {
+			return len(a.Models) > len(b.Models)
+		}
+		if SeverityRank(a.Severity) != SeverityRank(b.Severity) {
+			return SeverityRank(a.Severity) < SeverityRank(b.Severity)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.StartLine < b.StartLine
+	})
+	return out
+}
+
+// similarity scores how likely two findings are the same issue, 0 meaning
+// unrelated. They must be in the same file; overlapping lines plus either the
+// same category or some shared wording is a match, and findings without
+// line numbers have to share more of their wording.
+func similarity(a, b Finding) float64 {
+	if a.File != b.File {
+		return 0
+	}
+	text := jaccard(words(a.Message), words(b.Message))
+	sameCategory := a.Category == b.Category
+
+	if a.StartLine > 0 && b.StartLine > 0 {
+		if a.StartLine-lineSlack > b.EndLine || b.StartLine-lineSlack > a.EndLine {
+			return 0
+		}
+		if !sameCategory && text < 0.2 {
+			return 0
+		}
+		score := 1 + text
+		if sameCategory {
+			score += 0.5
+		}
+		return score
+	}
+
+	if text < 0.35 {
+		return 0
+	}
+	return text
+}
+
+// words is the set of lowercased words of three or more letters in s.
+func words(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		if len(w) >= 3 {
+			set[w] = true
+		}
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClusterFindings(t *testing.T) {
+	models := []string{"model-a", "model-b", "model-c"}
+	nilDeref := func(line int, severity string) Finding {
+		return Finding{File: "main.go", StartLine: line, EndLine: line, Severity: severity, Category: "correctness", Message: "Possible nil pointer dereference of cfg."}
+	}
+
+	tests := []struct {
+		name    string
+		reviews []Review
+		want    []ConsensusFinding
+	}{
+		{
+			name: "same issue from every model",
+			reviews: []Review{
+				{Findings: []Finding{nilDeref(10, "warning")}},
+				{Findings: []Finding{nilDeref(11, "critical")}},
+				{Findings: []Finding{nilDeref(12, "info")}},
+			},
+			want: []ConsensusFinding{
+				{Finding: nilDeref(11, "critical"), Models: models, Agreement: 1},
+			},
+		},
+		{
+			name: "lines too far apart are different issues",
+			reviews: []Review{
+				{Findings: []Finding{nilDeref(10, "warning")}},
+				{Findings: []Finding{nilDeref(40, "warning")}},
+				{},
+			},
+			want: []ConsensusFinding{
+				{Finding: nilDeref(10, "warning"), Models: []string{"model-a"}, Agreement: 1.0 / 3},
+				{Finding: nilDeref(40, "warning"), Models: []string{"model-b"}, Agreement: 1.0 / 3},
+			},
+		},
+		{
+			name: "different files never cluster",
+			reviews: []Review{
+				{Findings: []Finding{nilDeref(10, "warning")}},
+				{Findings: []Finding{{File: "other.go", StartLine: 10, EndLine: 10, Severity: "warning", Category: "correctness", Message: "Possible nil pointer dereference of cfg."}}},
+				{},
+			},
+			want: []ConsensusFinding{
+				{Finding: nilDeref(10, "warning"), Models: []string{"model-a"}, Agreement: 1.0 / 3},
+				{Finding: Finding{File: "other.go", StartLine: 10, EndLine: 10, Severity: "warning", Category: "correctness", Message: "Possible nil pointer dereference of cfg."}, Models: []string{"model-b"}, Agreement: 1.0 / 3},
+			},
+		},
+		{
+			name: "one finding per model in a cluster",
+			reviews: []Review{
+				{Findings: []Finding{nilDeref(10, "warning"), nilDeref(11, "warning")}},
+				{Findings: []Finding{nilDeref(10, "warning")}},
+				{},
+			},
+			want: []ConsensusFinding{
+				{Finding: nilDeref(10, "warning"), Models: []string{"model-a", "model-b"}, Agreement: 2.0 / 3},
+				{Finding: nilDeref(11, "warning"), Models: []string{"model-a"}, Agreement: 1.0 / 3},
+			},
+		},
+		{
+			name: "findings without lines need similar wording",
+			reviews: []Review{
+				{Findings: []Finding{{File: "go.mod", Severity: "info", Category: "maintainability", Message: "The go directive is outdated, update the go version."}}},
+				{Findings: []Finding{{File: "go.mod", Severity: "warning", Category: "maintainability", Message: "Outdated go directive; update the go version."}}},
+				{Findings: []Finding{{File: "go.mod", Severity: "info", Category: "security", Message: "A dependency has a known vulnerability."}}},
+			},
+			want: []ConsensusFinding{
+				{Finding: Finding{File: "go.mod", Severity: "warning", Category: "maintainability", Message: "Outdated go directive; update the go version."}, Models: []string{"model-a", "model-b"}, Agreement: 2.0 / 3},
+				{Finding: Finding{File: "go.mod", Severity: "info", Category: "security", Message: "A dependency has a known vulnerability."}, Models: []string{"model-c"}, Agreement: 1.0 / 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clusterFindings(models, tt.reviews)
+			if !reflect.DeepEqual(got.Findings, tt.want) {
+				t.Errorf("findings =\n%+v\nwant\n%+v", got.Findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterFindingsSummary(t *testing.T) {
+	got := clusterFindings([]string{"a", "b"}, []Review{{}, {Summary: "From b."}})
+	if got.Summary != "From b." {
+		t.Errorf("summary = %q, want the first non-empty one", got.Summary)
+	}
+	if !reflect.DeepEqual(got.Models, []string{"a", "b"}) {
+		t.Errorf("models = %q", got.Models)
+	}
+}
+
+func TestDropUnique(t *testing.T) {
+	r := ConsensusReview{Findings: []ConsensusFinding{
+		{Finding: Finding{Message: "shared"}, Models: []string{"a", "b"}},
+		{Finding: Finding{Message: "unique"}, Models: []string{"a"}},
+	}}
+	r.DropUnique()
+	if len(r.Findings) != 1 || r.Findings[0].Message != "shared" {
+		t.Errorf("findings = %+v, want only the shared one", r.Findings)
+	}
+}
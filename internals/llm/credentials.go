@@ -0,0 +1,320 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// Credential is an API key and where it was found.
+type Credential struct {
+	Key string
+	// Source is "key_command", "env:<NAME>" or "credentials file".
+	Source string
+}
+
+// MissingKeyError is returned when no source has a key for the provider.
+type MissingKeyError struct {
+	Provider string
+	// Env is the variable to suggest setting.
+	Env   string
+	Tried []string
+}
+
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("no API key for %s: set %s or run 'revly auth login' (looked in %s)",
+		providerName(e.Provider), e.Env, strings.Join(e.Tried, ", "))
+}
+
+// providerKeyEnvs are the variables each provider's own tools read, tried
+// after LLM_API_KEY. OPENROUTER_KEY is what older revly docs told people to set.
+var providerKeyEnvs = map[string][]string{
+	"openrouter": {"OPENROUTER_API_KEY", "OPENROUTER_KEY"},
+	"openai":     {"OPENAI_API_KEY"},
+	"anthropic":  {"ANTHROPIC_API_KEY"},
+	"gemini":     {"GEMINI_API_KEY", "GOOGLE_API_KEY"},
+	"google":     {"GEMINI_API_KEY", "GOOGLE_API_KEY"},
+}
+
+func providerName(provider string) string {
+	if p := strings.ToLower(strings.TrimSpace(provider)); p != "" {
+		return p
+	}
+	return "openrouter"
+}
+
+// KeyEnvs lists the environment variables a key for cfg is read from, in
+// order: key_env if set, LLM_API_KEY, then the provider's own.
+func KeyEnvs(cfg config.LLMConfig) []string {
+	var names []string
+	if cfg.KeyEnv != "" {
+		names = append(names, cfg.KeyEnv)
+	}
+	if cfg.KeyEnv != "LLM_API_KEY" {
+		names = append(names, "LLM_API_KEY")
+	}
+	return append(names, providerKeyEnvs[providerName(cfg.Provider)]...)
+}
+
+// AllKeyEnvs is every variable any provider's key may be read from, for
+// spotting a key set under a name the current provider doesn't use.
+func AllKeyEnvs() []string {
+	seen := map[string]bool{"LLM_API_KEY": true}
+	names := []string{"LLM_API_KEY"}
+	var providers []string
+	for p := range providerKeyEnvs {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+	for _, p := range providers {
+		for _, name := range providerKeyEnvs[p] {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// KeySource is one place a key can come from.
+type KeySource struct {
+	Name   string
+	lookup func() (string, error)
+}
+
+// Lookup returns the key this source holds, or "" when it has none.
+func (s KeySource) Lookup() (string, error) {
+	return s.lookup()
+}
+
+// KeySources lists where a key for cfg is looked for, in order: key_command,
+// the environment variables from KeyEnvs (including .env at the repository
+// root), then the credentials file entry for the endpoint's host. A stored
+// key is refused when the repository config chose the endpoint.
+func KeySources(cfg config.LLMConfig) []KeySource {
+	loadEnv()
+	var sources []KeySource
+	if cfg.KeyCommand != "" {
+		sources = append(sources, KeySource{"key_command", func() (string, error) {
+			return runKeyCommand(cfg.KeyCommand)
+		}})
+	}
+	for _, name := range KeyEnvs(cfg) {
+		sources = append(sources, KeySource{"env:" + name, func() (string, error) {
+			return strings.TrimSpace(os.Getenv(name)), nil
+		}})
+	}
+	return append(sources, KeySource{"credentials file", func() (string, error) {
+		stored, err := StoredCredentials()
+		if err != nil {
+			return "", err
+		}
+		key := stored[CredentialName(cfg)]
+		if key != "" && endpointFromRepo() {
+			return "", fmt.Errorf("not sending the stored key for %s to an endpoint set by the repository config; set llm.base_url in your user config or the key in %s",
+				CredentialName(cfg), KeyEnvs(cfg)[0])
+		}
+		return key, nil
+	}})
+}
+
+// endpointFromRepo reports whether the repository config chose the endpoint
+// keys are sent to.
+func endpointFromRepo() bool {
+	return config.SetByRepo("llm.base_url") || config.SetByRepo("llm.api_base_url")
+}
+
+// ResolveKey finds the API key for cfg in the first source that has one. It
+// returns an empty credential for providers that don't need a key.
+func ResolveKey(cfg config.LLMConfig) (Credential, error) {
+	if !RequiresAPIKey(cfg) {
+		return Credential{}, nil
+	}
+	var tried []string
+	for _, s := range KeySources(cfg) {
+		key, err := s.Lookup()
+		if err != nil {
+			return Credential{}, fmt.Errorf("reading the API key from %s: %w", s.Name, err)
+		}
+		if key != "" {
+			return Credential{Key: key, Source: s.Name}, nil
+		}
+		tried = append(tried, s.Name)
+	}
+	return Credential{}, &MissingKeyError{Provider: cfg.Provider, Env: KeyEnvs(cfg)[0], Tried: tried}
+}
+
+// resolveKey is ResolveKey for callers that only need the key.
+func resolveKey(cfg config.LLMConfig) (string, error) {
+	cred, err := ResolveKey(cfg)
+	return cred.Key, err
+}
+
+var (
+	keyCommandMu  sync.Mutex
+	keyCommandOut = map[string]string{}
+)
+
+// keyCommandTimeout leaves time to unlock a password manager.
+const keyCommandTimeout = time.Minute
+
+// runKeyCommand runs a key_command through the shell and returns the first
+// line it prints. The result is kept for the rest of the process, so a
+// password manager is asked once.
+func runKeyCommand(command string) (string, error) {
+	keyCommandMu.Lock()
+	defer keyCommandMu.Unlock()
+	if key, ok := keyCommandOut[command]; ok {
+		return key, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyCommandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	// Let password managers prompt on the terminal.
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%q failed: %w", command, err)
+	}
+	key, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", fmt.Errorf("%q printed nothing", command)
+	}
+	keyCommandOut[command] = key
+	return key, nil
+}
+
+// CredentialsFile is where 'revly auth login' stores keys. It must only be
+// readable by its owner.
+func CredentialsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".revly", "credentials.toml")
+}
+
+// CredentialName is the entry in the credentials file for cfg: the host of
+// its endpoint, so a stored key is only ever sent where it was meant to go.
+func CredentialName(cfg config.LLMConfig) string {
+	u, err := url.Parse(EndpointURL(cfg))
+	if err != nil || u.Host == "" {
+		return providerName(cfg.Provider)
+	}
+	return u.Host
+}
+
+type storedCredential struct {
+	APIKey string `toml:"api_key"`
+}
+
+// StoredCredentials reads the credentials file into a map from entry name to
+// key. A missing file holds nothing; one accessible to other users is refused.
+func StoredCredentials() (map[string]string, error) {
+	path := CredentialsFile()
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s is accessible by other users (mode %04o); run 'chmod 600 %s'", path, info.Mode().Perm(), path)
+	}
+	var file map[string]storedCredential
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	stored := map[string]string{}
+	for name, c := range file {
+		stored[name] = c.APIKey
+	}
+	return stored, nil
+}
+
+// SaveCredential stores key under name in the credentials file.
+func SaveCredential(name, key string) error {
+	stored, err := StoredCredentials()
+	if err != nil {
+		return err
+	}
+	stored[name] = key
+	return writeCredentials(stored)
+}
+
+// DeleteCredential removes the entry for name, reporting whether there was one.
+func DeleteCredential(name string) (bool, error) {
+	stored, err := StoredCredentials()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := stored[name]; !ok {
+		return false, nil
+	}
+	delete(stored, name)
+	return true, writeCredentials(stored)
+}
+
+// writeCredentials replaces the credentials file. The temporary file is
+// created 0600, so the keys are never readable by others, even briefly.
+func writeCredentials(stored map[string]string) error {
+	path := CredentialsFile()
+	if len(stored) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	file := map[string]storedCredential{}
+	for name, key := range stored {
+		file[name] = storedCredential{APIKey: key}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# API keys stored by 'revly auth login', by endpoint host. Keep this file private.\n\n")
+	if err := toml.NewEncoder(&buf).Encode(file); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".credentials-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
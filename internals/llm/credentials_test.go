@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+func TestKeySources(t *testing.T) {
+	cfg := config.LLMConfig{Provider: "anthropic", KeyEnv: "MY_LLM_KEY", KeyCommand: "echo from-command"}
+	var names []string
+	for _, s := range KeySources(cfg) {
+		names = append(names, s.Name)
+	}
+	want := "key_command env:MY_LLM_KEY env:LLM_API_KEY env:ANTHROPIC_API_KEY credentials file"
+	if strings.Join(names, " ") != want {
+		t.Errorf("sources = %q, want %q", names, want)
+	}
+
+	t.Setenv("LLM_API_KEY", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("MY_LLM_KEY", " from-env \n")
+	if runtime.GOOS != "windows" {
+		if cred, err := ResolveKey(cfg); err != nil || cred != (Credential{"from-command", "key_command"}) {
+			t.Errorf("ResolveKey = %+v, %v; want the key_command's output", cred, err)
+		}
+	}
+	cfg.KeyCommand = ""
+	if cred, err := ResolveKey(cfg); err != nil || cred != (Credential{"from-env", "env:MY_LLM_KEY"}) {
+		t.Errorf("ResolveKey = %+v, %v; want the key_env variable", cred, err)
+	}
+
+	t.Setenv("MY_LLM_KEY", "")
+	_, err := ResolveKey(cfg)
+	if missing, ok := err.(*MissingKeyError); !ok || missing.Env != "MY_LLM_KEY" || len(missing.Tried) != 4 {
+		t.Errorf("err = %#v, want a MissingKeyError suggesting MY_LLM_KEY", err)
+	}
+	if cred, err := ResolveKey(config.LLMConfig{Provider: "ollama"}); err != nil || cred.Key != "" {
+		t.Errorf("ollama: %+v, %v", cred, err)
+	}
+}
+
+func TestCredentialsFile(t *testing.T) {
+	if err := SaveCredential("llm.example.com", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveCredential("other.example.com", "k2"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := StoredCredentials()
+	if err != nil || stored["llm.example.com"] != "k1" || stored["other.example.com"] != "k2" {
+		t.Fatalf("StoredCredentials = %v, %v", stored, err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(CredentialsFile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+		}
+		os.Chmod(CredentialsFile(), 0644)
+		if _, err := StoredCredentials(); err == nil || !strings.Contains(err.Error(), "accessible by other users") {
+			t.Errorf("a world-readable file was read: err = %v", err)
+		}
+		os.Chmod(CredentialsFile(), 0600)
+	}
+
+	for _, name := range []string{"llm.example.com", "other.example.com"} {
+		if found, err := DeleteCredential(name); err != nil || !found {
+			t.Errorf("DeleteCredential(%s) = %v, %v", name, found, err)
+		}
+	}
+	if found, err := DeleteCredential("llm.example.com"); err != nil || found {
+		t.Errorf("deleting a missing entry = %v, %v", found, err)
+	}
+	if _, err := os.Stat(CredentialsFile()); !os.IsNotExist(err) {
+		t.Errorf("the emptied credentials file was kept: %v", err)
+	}
+}
+
+func TestCredentialName(t *testing.T) {
+	tests := []struct {
+		cfg  config.LLMConfig
+		want string
+	}{
+		{config.LLMConfig{Provider: "openrouter"}, "openrouter.ai"},
+		{config.LLMConfig{Provider: "openai-compatible", BaseURL: "https://gw.acme.internal:8443/v1"}, "gw.acme.internal:8443"},
+		{config.LLMConfig{Provider: "openai-compatible"}, "openai-compatible"},
+	}
+	for _, tt := range tests {
+		if got := CredentialName(tt.cfg); got != tt.want {
+			t.Errorf("CredentialName(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+// storedKeyEnv makes TestStoredKeyOnlyForTheUsersEndpoint resolve the key in
+// a checkout whose endpoint is set by the user config.
+const storedKeyEnv = "REVLY_TEST_STORED_KEY"
+
+// TestStoredKeyOnlyForTheUsersEndpoint checks a stored key isn't sent to an
+// endpoint the repository config chose, as this package's scratch repository
+// does, but is when the user config chose it, in a child process.
+func TestStoredKeyOnlyForTheUsersEndpoint(t *testing.T) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LLM_API_KEY", "")
+	name := CredentialName(cfg.LLM)
+	if err := SaveCredential(name, "stored-key"); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteCredential(name)
+
+	cred, err := ResolveKey(cfg.LLM)
+	if os.Getenv(storedKeyEnv) != "" {
+		if err != nil || cred != (Credential{"stored-key", "credentials file"}) {
+			t.Errorf("ResolveKey = %+v, %v; want the stored key", cred, err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), "endpoint set by the repository config") {
+		t.Errorf("ResolveKey = %+v, %v; want the stored key refused", cred, err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "set llm.base_url in your user config") {
+		t.Errorf("err = %v, want it to say how to fix it", err)
+	}
+
+	dir := t.TempDir()
+	home, root := filepath.Join(dir, "home"), filepath.Join(dir, "repo")
+	git(t, dir, "init", "-q", root)
+	files := map[string]string{
+		filepath.Join(home, ".revly", "config.toml"): "version = 1\n\n[llm]\nprovider = \"openai-compatible\"\nbase_url = \"" + cfg.LLM.BaseURL + "\"\nmodels = [\"fake\"]\n",
+		filepath.Join(root, "revly.config.toml"):     "version = 1\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestStoredKeyOnlyForTheUsersEndpoint$")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), storedKeyEnv+"=1", "HOME="+home)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("with the endpoint from the user config: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,332 @@
+package llm
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/fakellm"
+	"github.com/nareshkarthigeyan/revly/internals/usage"
+)
+
+// The tests in this file run review, commit and pair end to end: against
+// the fake LLM server, and replayed from a recorded cassette. They share one
+// config, loaded once, for a scratch repository TestMain sets up.
+
+var record = flag.Bool("record", false, "re-record "+cassetteFixture+" from the fake LLM server")
+
+const (
+	cassetteFixture = "testdata/cassette.json"
+	// cassetteAddr is where the cassette was recorded; replaying needs no
+	// server, but requests are matched on their URL.
+	cassetteAddr = "127.0.0.1:8787"
+	testKey      = "test-key"
+)
+
+// cassettePath is cassetteFixture, made absolute before TestMain leaves the
+// package directory.
+var cassettePath string
+
+const (
+	testReviewDiff = "diff --git a/review-target.go b/review-target.go\n--- a/review-target.go\n+++ b/review-target.go\n" +
+		"@@ -1,3 +1,5 @@\n package main\n \n-func greet() {}\n+func greet(name string) {\n+\tprintln(\"hi \" + name)\n+}\n"
+	testCommitDiff = "diff --git a/commit-target.go b/commit-target.go\n--- a/commit-target.go\n+++ b/commit-target.go\n" +
+		"@@ -1 +1 @@\n-func greet() {}\n+func greet(name string) {}\n"
+	testPairDiff = "diff --git a/pair-target.go b/pair-target.go\n--- a/pair-target.go\n+++ b/pair-target.go\n" +
+		"@@ -1 +1,2 @@\n-func greet() {}\n+func greet(name string) {\n+\tif name == \"\" {\n"
+	testToolsDiff = "diff --git a/tools-target.go b/tools-target.go\n--- a/tools-target.go\n+++ b/tools-target.go\n" +
+		"@@ -1 +1 @@\n-\tgreet()\n+\tgreet(\"\")\n"
+
+	reviewReply = `{"summary": "Adds a name to greet.", "findings": [` +
+		`{"file": "review-target.go", "start_line": 3, "end_line": 5, "severity": "warning", "category": "correctness", "message": "An empty name prints a dangling space."}]}`
+	toolsReply  = `{"summary": "Calls greet with an empty name.", "findings": []}`
+	commitReply = "feat: greet users by name"
+	pairReply   = "Handle the empty name before printing."
+)
+
+// script answers each test's prompt; the targets are file names unique to
+// one test's diff.
+var script = fakellm.Script{Rules: []fakellm.Rule{
+	{Model: "missing-model", Status: 404},
+	{Match: "tools-target.go", Tool: "read_file", Arguments: `{"path": "greet.go"}`, Times: 1},
+	{Match: "tools-target.go", Content: toolsReply},
+	{Match: "review-target.go", Content: reviewReply},
+	{Match: "commit-target.go", Content: commitReply},
+	{Match: "pair-target.go", Content: pairReply},
+}}
+
+// TestMain runs every test in the package from the scratch repository, so
+// the usage ledger and caches they write never land in a real one.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	if os.Getenv(printKeyEnv) != "" || os.Getenv(storedKeyEnv) != "" {
+		// A child process of one of the tests, run in a checkout of its own.
+		return m.Run()
+	}
+	var err error
+	if cassettePath, err = filepath.Abs(cassetteFixture); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	dir, err := os.MkdirTemp("", "revly-llm-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	baseURL, stop, err := startServer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer stop()
+	if err := scratchRepo(dir, baseURL); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return m.Run()
+}
+
+// startServer starts the fake LLM server and returns its base URL. Replaying
+// a cassette needs no server, only the URL it was recorded at.
+func startServer() (string, func(), error) {
+	replaying := os.Getenv(cassetteEnv) != "" && os.Getenv(cassetteModeEnv) != "record"
+	if replaying {
+		return "http://" + cassetteAddr + "/v1", func() {}, nil
+	}
+	srv := httptest.NewUnstartedServer(fakellm.New(fakellm.Options{Script: script}))
+	if os.Getenv(cassetteEnv) != "" {
+		ln, err := net.Listen("tcp", cassetteAddr)
+		if err != nil {
+			return "", nil, fmt.Errorf("recording needs %s free: %w", cassetteAddr, err)
+		}
+		srv.Listener.Close()
+		srv.Listener = ln
+	}
+	srv.Start()
+	return srv.URL + "/v1", srv.Close, nil
+}
+
+// scratchRepo makes dir/repo a git repository configured for the fake
+// server, with an empty home, and moves into it.
+func scratchRepo(dir, baseURL string) error {
+	home := filepath.Join(dir, "home")
+	root := filepath.Join(dir, "repo")
+	if err := os.MkdirAll(home, 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		return fmt.Errorf("git init: %v\n%s", err, out)
+	}
+	cfg := fmt.Sprintf("version = 1\n\n[llm]\nprovider = \"openai-compatible\"\nbase_url = %q\nmodels = [\"fake\"]\n", baseURL)
+	files := map[string]string{
+		"revly.config.toml": cfg,
+		"greet.go":          "package main\n\nfunc greet(name string) {\n\tprintln(\"hi \" + name)\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "REVLY_") && name != cassetteEnv && name != cassetteModeEnv {
+			os.Unsetenv(name)
+		}
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("LLM_API_KEY", testKey)
+	return os.Chdir(root)
+}
+
+func skipWhenReplaying(t *testing.T) {
+	t.Helper()
+	if os.Getenv(cassetteEnv) != "" {
+		t.Skip("runs against the fake server only")
+	}
+}
+
+func checkReview(t *testing.T, r Review) {
+	t.Helper()
+	if r.Summary != "Adds a name to greet." {
+		t.Errorf("summary = %q", r.Summary)
+	}
+	want := Finding{File: "review-target.go", StartLine: 3, EndLine: 5, Severity: "warning", Category: "correctness", Message: "An empty name prints a dangling space."}
+	if len(r.Findings) != 1 || r.Findings[0] != want {
+		t.Errorf("findings = %+v, want [%+v]", r.Findings, want)
+	}
+}
+
+func TestReviewWithFakeServer(t *testing.T) {
+	skipWhenReplaying(t)
+	r, err := ReviewDiffWithLLM(context.Background(), testReviewDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReview(t, r)
+
+	records, err := usage.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, rec := range records {
+		found = found || rec.Command == "review" && rec.Model == "fake" && rec.PromptTokens > 0
+	}
+	if !found {
+		t.Errorf("the review wasn't recorded in the usage ledger: %+v", records)
+	}
+}
+
+func TestReviewStreamWithFakeServer(t *testing.T) {
+	skipWhenReplaying(t)
+	updates := 0
+	r, err := ReviewDiffWithLLMStream(context.Background(), testReviewDiff, func(Review) { updates++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReview(t, r)
+	if updates == 0 {
+		t.Error("no progress while the review streamed")
+	}
+}
+
+func TestCommitMessageWithFakeServer(t *testing.T) {
+	skipWhenReplaying(t)
+	msg, err := GetLLMResponse(context.Background(), testCommitDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != commitReply {
+		t.Errorf("commit message = %q, want %q", msg, commitReply)
+	}
+}
+
+func TestPairWithFakeServer(t *testing.T) {
+	skipWhenReplaying(t)
+	comment, err := GetPairProgrammingComment(context.Background(), testPairDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment != pairReply {
+		t.Errorf("pair comment = %q, want %q", comment, pairReply)
+	}
+}
+
+// ownServer returns the loaded config pointed at a fake server of its own,
+// for tests whose rules keep state.
+func ownServer(t *testing.T) config.RevlyConfig {
+	t.Helper()
+	cfg, err := config.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(fakellm.New(fakellm.Options{Script: script}))
+	t.Cleanup(srv.Close)
+	cfg.LLM.BaseURL = srv.URL + "/v1"
+	return cfg
+}
+
+func TestReviewWithToolsAgainstFakeServer(t *testing.T) {
+	skipWhenReplaying(t)
+	cfg := ownServer(t)
+	cfg.Review.Tools = config.ReviewToolsConfig{Enabled: true, MaxCalls: 5, MaxBytes: 10_000}
+
+	var progress []string
+	r, err := reviewWith(context.Background(), cfg, testKey, testToolsDiff, func(msg string) { progress = append(progress, msg) }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Summary != "Calls greet with an empty name." {
+		t.Errorf("summary = %q", r.Summary)
+	}
+	if len(progress) != 1 || !strings.Contains(progress[0], "read_file greet.go") {
+		t.Errorf("progress = %q, want the read_file call", progress)
+	}
+}
+
+func TestFallsBackToTheNextModel(t *testing.T) {
+	skipWhenReplaying(t)
+	cfg := ownServer(t)
+	cfg.LLM.MaxRetries = 0
+	cfg.Models.Commit.Models = []string{"missing-model", "fake"}
+
+	system, err := systemPrompt(cfg, "commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := complete(context.Background(), cfg, testKey, "commit", newRequest(system, testCommitDiff), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != commitReply {
+		t.Errorf("commit message = %q, want %q from the second model", msg, commitReply)
+	}
+}
+
+// TestCassette replays testdata/cassette.json through review, commit and
+// pair. The cassette is chosen when the process starts, so the commands run
+// in a child process. Re-record it with:
+//
+//	go test ./internals/llm -run TestCassette -record
+func TestCassette(t *testing.T) {
+	if os.Getenv(cassetteEnv) != "" {
+		replayCommands(t)
+		return
+	}
+	env := append(os.Environ(), cassetteEnv+"="+cassettePath)
+	if *record {
+		if err := os.Remove(cassettePath); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		env = append(env, cassetteModeEnv+"=record")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCassette$")
+	cmd.Env = env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("replaying %s: %v\n%s", cassetteFixture, err, out)
+	}
+}
+
+func replayCommands(t *testing.T) {
+	ctx := context.Background()
+
+	r, err := ReviewDiffWithLLM(ctx, testReviewDiff)
+	if err != nil {
+		t.Fatalf("review: %v", err)
+	}
+	checkReview(t, r)
+
+	msg, err := GetLLMResponse(ctx, testCommitDiff)
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if msg != commitReply {
+		t.Errorf("commit message = %q, want %q", msg, commitReply)
+	}
+
+	comment, err := GetPairProgrammingComment(ctx, testPairDiff)
+	if err != nil {
+		t.Fatalf("pair: %v", err)
+	}
+	if comment != pairReply {
+		t.Errorf("pair comment = %q, want %q", comment, pairReply)
+	}
+}
@@ -4,17 +4,19 @@ package llm
 import (
 	// "fmt"
 	// "os"
+	"path/filepath"
 	"sync"
 
 	"github.com/joho/godotenv"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
 )
 
 var loadEnvOnce sync.Once
 
 func loadEnv() {
 	loadEnvOnce.Do(func() {
-		// Load .env from current working directory or project root
-		err := godotenv.Load()
+		// Load .env from the repository root
+		err := godotenv.Load(filepath.Join(repo.Root(), ".env"))
 		if err != nil {
 			// fmt.Println("DEBUG: No .env file found or failed to load")
 		} else {
@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies a failed model call so the fallback loop can decide
+// whether to retry, move on to the next model, or stop altogether.
+type ErrorKind int
+
+const (
+	ErrUnknown    ErrorKind = iota
+	ErrAuth                 // bad or missing credentials; no model will work
+	ErrRateLimit            // transient throttling; retry after a pause
+	ErrQuota                // out of credits or quota; try another model
+	ErrServer               // 5xx or overloaded; retry after a pause
+	ErrNetwork              // connection failures and timeouts; retry
+	ErrBadRequest           // rejected request, e.g. unknown model; try another model
+	ErrMalformed            // unparseable or empty response; try another model
+	ErrTimeout              // request_timeout elapsed; try another model
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrAuth:
+		return "auth"
+	case ErrRateLimit:
+		return "rate-limit"
+	case ErrQuota:
+		return "quota"
+	case ErrServer:
+		return "server"
+	case ErrNetwork:
+		return "network"
+	case ErrBadRequest:
+		return "bad-request"
+	case ErrMalformed:
+		return "malformed"
+	case ErrTimeout:
+		return "timeout"
+	default:
+		return "unknown"
+	}
+}
+
+// APIError is returned by every provider call that fails.
+type APIError struct {
+	Kind       ErrorKind
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s error (HTTP %d): %s", e.Kind, e.StatusCode, msg)
+	}
+	return fmt.Sprintf("%s error: %s", e.Kind, msg)
+}
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+// Retryable reports whether the same request may succeed if sent again.
+func (e *APIError) Retryable() bool {
+	switch e.Kind {
+	case ErrRateLimit, ErrServer, ErrNetwork:
+		return true
+	}
+	return false
+}
+
+// IsAuthError reports whether err is a credentials failure.
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Kind == ErrAuth
+}
+
+// errorPayload covers the error bodies of every supported provider:
+//
+//	OpenRouter / OpenAI: {"error": {"message": "...", "code": 429, "type": "..."}}
+//	Anthropic:           {"type": "error", "error": {"type": "rate_limit_error", "message": "..."}}
+//	Gemini:              {"error": {"code": 429, "message": "...", "status": "RESOURCE_EXHAUSTED"}}
+//	Ollama:              {"error": "model \"x\" not found"}
+type errorPayload struct {
+	Error json.RawMessage `json:"error"`
+}
+
+type errorDetail struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Status  string          `json:"status"`
+	Code    json.RawMessage `json:"code"`
+}
+
+// parseErrorPayload extracts the provider's error message and code, if the
+// body carries one.
+func parseErrorPayload(body []byte) (message, code string, ok bool) {
+	var payload errorPayload
+	if json.Unmarshal(body, &payload) != nil || len(payload.Error) == 0 || string(payload.Error) == "null" {
+		return "", "", false
+	}
+
+	var text string
+	if json.Unmarshal(payload.Error, &text) == nil {
+		return text, "", true
+	}
+
+	var detail errorDetail
+	if json.Unmarshal(payload.Error, &detail) != nil {
+		return string(payload.Error), "", true
+	}
+	code = strings.Trim(string(detail.Code), `"`)
+	for _, c := range []string{detail.Type, detail.Status} {
+		if c != "" {
+			code = strings.TrimSpace(code + " " + c)
+		}
+	}
+	return detail.Message, code, true
+}
+
+// classifyResponse turns a non-2xx response into an APIError.
+func classifyResponse(resp *http.Response, body []byte) *APIError {
+	message, code, ok := parseErrorPayload(body)
+	if !ok {
+		message = strings.TrimSpace(string(body))
+		if len(message) > 300 {
+			message = message[:300] + "..."
+		}
+		if message == "" {
+			message = resp.Status
+		}
+	}
+
+	return &APIError{
+		Kind:       classifyStatus(resp.StatusCode, message+" "+code),
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: retryAfter(resp.Header),
+	}
+}
+
+func classifyStatus(status int, hint string) ErrorKind {
+	hint = strings.ToLower(hint)
+	quota := strings.Contains(hint, "quota") || strings.Contains(hint, "credit") ||
+		strings.Contains(hint, "billing") || strings.Contains(hint, "insufficient")
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusPaymentRequired:
+		return ErrQuota
+	case status == http.StatusTooManyRequests:
+		// OpenAI reports an exhausted balance as a 429 with insufficient_quota,
+		// which waiting won't fix.
+		if quota && !strings.Contains(hint, "resource_exhausted") {
+			return ErrQuota
+		}
+		return ErrRateLimit
+	case status == http.StatusRequestTimeout:
+		return ErrNetwork
+	case status >= 500:
+		// 529 is Anthropic's "overloaded".
+		return ErrServer
+	case status >= 400:
+		return ErrBadRequest
+	}
+	return ErrUnknown
+}
+
+// streamError classifies an error event received in the middle of a stream,
+// where there is no HTTP status to go on.
+func streamError(message, code string) *APIError {
+	status, _ := strconv.Atoi(code)
+	kind := classifyStatus(status, message+" "+code)
+	if kind == ErrUnknown {
+		hint := strings.ToLower(code)
+		switch {
+		case strings.Contains(hint, "rate_limit"):
+			kind = ErrRateLimit
+		case strings.Contains(hint, "overloaded"), strings.Contains(hint, "api_error"):
+			kind = ErrServer
+		case strings.Contains(hint, "authentication"), strings.Contains(hint, "permission"):
+			kind = ErrAuth
+		}
+	}
+	return &APIError{Kind: kind, StatusCode: status, Message: message}
+}
+
+// malformed reports a response that arrived but couldn't be used.
+func malformed(format string, args ...any) *APIError {
+	return &APIError{Kind: ErrMalformed, Message: fmt.Sprintf(format, args...)}
+}
+
+// retryAfter reads Retry-After (seconds or an HTTP date) and OpenAI's
+// retry-after-ms.
+func retryAfter(h http.Header) time.Duration {
+	if ms := h.Get("retry-after-ms"); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil && n > 0 {
+			return time.Duration(n * float64(time.Millisecond))
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
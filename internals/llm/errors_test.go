@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassifyResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		kind    ErrorKind
+		message string
+	}{
+		{"bad key", 401, `{"error": {"message": "Invalid API key", "code": 401}}`, ErrAuth, "Invalid API key"},
+		{"forbidden", 403, `{"type": "error", "error": {"type": "permission_error", "message": "no access"}}`, ErrAuth, "no access"},
+		{"out of credits", 402, `{"error": {"message": "Insufficient credits"}}`, ErrQuota, "Insufficient credits"},
+		{"throttled", 429, `{"type": "error", "error": {"type": "rate_limit_error", "message": "slow down"}}`, ErrRateLimit, "slow down"},
+		{"OpenAI out of quota", 429, `{"error": {"message": "You exceeded your current quota", "type": "insufficient_quota"}}`, ErrQuota, "You exceeded your current quota"},
+		{"Gemini throttled", 429, `{"error": {"code": 429, "message": "Quota exceeded for requests per minute", "status": "RESOURCE_EXHAUSTED"}}`, ErrRateLimit, "Quota exceeded for requests per minute"},
+		{"request timeout", 408, ``, ErrNetwork, "408 Request Timeout"},
+		{"server error", 500, `upstream crashed`, ErrServer, "upstream crashed"},
+		{"Anthropic overloaded", 529, `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`, ErrServer, "Overloaded"},
+		{"unknown model", 404, `{"error": "model \"x\" not found"}`, ErrBadRequest, `model "x" not found`},
+		{"bad request", 400, `{"error": {"message": "max_tokens too large"}}`, ErrBadRequest, "max_tokens too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Header: http.Header{}}
+			if tt.status == 408 {
+				resp.Status = "408 Request Timeout"
+			}
+			err := classifyResponse(resp, []byte(tt.body))
+			if err.Kind != tt.kind {
+				t.Errorf("kind = %s, want %s", err.Kind, tt.kind)
+			}
+			if err.Message != tt.message {
+				t.Errorf("message = %q, want %q", err.Message, tt.message)
+			}
+			if err.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", err.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	tests := []struct {
+		message, code string
+		kind          ErrorKind
+	}{
+		{"Rate limited", "429", ErrRateLimit},
+		{"Provider returned error", "502", ErrServer},
+		{"slow down", "rate_limit_error", ErrRateLimit},
+		{"Overloaded", "overloaded_error", ErrServer},
+		{"Internal error", "api_error", ErrServer},
+		{"bad key", "authentication_error", ErrAuth},
+		{"something odd", "", ErrUnknown},
+	}
+	for _, tt := range tests {
+		if got := streamError(tt.message, tt.code).Kind; got != tt.kind {
+			t.Errorf("streamError(%q, %q) = %s, want %s", tt.message, tt.code, got, tt.kind)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	retryable := map[ErrorKind]bool{ErrRateLimit: true, ErrServer: true, ErrNetwork: true}
+	for k := ErrUnknown; k <= ErrTimeout; k++ {
+		if got := (&APIError{Kind: k}).Retryable(); got != retryable[k] {
+			t.Errorf("%s: Retryable() = %v", k, got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"none", http.Header{}, 0},
+		{"seconds", http.Header{"Retry-After": {"7"}}, 7 * time.Second},
+		{"milliseconds win", http.Header{"Retry-After": {"7"}, "Retry-After-Ms": {"250"}}, 250 * time.Millisecond},
+		{"zero", http.Header{"Retry-After": {"0"}}, 0},
+		{"garbage", http.Header{"Retry-After": {"soon"}}, 0},
+		{"date in the past", http.Header{"Retry-After": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.header); got != tt.want {
+			t.Errorf("%s: retryAfter = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfter(http.Header{"Retry-After": {at}}); got < 58*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(%s) = %s, want about a minute", at, got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if got := backoff(3, 2*time.Second); got != 2*time.Second {
+		t.Errorf("backoff with Retry-After = %s, want 2s", got)
+	}
+	for attempt := 0; attempt < 10; attempt++ {
+		ceiling := min(retryBaseDelay<<attempt, retryMaxDelay)
+		for i := 0; i < 20; i++ {
+			if got := backoff(attempt, 0); got < ceiling/2 || got > ceiling {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempt, got, ceiling/2, ceiling)
+			}
+		}
+	}
+	if got := backoff(100, 0); got > retryMaxDelay || got <= 0 {
+		t.Errorf("backoff(100) = %s, want at most %s", got, retryMaxDelay)
+	}
+}
@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 8 * time.Second
+
+	// maxRetryAfter is the longest server-requested pause we'll sit through.
+	// Anything longer is better spent on the next model in the list.
+	maxRetryAfter = 30 * time.Second
+)
+
+// executor sends provider requests, classifies failures and retries the
+// transient ones with jittered exponential backoff.
+type executor struct {
+	client         *http.Client
+	maxRetries     int
+	requestTimeout time.Duration
+}
+
+func newExecutor(cfg config.LLMConfig) (*executor, error) {
+	transport, err := cassetteTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &executor{
+		client:         &http.Client{Transport: transport},
+		maxRetries:     cfg.MaxRetries,
+		requestTimeout: cfg.RequestTimeout,
+	}, nil
+}
+
+// post sends body as JSON and returns the response if it has a 2xx status.
+// The caller owns the response body, and closing it releases the request's
+// timeout. Failures are *APIError, or ctx.Err() once ctx is done.
+func (x *executor) post(ctx context.Context, url string, headers map[string]string, body any) (*http.Response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := x.send(ctx, url, headers, b)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Retryable() || attempt >= x.maxRetries || apiErr.RetryAfter > maxRetryAfter {
+			return nil, err
+		}
+		if err := wait(ctx, backoff(attempt, apiErr.RetryAfter)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// postJSON sends body as JSON and decodes a successful response into out.
+// A 2xx body that carries an error payload (OpenRouter does this when an
+// upstream provider fails) is reported as an error rather than decoded.
+func (x *executor) postJSON(ctx context.Context, url string, headers map[string]string, body any, out any) error {
+	resp, err := x.post(ctx, url, headers, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &APIError{Kind: ErrNetwork, Err: err}
+	}
+	if message, code, ok := parseErrorPayload(respBody); ok {
+		return streamError(message, code)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return &APIError{Kind: ErrMalformed, Message: "invalid JSON response: " + err.Error(), Err: err}
+	}
+	return nil
+}
+
+func (x *executor) send(ctx context.Context, url string, headers map[string]string, body []byte) (*http.Response, error) {
+	reqCtx, cancel := ctx, context.CancelFunc(func() {})
+	if x.requestTimeout > 0 {
+		reqCtx, cancel = context.WithTimeout(ctx, x.requestTimeout)
+	}
+
+	req, err := http.NewRequestWithContext(reqCtx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, &APIError{Kind: ErrBadRequest, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		cancel()
+		if ctx.Err() == nil && errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+			return nil, &APIError{Kind: ErrTimeout, Message: fmt.Sprintf("no response within %s", x.requestTimeout), Err: err}
+		}
+		if errors.Is(err, errNoRecording) {
+			return nil, &APIError{Kind: ErrBadRequest, Err: err}
+		}
+		return nil, &APIError{Kind: ErrNetwork, Err: err}
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		resp.Body = cancelOnClose{resp.Body, cancel}
+		return resp, nil
+	}
+
+	defer cancel()
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return nil, classifyResponse(resp, respBody)
+}
+
+// cancelOnClose ties a request's timeout context to its response body so
+// the deadline keeps covering a stream until the caller is done with it.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// wait sleeps for d or until ctx is done.
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff returns the pause before retry number attempt+1. A server-provided
+// Retry-After wins; otherwise the delay doubles each attempt with jitter so
+// concurrent clients don't retry in lockstep.
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	d := retryBaseDelay << attempt
+	if d > retryMaxDelay || d <= 0 {
+		d = retryMaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with status, and
+// retryAfter as Retry-After-Ms when set, then answers OK. It counts every
+// request.
+func flakyServer(t *testing.T, failures int, status int, retryAfter string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After-Ms", retryAfter)
+			}
+			w.WriteHeader(status)
+			io.WriteString(w, `{"error": {"message": "try again"}}`)
+			return
+		}
+		io.WriteString(w, `{"ok": true}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestExecutorRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		failures   int
+		maxRetries int
+		retryAfter string
+		calls      int32
+		kind       ErrorKind
+	}{
+		{"rate limit then success", 429, 2, 2, "1", 3, 0},
+		{"server error then success", 503, 1, 2, "1", 2, 0},
+		{"retries exhausted", 503, 5, 2, "1", 3, ErrServer},
+		{"no retries configured", 429, 1, 0, "1", 1, ErrRateLimit},
+		{"auth errors aren't retried", 401, 1, 3, "", 1, ErrAuth},
+		{"bad requests aren't retried", 400, 1, 3, "", 1, ErrBadRequest},
+		{"quota isn't retried", 402, 1, 3, "", 1, ErrQuota},
+		{"long Retry-After moves on", 429, 1, 3, "60000", 1, ErrRateLimit},
+		{"backoff without Retry-After", 502, 1, 1, "", 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := flakyServer(t, tt.failures, tt.status, tt.retryAfter)
+			x := &executor{client: srv.Client(), maxRetries: tt.maxRetries}
+
+			var out struct{ OK bool }
+			err := x.postJSON(context.Background(), srv.URL, nil, map[string]string{}, &out)
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("%d requests, want %d", got, tt.calls)
+			}
+			if tt.kind == 0 {
+				if err != nil || !out.OK {
+					t.Errorf("err = %v, ok = %v; want success", err, out.OK)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Kind != tt.kind {
+				t.Errorf("err = %v, want a %s error", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestExecutorErrorPayloadInSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"error": {"message": "Provider returned error", "code": 502}}`)
+	}))
+	defer srv.Close()
+
+	x := &executor{client: srv.Client()}
+	var out struct{}
+	err := x.postJSON(context.Background(), srv.URL, nil, nil, &out)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrServer || apiErr.Message != "Provider returned error" {
+		t.Errorf("err = %v, want the payload's server error", err)
+	}
+}
+
+func TestExecutorMalformedJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"choices": [`)
+	}))
+	defer srv.Close()
+
+	x := &executor{client: srv.Client(), maxRetries: 3}
+	var out struct{}
+	err := x.postJSON(context.Background(), srv.URL, nil, nil, &out)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrMalformed {
+		t.Errorf("err = %v, want a malformed error", err)
+	}
+}
+
+func TestExecutorRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	x := &executor{client: srv.Client(), requestTimeout: 20 * time.Millisecond}
+	_, err := x.post(context.Background(), srv.URL, nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrTimeout {
+		t.Errorf("err = %v, want a timeout error", err)
+	}
+}
+
+func TestExecutorCancelledWhileWaiting(t *testing.T) {
+	srv, calls := flakyServer(t, 5, 429, "10000")
+	x := &executor{client: srv.Client(), maxRetries: 3}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := x.post(ctx, srv.URL, nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the Retry-After pause wasn't cut short")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d requests, want 1", calls.Load())
+	}
+}
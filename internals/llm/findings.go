@@ -0,0 +1,361 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// Severity levels, most severe first.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// Categories a finding can be filed under. Anything else becomes "other".
+var categories = []string{"correctness", "security", "performance", "readability", "maintainability", "other"}
+
+// errInvalidReview is returned when a model's answer can't be parsed as a
+// review even after repair attempts.
+var errInvalidReview = errors.New("model did not return a valid review")
+
+// maxRepairs is how many times a model is asked to fix output that isn't
+// valid findings JSON before giving up.
+const maxRepairs = 2
+
+// Finding is a single issue raised by a review.
+type Finding struct {
+	File       string `json:"file"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	Severity   string `json:"severity"`
+	Category   string `json:"category"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// Review is the structured result of reviewing a diff.
+type Review struct {
+	Summary  string    `json:"summary"`
+	Findings []Finding `json:"findings"`
+}
+
+// SeverityRank orders severities: critical is 0, unknown values sort last.
+func SeverityRank(s string) int {
+	switch s {
+	case SeverityCritical:
+		return 0
+	case SeverityWarning:
+		return 1
+	case SeverityInfo:
+		return 2
+	}
+	return 3
+}
+
+// Sort orders findings by severity, then file and line.
+func (r *Review) Sort() {
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if SeverityRank(a.Severity) != SeverityRank(b.Severity) {
+			return SeverityRank(a.Severity) < SeverityRank(b.Severity)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.StartLine < b.StartLine
+	})
+}
+
+// normalize fixes up harmless variations in a finding (casing, "[WARNING]"
+// style tags, reversed line ranges) and reports what can't be fixed.
+func (f *Finding) normalize() []string {
+	var problems []string
+
+	f.File = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(f.File), "a/"), "b/")
+	if f.File == "" {
+		problems = append(problems, "file is empty")
+	}
+
+	f.Severity = strings.ToLower(strings.Trim(strings.TrimSpace(f.Severity), "[]"))
+	switch f.Severity {
+	case SeverityCritical, SeverityWarning, SeverityInfo:
+	case "error", "high":
+		f.Severity = SeverityCritical
+	case "medium":
+		f.Severity = SeverityWarning
+	case "low", "suggestion", "nit":
+		f.Severity = SeverityInfo
+	default:
+		problems = append(problems, fmt.Sprintf("severity %q is not one of critical, warning, info", f.Severity))
+	}
+
+	f.Category = strings.ToLower(strings.TrimSpace(f.Category))
+	known := false
+	for _, c := range categories {
+		known = known || f.Category == c
+	}
+	if !known {
+		f.Category = "other"
+	}
+
+	if f.StartLine < 0 || f.EndLine < 0 {
+		problems = append(problems, "line numbers must not be negative")
+	}
+	if f.EndLine < f.StartLine {
+		f.EndLine = f.StartLine
+	}
+
+	f.Message = strings.TrimSpace(f.Message)
+	f.Suggestion = strings.TrimSpace(f.Suggestion)
+	if f.Message == "" {
+		problems = append(problems, "message is empty")
+	}
+	return problems
+}
+
+// parseReview decodes a model's answer into a Review. It tolerates code
+// fences and text around the JSON object. Findings that fail validation are
+// dropped from the result and described in problems, so the caller can
+// decide whether to ask for a repair.
+func parseReview(text string) (Review, []string, error) {
+	raw := extractJSON(text)
+	if raw == "" {
+		return Review{}, nil, errors.New("the response contains no JSON object")
+	}
+
+	var r Review
+	dec := json.NewDecoder(strings.NewReader(raw))
+	if err := dec.Decode(&r); err != nil {
+		return Review{}, nil, fmt.Errorf("the response is not valid JSON for the schema: %v", err)
+	}
+
+	var problems []string
+	valid := r.Findings[:0]
+	for i, f := range r.Findings {
+		if p := f.normalize(); len(p) > 0 {
+			problems = append(problems, fmt.Sprintf("findings[%d]: %s", i, strings.Join(p, "; ")))
+			continue
+		}
+		valid = append(valid, f)
+	}
+	r.Findings = valid
+	r.Summary = strings.TrimSpace(r.Summary)
+	return r, problems, nil
+}
+
+// extractJSON returns the outermost {...} in text, or "" if there is none.
+func extractJSON(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return ""
+	}
+	return text[start : end+1]
+}
+
+// completeReview runs a review request and returns its findings. If the
+// answer isn't valid findings JSON, the model is shown its answer and the
+// problems and asked to correct it, up to maxRepairs times. When repairs run
+// out, whatever findings did validate are returned.
+//
+// A streamed review that is interrupted returns what had streamed in.
+func completeReview(ctx context.Context, cfg config.RevlyConfig, apiKey string, req ChatRequest, onProgress func(Review)) (Review, error) {
+	req.JSON = true
+
+	var onChunk func(string)
+	scan := &findingScanner{}
+	if onProgress != nil {
+		onChunk = func(chunk string) {
+			if scan.Write(chunk) {
+				onProgress(scan.Review())
+			}
+		}
+	}
+
+	text, err := completeWithTools(ctx, cfg, apiKey, "review", req, toolsFrom(ctx), onChunk)
+	if err != nil {
+		return scan.Review(), err
+	}
+
+	review, problems, err := parseReview(text)
+	for attempt := 0; attempt < maxRepairs && (err != nil || len(problems) > 0); attempt++ {
+		if err != nil {
+			problems = []string{err.Error()}
+		}
+		repair := req
+		repair.Messages = append(append([]Message{}, req.Messages...),
+			Message{Role: "assistant", Content: text},
+			Message{Role: "user", Content: fmt.Sprintf(repairUserPrompt, "- "+strings.Join(problems, "\n- "))},
+		)
+
+		var rerr error
+		text, rerr = complete(ctx, cfg, apiKey, "review", repair, nil)
+		if rerr != nil {
+			return Review{}, rerr
+		}
+		review, problems, err = parseReview(text)
+	}
+	if err != nil {
+		return Review{}, fmt.Errorf("%w after %d repair attempts: %v", errInvalidReview, maxRepairs, err)
+	}
+
+	review.Sort()
+	return review, nil
+}
+
+// findingScanner picks the summary and complete findings out of a review
+// that is still streaming in, so they can be shown before the JSON closes.
+// The final answer is parsed again in full; this is only for display.
+type findingScanner struct {
+	buf      strings.Builder
+	summary  string
+	findings []Finding
+
+	summaryDone bool
+	pos         int // offset of the next unread finding, 0 until the array starts
+	done        bool
+}
+
+// Write adds a chunk and reports whether anything new was found.
+func (s *findingScanner) Write(chunk string) bool {
+	s.buf.WriteString(chunk)
+	text := s.buf.String()
+	changed := false
+
+	if !s.summaryDone {
+		if lit, ok := stringValue(text, `"summary"`); ok {
+			_ = json.Unmarshal([]byte(lit), &s.summary)
+			s.summaryDone = true
+			changed = true
+		}
+	}
+
+	if s.pos == 0 {
+		i := strings.Index(text, `"findings"`)
+		if i < 0 {
+			return changed
+		}
+		j := strings.IndexByte(text[i:], '[')
+		if j < 0 {
+			return changed
+		}
+		s.pos = i + j + 1
+	}
+
+	for !s.done {
+		rest := strings.TrimLeft(text[s.pos:], " \t\r\n,")
+		if rest == "" {
+			break
+		}
+		if rest[0] == ']' {
+			s.done = true
+			break
+		}
+		offset := len(text) - len(rest)
+		end := objectEnd(rest)
+		if end < 0 {
+			break
+		}
+		var f Finding
+		if json.Unmarshal([]byte(rest[:end]), &f) == nil && len(f.normalize()) == 0 {
+			s.findings = append(s.findings, f)
+			changed = true
+		}
+		s.pos = offset + end
+	}
+	return changed
+}
+
+// Review returns what has been parsed so far.
+func (s *findingScanner) Review() Review {
+	return Review{Summary: s.summary, Findings: append([]Finding(nil), s.findings...)}
+}
+
+// stringValue finds key in text and returns the complete JSON string literal
+// that follows it, if it has arrived yet.
+func stringValue(text, key string) (string, bool) {
+	i := strings.Index(text, key)
+	if i < 0 {
+		return "", false
+	}
+	rest := strings.TrimLeft(text[i+len(key):], " \t\r\n:")
+	if rest == "" || rest[0] != '"' {
+		return "", false
+	}
+	for j := 1; j < len(rest); j++ {
+		switch rest[j] {
+		case '\\':
+			j++
+		case '"':
+			return rest[:j+1], true
+		}
+	}
+	return "", false
+}
+
+// objectEnd returns the length of the JSON object at the start of s, or -1
+// if it isn't complete yet.
+func objectEnd(s string) int {
+	if s[0] != '{' {
+		return -1
+	}
+	depth := 0
+	inString := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+const findingsSchema = `Respond with a single JSON object and nothing else, no markdown fences. Use exactly this shape:
+{
+  "summary": "<markdown overview of the change>",
+  "findings": [
+    {
+      "file": "<path as shown in the diff, without a/ or b/>",
+      "start_line": <first line in the new version of the file, 0 if the finding is about the whole file>,
+      "end_line": <last line, same as start_line for a single line>,
+      "severity": "critical" | "warning" | "info",
+      "category": "correctness" | "security" | "performance" | "readability" | "maintainability" | "other",
+      "message": "<what is wrong and why, in markdown>",
+      "suggestion": "<actionable fix, in markdown; may include a code snippet>"
+    }
+  ]
+}
+Severity levels:
+critical: functional bugs, security issues, or performance bottlenecks that must be fixed.
+warning: bad practices, readability or maintainability concerns that should be addressed.
+info: optional improvements, style suggestions, or minor clarity enhancements.
+If there is nothing to report, return an empty findings array.`
+
+const repairUserPrompt = `Your previous response could not be used:
+%s
+
+Reply again with the corrected JSON object only, following the required schema exactly.`
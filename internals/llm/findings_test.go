@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReview(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		want     Review
+		problems []string
+		err      string
+	}{
+		{
+			name: "plain JSON",
+			text: `{"summary": "Looks fine.", "findings": []}`,
+			want: Review{Summary: "Looks fine.", Findings: []Finding{}},
+		},
+		{
+			name: "code fence and prose around it",
+			text: "Here is my review:\n```json\n{\"summary\": \" Two issues. \", \"findings\": [" +
+				`{"file": "main.go", "start_line": 3, "end_line": 4, "severity": "warning", "category": "correctness", "message": "Unchecked error."}` +
+				"]}\n```\nHope it helps!",
+			want: Review{Summary: "Two issues.", Findings: []Finding{
+				{File: "main.go", StartLine: 3, EndLine: 4, Severity: "warning", Category: "correctness", Message: "Unchecked error."},
+			}},
+		},
+		{
+			name: "harmless variations are normalized",
+			text: `{"summary": "s", "findings": [` +
+				`{"file": "b/cmd/root.go", "start_line": 9, "end_line": 2, "severity": "[HIGH]", "category": "Security", "message": " Injection. ", "suggestion": " Quote it. "},` +
+				`{"file": "a/x.go", "severity": "nit", "category": "style", "message": "Rename."}` +
+				`]}`,
+			want: Review{Summary: "s", Findings: []Finding{
+				{File: "cmd/root.go", StartLine: 9, EndLine: 9, Severity: "critical", Category: "security", Message: "Injection.", Suggestion: "Quote it."},
+				{File: "x.go", Severity: "info", Category: "other", Message: "Rename."},
+			}},
+		},
+		{
+			name: "invalid findings are dropped and described",
+			text: `{"summary": "s", "findings": [` +
+				`{"file": "", "severity": "warning", "message": "No file."},` +
+				`{"file": "a.go", "severity": "urgent", "message": "Odd severity."},` +
+				`{"file": "a.go", "start_line": -1, "severity": "info", "message": ""},` +
+				`{"file": "ok.go", "severity": "info", "message": "Fine."}` +
+				`]}`,
+			want: Review{Summary: "s", Findings: []Finding{
+				{File: "ok.go", Severity: "info", Category: "other", Message: "Fine."},
+			}},
+			problems: []string{
+				"findings[0]: file is empty",
+				`findings[1]: severity "urgent" is not one of critical, warning, info`,
+				"findings[2]: line numbers must not be negative; message is empty",
+			},
+		},
+		{
+			name: "no JSON at all",
+			text: "I could not review this diff.",
+			err:  "no JSON object",
+		},
+		{
+			name: "wrong shape",
+			text: `{"summary": "s", "findings": "none"}`,
+			err:  "not valid JSON for the schema",
+		},
+		{
+			name: "truncated JSON",
+			text: `{"summary": "s", "findings": [{"file": "a.go"}`,
+			err:  "not valid JSON",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problems, err := parseReview(tt.text)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("review = %+v\nwant %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Errorf("problems = %q\nwant %q", problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestReviewSort(t *testing.T) {
+	r := Review{Findings: []Finding{
+		{File: "b.go", StartLine: 1, Severity: "info"},
+		{File: "b.go", StartLine: 9, Severity: "critical"},
+		{File: "a.go", StartLine: 5, Severity: "warning"},
+		{File: "a.go", StartLine: 2, Severity: "critical"},
+	}}
+	r.Sort()
+	var got []string
+	for _, f := range r.Findings {
+		got = append(got, f.Severity+" "+f.File)
+	}
+	want := []string{"critical a.go", "critical b.go", "warning a.go", "info b.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted = %q, want %q", got, want)
+	}
+}
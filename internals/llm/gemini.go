@@ -0,0 +1,209 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// geminiProvider talks to Google's native generateContent API.
+type geminiProvider struct {
+	x      *executor
+	base   string
+	apiKey string
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	Tools             []geminiTool    `json:"tools,omitempty"`
+	GenerationConfig  *geminiConfig   `json:"generationConfig,omitempty"`
+}
+
+type geminiConfig struct {
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func newGeminiProvider(x *executor, base, apiKey string) *geminiProvider {
+	return &geminiProvider{x: x, base: base, apiKey: apiKey}
+}
+
+func (p *geminiProvider) Name() string { return "gemini" }
+
+func (p *geminiProvider) Complete(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent", p.base, url.PathEscape(req.Model))
+
+	var out geminiResponse
+	if err := p.x.postJSON(ctx, endpoint, p.headers(), newGeminiRequest(req), &out); err != nil {
+		return ChatResponse{}, err
+	}
+	if len(out.Candidates) == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	return ChatResponse{Model: req.Model, Content: out.text(), ToolCalls: out.toolCalls(), Usage: out.usage()}, nil
+}
+
+func (p *geminiProvider) Stream(ctx context.Context, req ChatRequest, onChunk func(string)) (ChatResponse, error) {
+	endpoint := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", p.base, url.PathEscape(req.Model))
+
+	resp, err := p.x.post(ctx, endpoint, p.headers(), newGeminiRequest(req))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var usage Usage
+	err = readSSE(resp.Body, func(_, data string) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return malformed("invalid stream chunk: %v", err)
+		}
+		// Every chunk carries the running totals; the last one wins.
+		if chunk.UsageMetadata != nil {
+			usage = chunk.usage()
+		}
+		if text := chunk.text(); text != "" {
+			content.WriteString(text)
+			onChunk(text)
+		}
+		return nil
+	})
+	if err != nil {
+		return ChatResponse{Model: req.Model, Content: content.String()}, err
+	}
+	if content.Len() == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	return ChatResponse{Model: req.Model, Content: content.String(), Usage: usage}, nil
+}
+
+func (p *geminiProvider) headers() map[string]string {
+	return map[string]string{"x-goog-api-key": p.apiKey}
+}
+
+func (r geminiResponse) usage() Usage {
+	if r.UsageMetadata == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: r.UsageMetadata.PromptTokenCount, CompletionTokens: r.UsageMetadata.CandidatesTokenCount}
+}
+
+// text joins the parts of the first candidate.
+func (r geminiResponse) text() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// toolCalls returns the function calls in the first candidate. Gemini
+// doesn't give them IDs.
+func (r geminiResponse) toolCalls() []ToolCall {
+	if len(r.Candidates) == 0 {
+		return nil
+	}
+	var calls []ToolCall
+	for i, part := range r.Candidates[0].Content.Parts {
+		if part.FunctionCall != nil {
+			calls = append(calls, ToolCall{ID: toolCallID("", i), Name: part.FunctionCall.Name, Arguments: part.FunctionCall.Args})
+		}
+	}
+	return calls
+}
+
+// newGeminiRequest maps chat roles onto Gemini's user/model contents. Tool
+// results go back as functionResponse parts of a user turn.
+func newGeminiRequest(req ChatRequest) geminiRequest {
+	var body geminiRequest
+	if req.System != "" {
+		body.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: req.System}}}
+	}
+	for _, m := range req.Messages {
+		switch {
+		case m.Role == "tool":
+			part := geminiPart{FunctionResponse: &geminiFunctionResponse{Name: m.ToolName, Response: map[string]any{"content": m.Content}}}
+			if n := len(body.Contents); n > 0 && body.Contents[n-1].Parts[0].FunctionResponse != nil {
+				body.Contents[n-1].Parts = append(body.Contents[n-1].Parts, part)
+				continue
+			}
+			body.Contents = append(body.Contents, geminiContent{Role: "user", Parts: []geminiPart{part}})
+		case m.Role == "assistant":
+			var parts []geminiPart
+			if m.Content != "" || len(m.ToolCalls) == 0 {
+				parts = append(parts, geminiPart{Text: m.Content})
+			}
+			for _, c := range m.ToolCalls {
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: c.Name, Args: toolArguments(c.Arguments)}})
+			}
+			body.Contents = append(body.Contents, geminiContent{Role: "model", Parts: parts})
+		default:
+			body.Contents = append(body.Contents, geminiContent{Role: "user", Parts: []geminiPart{{Text: m.Content}}})
+		}
+	}
+	if len(req.Tools) > 0 {
+		var decls []geminiFunctionDeclaration
+		for _, t := range req.Tools {
+			decls = append(decls, geminiFunctionDeclaration{Name: t.Name, Description: t.Description, Parameters: t.Parameters})
+		}
+		body.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+	gen := geminiConfig{Temperature: req.Temperature, MaxOutputTokens: req.MaxTokens}
+	// Gemini rejects a JSON response type together with function calling.
+	if req.JSON && len(req.Tools) == 0 {
+		gen.ResponseMimeType = "application/json"
+	}
+	if gen != (geminiConfig{}) {
+		body.GenerationConfig = &gen
+	}
+	return body
+}
@@ -1,184 +1,232 @@
 package llm
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"net/http"
-	"os"
+	"time"
 
 	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/prompts"
+	"github.com/nareshkarthigeyan/revly/internals/usage"
 )
 
-type Request struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-}
+func GetLLMResponse(ctx context.Context, prompt string) (string, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", err
+	}
 
-type Response struct {
-	Choices []struct {
-		Message Message `json:"message"`
-	} `json:"choices"`
-}
+	key, err := resolveKey(cfg.LLM)
+	if err != nil {
+		return "", err
+	}
 
-func GetLLMResponse(prompt string) (string, error) {
-	loadEnv() // Load environment variables
+	system, err := systemPrompt(cfg, "commit")
+	if err != nil {
+		return "", err
+	}
 
+	ctx, cancel := withTimeout(ctx, cfg, "commit")
+	defer cancel()
+
+	return complete(ctx, cfg, key, "commit", newRequest(system, prompt), nil)
+}
+
+func GetPairProgrammingComment(ctx context.Context, diff string) (string, error) {
 	cfg, err := config.GetConfig()
 	if err != nil {
 		return "", err
 	}
 
-	endpoint := cfg.LLM.Endpoint
-	models := cfg.LLM.Models
-	key := os.Getenv("LLM_API_KEY")
-	if key == "" {
-		return "", errors.New("LLM_API_KEY not set")
+	key, err := resolveKey(cfg.LLM)
+	if err != nil {
+		return "", err
 	}
 
-	for _, model := range models {
-		reqBody := Request{
-			Model: model,
-			Messages: []Message{
-				{
-					Role: "system",
-					Content: `You are an expert Git user. Your task is to output a concise, single-line, conventional commit message based on a provided Git diff.\nOnly return a commit message in the format: <type>(optional scope): <description>\nNEVER provide explanation, suggestions, or additional lines. Do NOT add any text before or after the commit message. No multiple lines. No summaries.\nTypes: feat, fix, refactor, docs, style, test, chore\nHere is the staged diff:`, 
-				},
-				{Role: "user", Content: prompt},
-			},
-		}
-
-		b, err := json.Marshal(reqBody)
-		if err != nil {
-			continue
-		}
+	system, err := systemPrompt(cfg, "pair")
+	if err != nil {
+		return "", err
+	}
 
-		req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(b))
-		if err != nil {
-			continue
-		}
+	ctx, cancel := withTimeout(ctx, cfg, "pair")
+	defer cancel()
 
-		req.Header.Set("Authorization", "Bearer "+key)
-		req.Header.Set("Content-Type", "application/json")
+	return complete(ctx, cfg, key, "pair", newRequest(system, fmt.Sprintf("Code:\n%s", diff)), nil)
+}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			continue
-		}
-		defer resp.Body.Close()
+// systemPrompt renders the named prompt template. The findings schema is
+// appended to the review prompts rather than kept in the templates, so an
+// override can't break parsing; so is the note on tools when they're enabled.
+func systemPrompt(cfg config.RevlyConfig, name string) (string, error) {
+	system, err := prompts.Render(cfg.Prompts, name)
+	if err != nil {
+		return "", err
+	}
+	if name == "review" && cfg.Review.Tools.Enabled {
+		system += "\n\n" + fmt.Sprintf(toolsPrompt, cfg.Review.Tools.MaxCalls)
+	}
+	if name == "review" || name == "reduce" {
+		system += "\n\n" + findingsSchema
+	}
+	return system, nil
+}
 
-		var out Response
-		err = json.NewDecoder(resp.Body).Decode(&out)
+// PromptVersion is a short hash of what goes into the system prompts a task
+// sends: the templates, overrides included, the guidelines, and what is
+// appended to the review prompts. It also covers the [redact] settings, which
+// change what the model sees of the diff. The variables describing the
+// checkout, its name, branch and language, are left out, so the same diff gets
+// the same cached answer on any branch and in any clone.
+func PromptVersion(cfg config.RevlyConfig, task string) (string, error) {
+	names := []string{task}
+	if task == "review" {
+		names = append(names, "reduce")
+	}
+	h := sha256.New()
+	for _, name := range names {
+		t, err := prompts.Load(cfg.Prompts, name)
 		if err != nil {
-			continue
+			return "", err
 		}
-
-		if len(out.Choices) > 0 {
-			return out.Choices[0].Message.Content, nil
+		h.Write([]byte(t.Source))
+		h.Write([]byte{0})
+	}
+	guidelines, err := prompts.Guidelines(cfg.Prompts)
+	if err != nil {
+		return "", err
+	}
+	h.Write([]byte(guidelines))
+	h.Write([]byte{0})
+	if task == "review" {
+		if cfg.Review.Tools.Enabled {
+			fmt.Fprintf(h, toolsPrompt, cfg.Review.Tools.MaxCalls)
 		}
+		h.Write([]byte(findingsSchema))
 	}
-	return "", errors.New("all LLM models failed to respond successfully")
+	r := cfg.Redact
+	fmt.Fprintf(h, "%s\x00%q\x00%q\x00%t", r.Mode, r.Patterns, r.Allow, r.Entropy)
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
 }
 
-func GetPairProgrammingComment(diff string) (string, error) {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return "", err
+// newRequest is a single-turn request; the model is filled in by complete.
+func newRequest(system, user string) ChatRequest {
+	return ChatRequest{System: system, Messages: []Message{{Role: "user", Content: user}}}
+}
+
+// withTimeout bounds all the LLM calls one command makes by the task's
+// timeout, which defaults to [llm] timeout.
+func withTimeout(ctx context.Context, cfg config.RevlyConfig, task string) (context.Context, context.CancelFunc) {
+	if timeout := cfg.Task(task).Timeout; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
 	}
+	return context.WithCancel(ctx)
+}
 
-	endpoint := cfg.LLM.Endpoint
-	models := cfg.LLM.Models
-	key := os.Getenv("LLM_API_KEY")
-	if key == "" {
-		return "", errors.New("LLM_API_KEY not set")
-	}
-
-	for _, model := range models {
-		reqBody := Request{
-			Model: model,
-			Messages: []Message{
-				{
-					Role:    "system",
-					Content: `You are an expert software engineer acting as a **pair programming assistant**. Your job is to review small code changes in real-time as a developer is typing.
-
-You will receive a code diff from a Git working directory. It will look like:
-
-diff
-diff --git a/main.go b/main.go
-index 1a2b3c..4d5e6f 100644
---- a/main.go
-+++ b/main.go
-@@ func myFunction() {
--   result := doSomething(x, y)
-+   result := doSomething(x, y)
-+   log.Printf("Result: %v", result)
+// complete tries each of the task's models in order and returns the first
+// answer.
+// Transient failures are already retried by the executor; whatever reaches
+// this loop moves on to the next model, except auth errors which stop it.
+// When onChunk is non-nil the answer is streamed to it as it arrives; a model
+// is only skipped if it fails before producing any output, since text already
+// shown to the user can't be taken back.
+//
+// If ctx is cancelled or times out mid-stream, whatever was received is
+// returned with the error.
+//
+// Every successful call is recorded in the usage ledger under task.
+//
+// Secrets in the request are redacted first; see redactRequest.
+func complete(ctx context.Context, cfg config.RevlyConfig, apiKey, task string, req ChatRequest, onChunk func(string)) (string, error) {
+	resp, err := completeResponse(ctx, cfg, apiKey, task, req, onChunk)
+	return resp.Content, err
 }
-Your job is to return a single, concise, high-signal suggestion or observation — max 20 words. This is not a full code review, but a lightweight, contextual nudge like a coding partner might give.
-
-Focus on:
-	•	readability
-	•	naming
-	•	small bug risks
-	•	redundant logic
-	•	performance
-	•	unused code
-	•	missing edge cases
-	•	security issues
-	•	any other small improvements
-Avoid:
-	•	large architectural changes
-	•	major refactors
-	•	overly complex suggestions
-	•	anything that requires deep context beyond the diff
-	•	anything that would require a full code review
-
-					Format your response as a single line comment, like this:
-					Have a brief greeting, or a follow up question if appropriate.
-					Keep it short, actionable, and relevant to the diff provided. No explanations, just the comment itself.
-					Don’t suggest changes that are already present in the diff.
-`,
-				},
-				{Role: "user", Content: fmt.Sprintf("Code:\n%s", diff)},
-			},
-		}
 
-		b, err := json.Marshal(reqBody)
-		if err != nil {
-			fmt.Printf("Error marshaling request for model %s: %v\n", model, err)
-			continue
+// completeResponse is complete returning the whole response, tool calls
+// included.
+func completeResponse(ctx context.Context, cfg config.RevlyConfig, apiKey, task string, req ChatRequest, onChunk func(string)) (ChatResponse, error) {
+	provider, err := NewProvider(cfg.LLM, apiKey)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	if req, err = redactRequest(cfg, req); err != nil {
+		return ChatResponse{}, err
+	}
+	route := cfg.Task(task)
+	if len(route.Models) == 0 {
+		return ChatResponse{}, fmt.Errorf("no models configured for %s (set [llm] models or [models.%s] models)", task, task)
+	}
+	req.Temperature = route.Temperature
+	req.MaxTokens = route.MaxTokens
+
+	var errs []error
+	for _, model := range route.Models {
+		req.Model = model
+		start := time.Now()
+		var resp ChatResponse
+		if onChunk == nil {
+			resp, err = provider.Complete(ctx, req)
+		} else {
+			resp, err = provider.Stream(ctx, req, onChunk)
 		}
-
-		req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(b))
-		if err != nil {
-			fmt.Printf("Error creating request for model %s: %v\n", model, err)
-			continue
+		if ctx.Err() != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return resp, fmt.Errorf("LLM calls did not finish within %s ([llm] timeout or [models.%s] timeout): %w", route.Timeout, task, ctx.Err())
+			}
+			return resp, ctx.Err()
 		}
-
-		req.Header.Set("Authorization", "Bearer "+key)
-		req.Header.Set("Content-Type", "application/json")
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Printf("Error calling LLM model %s: %v\n", model, err)
-			continue
+		if err != nil && resp.Content != "" {
+			return resp, fmt.Errorf("%s: stream interrupted: %w", model, err)
 		}
-		defer resp.Body.Close()
-
-		var out Response
-		err = json.NewDecoder(resp.Body).Decode(&out)
 		if err != nil {
-			fmt.Printf("Error decoding response from model %s: %v\n", model, err)
+			// Every model shares the same key, so there's no point trying the rest.
+			if IsAuthError(err) {
+				return ChatResponse{}, fmt.Errorf("%s rejected the API key (run 'revly auth status' to see where it came from): %w", provider.Name(), err)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", model, err))
 			continue
 		}
+		u := recordUsage(cfg, provider.Name(), task, req, resp, time.Since(start))
+		if t, ok := ctx.Value(tallyKey{}).(*Tally); ok {
+			t.add(model, u)
+		}
+		return resp, nil
+	}
+
+	return ChatResponse{}, fmt.Errorf("all LLM models failed to respond successfully: %w", errors.Join(errs...))
+}
 
-		if len(out.Choices) > 0 {
-			return out.Choices[0].Message.Content, nil
+// recordUsage appends a call to the usage ledger, estimating token counts
+// the provider didn't report, and returns the counts it recorded. The ledger
+// is best effort and never fails a call.
+func recordUsage(cfg config.RevlyConfig, provider, task string, req ChatRequest, resp ChatResponse, latency time.Duration) Usage {
+	u := resp.Usage
+	estimated := false
+	if u.PromptTokens == 0 {
+		prompt := req.System
+		for _, m := range req.Messages {
+			prompt += m.Content
 		}
-		fmt.Printf("Model %s returned no choices.\n", model)
+		u.PromptTokens = estimateTokens(req.Model, prompt)
+		estimated = true
+	}
+	if u.CompletionTokens == 0 {
+		u.CompletionTokens = estimateTokens(req.Model, resp.Content)
+		estimated = true
 	}
 
-	return "", errors.New("all LLM models failed to respond successfully")
+	_ = usage.Append(usage.Record{
+		Time:             time.Now(),
+		Command:          task,
+		Provider:         provider,
+		Model:            req.Model,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		Estimated:        estimated,
+		LatencyMs:        latency.Milliseconds(),
+		CostUSD:          usage.Cost(cfg.Pricing, req.Model, u.PromptTokens, u.CompletionTokens),
+	})
+	return u
 }
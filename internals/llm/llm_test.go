@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nareshkarthigeyan/revly/internals/cache"
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// printKeyEnv makes TestCacheKeyIgnoresTheCheckout print the review cache
+// key for the checkout it runs in.
+const printKeyEnv = "REVLY_TEST_PRINT_KEY"
+
+// TestCacheKeyIgnoresTheCheckout reviews the same diff on two branches of
+// differently named clones, which must share a cache key. The repository
+// name and branch are looked up once per process, so each checkout gets a
+// child process of its own.
+func TestCacheKeyIgnoresTheCheckout(t *testing.T) {
+	if os.Getenv(printKeyEnv) != "" {
+		printCacheKey(t)
+		return
+	}
+	cfg, err := os.ReadFile("revly.config.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	main := filepath.Join(dir, "revly")
+	clone := filepath.Join(dir, "revly-fork")
+	if err := os.MkdirAll(main, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"revly.config.toml": string(cfg), "main.go": "package main\n"} {
+		if err := os.WriteFile(filepath.Join(main, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git(t, main, "init", "-q", "-b", "main")
+	git(t, main, "add", ".")
+	git(t, main, "commit", "-q", "-m", "Initial commit")
+	git(t, dir, "clone", "-q", main, clone)
+	git(t, clone, "checkout", "-q", "-b", "feature/greeting")
+
+	onMain, onBranch := cacheKeyIn(t, main), cacheKeyIn(t, clone)
+	if onMain != onBranch {
+		t.Errorf("the same diff has key %s on main and %s on a branch of a clone", onMain, onBranch)
+	}
+
+	guidelines := string(cfg) + "\n[prompts]\nguidelines = \"Be strict.\"\n"
+	if err := os.WriteFile(filepath.Join(clone, "revly.config.toml"), []byte(guidelines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cacheKeyIn(t, clone) == onMain {
+		t.Error("changing the guidelines kept the cache key")
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com",
+		"GIT_COMMITTER_NAME=Ada", "GIT_COMMITTER_EMAIL=ada@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+var keyLine = regexp.MustCompile(`(?m)^key=([0-9a-f]+)$`)
+
+func cacheKeyIn(t *testing.T, dir string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCacheKeyIgnoresTheCheckout$")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), printKeyEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	m := keyLine.FindSubmatch(out)
+	if err != nil || m == nil {
+		t.Fatalf("computing the cache key in %s: %v\n%s", dir, err, out)
+	}
+	return string(m[1])
+}
+
+func printCacheKey(t *testing.T) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := PromptVersion(cfg, "review")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("key=%s\n", cache.Key("review", cfg.Task("review").Models, version, []byte(testReviewDiff)))
+}
+
+func TestPromptVersionCoversRedaction(t *testing.T) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := func(cfg config.RevlyConfig) string {
+		t.Helper()
+		v, err := PromptVersion(cfg, "review")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	base := version(cfg)
+	if version(cfg) != base {
+		t.Fatal("the same config has two prompt versions")
+	}
+	changes := map[string]func(*config.RedactConfig){
+		"mode":     func(r *config.RedactConfig) { r.Mode = "off" },
+		"patterns": func(r *config.RedactConfig) { r.Patterns = append(r.Patterns, `token=(\w+)`) },
+		"allow":    func(r *config.RedactConfig) { r.Allow = append(r.Allow, `test-key`) },
+		"entropy":  func(r *config.RedactConfig) { r.Entropy = !r.Entropy },
+	}
+	for name, change := range changes {
+		changed := cfg
+		changed.Redact.Patterns = append([]string(nil), cfg.Redact.Patterns...)
+		changed.Redact.Allow = append([]string(nil), cfg.Redact.Allow...)
+		change(&changed.Redact)
+		if version(changed) == base {
+			t.Errorf("changing [redact] %s kept the prompt version", name)
+		}
+	}
+}
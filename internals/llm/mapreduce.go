@@ -0,0 +1,217 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// maxReduceRounds caps how many times partial reviews are merged in groups
+// before the final pass, in case they don't shrink.
+const maxReduceRounds = 3
+
+// reviewInChunks reviews a diff that is too large for one request. Each
+// chunk is reviewed on its own, several at a time (the map step), then the
+// partial reviews are merged and de-duplicated into one report (the reduce
+// step). Only the final reduce call streams to onProgress.
+//
+// If ctx is cancelled or times out, the parts reviewed so far are merged
+// without a model and returned with the error.
+func reviewInChunks(ctx context.Context, cfg config.RevlyConfig, apiKey, system string, chunks, files []string, progress func(string), onProgress func(Review)) (Review, error) {
+	partials := make([]Review, len(chunks))
+	var done atomic.Int32
+
+	errs := runConcurrently(ctx, len(chunks), cfg.Review.Concurrency, func(ctx context.Context, i int) error {
+		user := fmt.Sprintf(chunkUserPrompt, i+1, len(chunks), chunks[i])
+		review, err := completeReview(ctx, cfg, apiKey, newRequest(system, user), nil)
+		partials[i] = review
+		progress(fmt.Sprintf(" Reviewed part %d of %d...", done.Add(1), len(chunks)))
+		return err
+	})
+	if ctx.Err() != nil {
+		var reviewed []Review
+		for i, err := range errs {
+			if err == nil {
+				reviewed = append(reviewed, partials[i])
+			}
+		}
+		return mergeReviews(reviewed), ctx.Err()
+	}
+
+	var parts []string
+	var reviewed []Review
+	var failed []error
+	for i := range chunks {
+		if errs[i] != nil {
+			if IsAuthError(errs[i]) {
+				return Review{}, errs[i]
+			}
+			failed = append(failed, fmt.Errorf("part %d: %w", i+1, errs[i]))
+			parts = append(parts, fmt.Sprintf("## Part %d of %d\n\n(This part could not be reviewed: %v)", i+1, len(chunks), errs[i]))
+			continue
+		}
+		data, _ := json.Marshal(partials[i])
+		parts = append(parts, fmt.Sprintf("## Part %d of %d\n\n%s", i+1, len(chunks), data))
+		reviewed = append(reviewed, partials[i])
+	}
+	if len(failed) == len(chunks) {
+		return Review{}, fmt.Errorf("no part of the diff could be reviewed: %w", errors.Join(failed...))
+	}
+
+	progress(" Merging partial reviews...")
+	review, err := reduceReviews(ctx, cfg, apiKey, parts, files, onProgress)
+	if ctx.Err() != nil {
+		return mergeReviews(reviewed), err
+	}
+	if errors.Is(err, errInvalidReview) {
+		// The findings themselves are fine; only the merge failed.
+		return mergeReviews(reviewed), nil
+	}
+	return review, err
+}
+
+// reduceReviews merges partial reviews into one. If they don't fit in a
+// single request they are merged in groups first.
+func reduceReviews(ctx context.Context, cfg config.RevlyConfig, apiKey string, parts, files []string, onProgress func(Review)) (Review, error) {
+	ctx = withoutTools(ctx)
+	system, err := systemPrompt(cfg, "reduce")
+	if err != nil {
+		return Review{}, err
+	}
+
+	budget := promptBudget(cfg, system)
+	fileList := truncateToTokens(strings.Join(files, "\n"), budget/10, func(s string) int { return maxTokens(cfg, s) })
+	budget -= maxTokens(cfg, fileList)
+
+	for round := 0; round < maxReduceRounds && maxTokens(cfg, strings.Join(parts, "\n\n")) > budget; round++ {
+		groups := packParts(parts, budget, func(s string) int { return maxTokens(cfg, s) })
+		if len(groups) == len(parts) {
+			break
+		}
+
+		merged := make([]string, len(groups))
+		errs := runConcurrently(ctx, len(groups), cfg.Review.Concurrency, func(ctx context.Context, i int) error {
+			user := fmt.Sprintf(reduceGroupUserPrompt, groups[i])
+			review, err := completeReview(ctx, cfg, apiKey, newRequest(system, user), nil)
+			data, _ := json.Marshal(review)
+			merged[i] = string(data)
+			return err
+		})
+		for i, err := range errs {
+			if err != nil {
+				return Review{}, fmt.Errorf("merging partial reviews (group %d): %w", i+1, err)
+			}
+		}
+		parts = merged
+	}
+
+	user := fmt.Sprintf(reduceUserPrompt, fileList, strings.Join(parts, "\n\n"))
+	return completeReview(ctx, cfg, apiKey, newRequest(system, user), onProgress)
+}
+
+// mergeReviews combines partial reviews without a model, dropping findings
+// that are exact duplicates. It is the fallback when the reduce step fails.
+func mergeReviews(reviews []Review) Review {
+	var out Review
+	var summaries []string
+	seen := map[string]bool{}
+	for _, r := range reviews {
+		if r.Summary != "" {
+			summaries = append(summaries, r.Summary)
+		}
+		for _, f := range r.Findings {
+			key := fmt.Sprintf("%s:%d:%d:%s", f.File, f.StartLine, f.EndLine, strings.ToLower(f.Message))
+			if !seen[key] {
+				seen[key] = true
+				out.Findings = append(out.Findings, f)
+			}
+		}
+	}
+	out.Summary = strings.Join(summaries, "\n\n")
+	out.Sort()
+	return out
+}
+
+// packParts joins consecutive parts into groups of at most budget tokens.
+func packParts(parts []string, budget int, count func(string) int) []string {
+	var groups []string
+	var cur strings.Builder
+	used := 0
+	for _, p := range parts {
+		n := count(p)
+		if used > 0 && used+n > budget {
+			groups = append(groups, cur.String())
+			cur.Reset()
+			used = 0
+		}
+		if used > 0 {
+			cur.WriteString("\n\n")
+		}
+		cur.WriteString(p)
+		used += n
+	}
+	if cur.Len() > 0 {
+		groups = append(groups, cur.String())
+	}
+	return groups
+}
+
+// runConcurrently calls fn for 0..n-1 with at most limit calls in flight and
+// returns each call's error. An auth error cancels the calls not yet started,
+// since they would fail the same way.
+func runConcurrently(ctx context.Context, n, limit int, fn func(ctx context.Context, i int) error) []error {
+	if limit < 1 {
+		limit = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, n)
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			if ctx.Err() != nil {
+				errs[i] = ctx.Err()
+				return
+			}
+			errs[i] = fn(ctx, i)
+			if IsAuthError(errs[i]) {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+const chunkUserPrompt = `This diff was too large to review in one pass, so it has been split by file. This is part %d of %d.
+Review only the changes shown here. Keep the summary to one or two sentences about this part, without a greeting.
+
+%s`
+
+const reduceGroupUserPrompt = `Merge these partial reviews of one large diff into a single review. Merge duplicate findings, and keep the summary to a few sentences without a greeting.
+
+%s`
+
+const reduceUserPrompt = `Files changed in this diff:
+%s
+
+Partial reviews:
+
+%s`
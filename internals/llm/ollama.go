@@ -0,0 +1,140 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// ollamaProvider talks to Ollama's native /api/chat endpoint. It needs no key.
+type ollamaProvider struct {
+	x        *executor
+	endpoint string
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []openAITool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Format   string          `json:"format,omitempty"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+// ollamaMessage is a Message in Ollama's format, which passes tool arguments
+// as an object rather than a string. Plain messages encode like Message.
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model   string        `json:"model"`
+	Message ollamaMessage `json:"message"`
+	Done    bool          `json:"done"`
+	Error   string        `json:"error"`
+
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+func (r ollamaResponse) usage() Usage {
+	return Usage{PromptTokens: r.PromptEvalCount, CompletionTokens: r.EvalCount}
+}
+
+func newOllamaProvider(x *executor, base string) *ollamaProvider {
+	return &ollamaProvider{x: x, endpoint: base + "/api/chat"}
+}
+
+func (p *ollamaProvider) Name() string { return "ollama" }
+
+func (p *ollamaProvider) Complete(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	var out ollamaResponse
+	if err := p.x.postJSON(ctx, p.endpoint, nil, p.body(req, false), &out); err != nil {
+		return ChatResponse{}, err
+	}
+	var calls []ToolCall
+	for i, c := range out.Message.ToolCalls {
+		calls = append(calls, ToolCall{ID: toolCallID("", i), Name: c.Function.Name, Arguments: c.Function.Arguments})
+	}
+	if out.Message.Content == "" && len(calls) == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	return ChatResponse{Model: req.Model, Content: out.Message.Content, ToolCalls: calls, Usage: out.usage()}, nil
+}
+
+// Stream reads Ollama's newline-delimited JSON stream.
+func (p *ollamaProvider) Stream(ctx context.Context, req ChatRequest, onChunk func(string)) (ChatResponse, error) {
+	resp, err := p.x.post(ctx, p.endpoint, nil, p.body(req, true))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var usage Usage
+	err = readLines(resp.Body, func(line string) error {
+		var chunk ollamaResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return malformed("invalid stream chunk: %v", err)
+		}
+		if chunk.Error != "" {
+			return streamError(chunk.Error, "")
+		}
+		if chunk.Done {
+			usage = chunk.usage()
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onChunk(chunk.Message.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return ChatResponse{Model: req.Model, Content: content.String()}, err
+	}
+	if content.Len() == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	return ChatResponse{Model: req.Model, Content: content.String(), Usage: usage}, nil
+}
+
+func (p *ollamaProvider) body(req ChatRequest, stream bool) ollamaRequest {
+	var messages []ollamaMessage
+	if req.System != "" {
+		messages = append(messages, ollamaMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		msg := ollamaMessage{Role: m.Role, Content: m.Content, ToolName: m.ToolName}
+		for _, c := range m.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name = c.Name
+			call.Function.Arguments = toolArguments(c.Arguments)
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		messages = append(messages, msg)
+	}
+	body := ollamaRequest{Model: req.Model, Messages: messages, Tools: openAITools(req.Tools), Stream: stream}
+	// Constraining the output to JSON keeps models from calling tools.
+	if req.JSON && len(req.Tools) == 0 {
+		body.Format = "json"
+	}
+	if req.Temperature != nil || req.MaxTokens > 0 {
+		body.Options = &ollamaOptions{Temperature: req.Temperature, NumPredict: req.MaxTokens}
+	}
+	return body
+}
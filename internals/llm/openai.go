@@ -0,0 +1,221 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// openAIProvider talks to the /chat/completions API used by OpenAI,
+// OpenRouter and most self-hosted gateways.
+type openAIProvider struct {
+	x        *executor
+	name     string
+	endpoint string
+	apiKey   string
+}
+
+type chatCompletionRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Tools          []openAITool    `json:"tools,omitempty"`
+	Stream         bool            `json:"stream"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+// chatMessage is a Message in the chat completions format. Plain messages
+// encode exactly like Message.
+type chatMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+		// Arguments is a JSON object encoded as a string.
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage *chatCompletionUsage `json:"usage"`
+}
+
+type chatCompletionChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *chatCompletionUsage `json:"usage"`
+	Error *struct {
+		Message string          `json:"message"`
+		Code    json.RawMessage `json:"code"`
+	} `json:"error"`
+}
+
+// newOpenAIProvider uses endpoint verbatim when set (the legacy api_base_url
+// key), otherwise it appends /chat/completions to base.
+func newOpenAIProvider(x *executor, name, base, endpoint, apiKey string) *openAIProvider {
+	if endpoint == "" {
+		endpoint = base + "/chat/completions"
+	}
+	return &openAIProvider{x: x, name: name, endpoint: endpoint, apiKey: apiKey}
+}
+
+func (p *openAIProvider) Name() string { return p.name }
+
+func (p *openAIProvider) Complete(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	var out chatCompletionResponse
+	if err := p.x.postJSON(ctx, p.endpoint, p.headers(), p.body(req, false), &out); err != nil {
+		return ChatResponse{}, err
+	}
+	if len(out.Choices) == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	msg := out.Choices[0].Message
+	resp := ChatResponse{Model: req.Model, Content: msg.Content, Usage: out.Usage.usage()}
+	for i, c := range msg.ToolCalls {
+		resp.ToolCalls = append(resp.ToolCalls, ToolCall{ID: toolCallID(c.ID, i), Name: c.Function.Name, Arguments: json.RawMessage(c.Function.Arguments)})
+	}
+	if resp.Content == "" && len(resp.ToolCalls) == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	return resp, nil
+}
+
+func (p *openAIProvider) Stream(ctx context.Context, req ChatRequest, onChunk func(string)) (ChatResponse, error) {
+	resp, err := p.x.post(ctx, p.endpoint, p.headers(), p.body(req, true))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var usage Usage
+	err = readSSE(resp.Body, func(_, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return malformed("invalid stream chunk: %v", err)
+		}
+		if chunk.Error != nil {
+			return streamError(chunk.Error.Message, strings.Trim(string(chunk.Error.Code), `"`))
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.usage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				onChunk(choice.Delta.Content)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ChatResponse{Model: req.Model, Content: content.String()}, err
+	}
+	if content.Len() == 0 {
+		return ChatResponse{}, malformed("LLM returned no response for model %s", req.Model)
+	}
+	return ChatResponse{Model: req.Model, Content: content.String(), Usage: usage}, nil
+}
+
+func (p *openAIProvider) headers() map[string]string {
+	return map[string]string{
+		"Authorization":      "Bearer " + p.apiKey,
+		"OpenRouter-Referer": "https://github.com/nareshkarthigeyan/revly",
+	}
+}
+
+func (p *openAIProvider) body(req ChatRequest, stream bool) chatCompletionRequest {
+	var messages []chatMessage
+	if req.System != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		msg := chatMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, c := range m.ToolCalls {
+			call := openAIToolCall{ID: c.ID, Type: "function"}
+			call.Function.Name = c.Name
+			call.Function.Arguments = string(toolArguments(c.Arguments))
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		messages = append(messages, msg)
+	}
+	body := chatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Tools:       openAITools(req.Tools),
+		Stream:      stream,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+	}
+	// Usage in streams is opt-in on OpenAI and OpenRouter. Other gateways
+	// may reject the unknown field, so it's only sent to those two.
+	if stream && (p.name == "openai" || p.name == "openrouter") {
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	// Same for JSON mode; OpenRouter drops it for models that lack it.
+	if req.JSON && (p.name == "openai" || p.name == "openrouter") {
+		body.ResponseFormat = &responseFormat{Type: "json_object"}
+	}
+	return body
+}
+
+// openAITools encodes tools in the function-calling format shared by the
+// chat completions API and Ollama.
+func openAITools(tools []Tool) []openAITool {
+	var out []openAITool
+	for _, t := range tools {
+		out = append(out, openAITool{Type: "function", Function: openAIFunction{Name: t.Name, Description: t.Description, Parameters: t.Parameters}})
+	}
+	return out
+}
+
+func (u *chatCompletionUsage) usage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
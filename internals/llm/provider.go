@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// Provider is a chat backend that speaks one vendor's wire format.
+// The active provider is chosen by the [llm] provider key in revly.config.toml.
+type Provider interface {
+	Name() string
+	Complete(ctx context.Context, req ChatRequest) (ChatResponse, error)
+	// Stream behaves like Complete but calls onChunk with each piece of
+	// text as it arrives. The returned response holds the full content.
+	Stream(ctx context.Context, req ChatRequest, onChunk func(string)) (ChatResponse, error)
+}
+
+// ChatRequest is the provider-neutral shape of a single model call.
+type ChatRequest struct {
+	Model    string
+	System   string
+	Messages []Message
+	// JSON asks the provider to constrain the output to a JSON object where
+	// it supports that. The prompt must still ask for JSON.
+	JSON bool
+	// Temperature and MaxTokens are left to the provider when nil or zero.
+	Temperature *float64
+	MaxTokens   int
+	// Tools the model may call instead of answering; see ChatResponse.ToolCalls.
+	Tools []Tool
+}
+
+// ChatResponse is the provider-neutral result of a single model call.
+type ChatResponse struct {
+	Model   string
+	Content string
+	// ToolCalls are the tools the model asked to run before it answers.
+	// Content may be empty when there are some.
+	ToolCalls []ToolCall
+	Usage     Usage
+}
+
+// Tool is a function offered to the model.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON Schema of the arguments object.
+	Parameters map[string]any
+}
+
+// ToolCall is the model asking to run a tool. ID ties the result to the
+// call; providers that don't assign one get a generated ID.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments json.RawMessage
+}
+
+// Usage is the token count a provider reported for one call. Providers that
+// don't report it leave it zero and the caller estimates it instead.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCalls are the calls an assistant message made. A "tool" message
+	// answers the call with ToolCallID, named ToolName. Each provider
+	// encodes these in its own format.
+	ToolCalls  []ToolCall `json:"-"`
+	ToolCallID string     `json:"-"`
+	ToolName   string     `json:"-"`
+}
+
+// NewProvider builds the provider named in cfg. OpenRouter, OpenAI and any
+// other OpenAI-compatible gateway share the same implementation.
+func NewProvider(cfg config.LLMConfig, apiKey string) (Provider, error) {
+	x, err := newExecutor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch name := strings.ToLower(strings.TrimSpace(cfg.Provider)); name {
+	case "", "openrouter":
+		return newOpenAIProvider(x, "openrouter", baseURL(cfg, DefaultBaseURL(name)), cfg.Endpoint, apiKey), nil
+	case "openai":
+		return newOpenAIProvider(x, name, baseURL(cfg, DefaultBaseURL(name)), cfg.Endpoint, apiKey), nil
+	case "openai-compatible", "compatible":
+		if cfg.BaseURL == "" && cfg.Endpoint == "" {
+			return nil, fmt.Errorf("provider %q needs base_url or api_base_url in [llm]", name)
+		}
+		return newOpenAIProvider(x, name, baseURL(cfg, ""), cfg.Endpoint, apiKey), nil
+	case "anthropic":
+		return newAnthropicProvider(x, baseURL(cfg, DefaultBaseURL(name)), apiKey), nil
+	case "gemini", "google":
+		return newGeminiProvider(x, baseURL(cfg, DefaultBaseURL(name)), apiKey), nil
+	case "ollama":
+		return newOllamaProvider(x, baseURL(cfg, DefaultBaseURL(name))), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q (supported: openrouter, openai, openai-compatible, anthropic, gemini, ollama)", cfg.Provider)
+	}
+}
+
+// RequiresAPIKey reports whether the configured provider authenticates with a key.
+func RequiresAPIKey(cfg config.LLMConfig) bool {
+	return strings.ToLower(strings.TrimSpace(cfg.Provider)) != "ollama"
+}
+
+// EndpointURL is the base URL requests for cfg go to.
+func EndpointURL(cfg config.LLMConfig) string {
+	if cfg.BaseURL == "" && cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return baseURL(cfg, DefaultBaseURL(cfg.Provider))
+}
+
+// DefaultBaseURL is the endpoint used for a provider when base_url is unset,
+// or "" when the provider has none.
+func DefaultBaseURL(provider string) string {
+	switch strings.ToLower(strings.TrimSpace(provider)) {
+	case "", "openrouter":
+		return "https://openrouter.ai/api/v1"
+	case "openai":
+		return "https://api.openai.com/v1"
+	case "anthropic":
+		return "https://api.anthropic.com/v1"
+	case "gemini", "google":
+		return "https://generativelanguage.googleapis.com/v1beta"
+	case "ollama":
+		return "http://localhost:11434"
+	}
+	return ""
+}
+
+// CheckModel sends model a tiny prompt, without retries, to confirm that the
+// endpoint, key and model name work. It returns how long the call took.
+func CheckModel(ctx context.Context, cfg config.LLMConfig, apiKey, model string) (time.Duration, error) {
+	cfg.MaxRetries = 0
+	p, err := NewProvider(cfg, apiKey)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	_, err = p.Complete(ctx, ChatRequest{
+		Model:     model,
+		Messages:  []Message{{Role: "user", Content: "Reply with the single word OK."}},
+		MaxTokens: 16,
+	})
+	return time.Since(start), err
+}
+
+func baseURL(cfg config.LLMConfig, fallback string) string {
+	if cfg.BaseURL != "" {
+		return strings.TrimRight(cfg.BaseURL, "/")
+	}
+	return fallback
+}
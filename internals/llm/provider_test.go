@@ -0,0 +1,180 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// exchange is what a provider should send for testRequest, and what the
+// server answers.
+type exchange struct {
+	provider string
+	path     string
+	headers  map[string]string
+	body     string
+	reply    string
+}
+
+var temperature = 0.2
+
+var testRequest = ChatRequest{
+	Model:       "m",
+	System:      "Be brief.",
+	Messages:    []Message{{Role: "user", Content: "hi"}},
+	JSON:        true,
+	Temperature: &temperature,
+	MaxTokens:   100,
+}
+
+var exchanges = []exchange{
+	{
+		provider: "openrouter",
+		path:     "/chat/completions",
+		headers:  map[string]string{"Authorization": "Bearer k"},
+		body: `{"model": "m", "stream": false, "temperature": 0.2, "max_tokens": 100, "response_format": {"type": "json_object"},
+			"messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "hi"}]}`,
+		reply: `{"choices": [{"message": {"role": "assistant", "content": "ok"}}], "usage": {"prompt_tokens": 3, "completion_tokens": 1}}`,
+	},
+	{
+		// JSON mode is only asked of OpenAI and OpenRouter.
+		provider: "openai-compatible",
+		path:     "/chat/completions",
+		headers:  map[string]string{"Authorization": "Bearer k"},
+		body: `{"model": "m", "stream": false, "temperature": 0.2, "max_tokens": 100,
+			"messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "hi"}]}`,
+		reply: `{"choices": [{"message": {"role": "assistant", "content": "ok"}}], "usage": {"prompt_tokens": 3, "completion_tokens": 1}}`,
+	},
+	{
+		provider: "anthropic",
+		path:     "/messages",
+		headers:  map[string]string{"x-api-key": "k", "anthropic-version": anthropicVersion},
+		body: `{"model": "m", "system": "Be brief.", "max_tokens": 100, "temperature": 0.2,
+			"messages": [{"role": "user", "content": "hi"}]}`,
+		reply: `{"content": [{"type": "text", "text": "o"}, {"type": "text", "text": "k"}], "usage": {"input_tokens": 3, "output_tokens": 1}}`,
+	},
+	{
+		provider: "gemini",
+		path:     "/models/m:generateContent",
+		headers:  map[string]string{"x-goog-api-key": "k"},
+		body: `{"systemInstruction": {"parts": [{"text": "Be brief."}]}, "contents": [{"role": "user", "parts": [{"text": "hi"}]}],
+			"generationConfig": {"responseMimeType": "application/json", "temperature": 0.2, "maxOutputTokens": 100}}`,
+		reply: `{"candidates": [{"content": {"role": "model", "parts": [{"text": "ok"}]}}], "usageMetadata": {"promptTokenCount": 3, "candidatesTokenCount": 1}}`,
+	},
+	{
+		provider: "ollama",
+		path:     "/api/chat",
+		body: `{"model": "m", "stream": false, "format": "json", "options": {"temperature": 0.2, "num_predict": 100},
+			"messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "hi"}]}`,
+		reply: `{"message": {"role": "assistant", "content": "ok"}, "done": true, "prompt_eval_count": 3, "eval_count": 1}`,
+	},
+}
+
+// sameJSON reports whether a and b encode the same value.
+func sameJSON(t *testing.T, a, b string) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal([]byte(a), &va); err != nil {
+		t.Fatalf("%v: %s", err, a)
+	}
+	if err := json.Unmarshal([]byte(b), &vb); err != nil {
+		t.Fatalf("%v: %s", err, b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func TestProviderEncodings(t *testing.T) {
+	for _, ex := range exchanges {
+		t.Run(ex.provider, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != ex.path {
+					t.Errorf("path = %s, want %s", r.URL.Path, ex.path)
+				}
+				for k, v := range ex.headers {
+					if got := r.Header.Get(k); got != v {
+						t.Errorf("header %s = %q, want %q", k, got, v)
+					}
+				}
+				body, _ := io.ReadAll(r.Body)
+				if !sameJSON(t, string(body), ex.body) {
+					t.Errorf("body =\n%s\nwant\n%s", body, ex.body)
+				}
+				io.WriteString(w, ex.reply)
+			}))
+			defer srv.Close()
+
+			p, err := NewProvider(config.LLMConfig{Provider: ex.provider, BaseURL: srv.URL}, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := p.Complete(context.Background(), testRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ChatResponse{Model: "m", Content: "ok", Usage: Usage{PromptTokens: 3, CompletionTokens: 1}}
+			if !reflect.DeepEqual(resp, want) {
+				t.Errorf("response = %+v, want %+v", resp, want)
+			}
+		})
+	}
+}
+
+func TestProviderEmptyResponse(t *testing.T) {
+	empty := map[string]string{
+		"openrouter": `{"choices": []}`,
+		"anthropic":  `{"content": []}`,
+		"gemini":     `{"candidates": []}`,
+		"ollama":     `{"message": {"role": "assistant", "content": ""}, "done": true}`,
+	}
+	for name, reply := range empty {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, reply)
+			}))
+			defer srv.Close()
+
+			p, err := NewProvider(config.LLMConfig{Provider: name, BaseURL: srv.URL}, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.Complete(context.Background(), testRequest); err == nil {
+				t.Error("an empty response was accepted")
+			}
+		})
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		cfg  config.LLMConfig
+		name string
+		err  bool
+	}{
+		{config.LLMConfig{}, "openrouter", false},
+		{config.LLMConfig{Provider: " OpenAI "}, "openai", false},
+		{config.LLMConfig{Provider: "google"}, "gemini", false},
+		{config.LLMConfig{Provider: "openai-compatible"}, "", true},
+		{config.LLMConfig{Provider: "openai-compatible", Endpoint: "http://x/v1/chat"}, "openai-compatible", false},
+		{config.LLMConfig{Provider: "bogus"}, "", true},
+	}
+	for _, tt := range tests {
+		p, err := NewProvider(tt.cfg, "k")
+		if tt.err {
+			if err == nil {
+				t.Errorf("NewProvider(%q) succeeded, want an error", tt.cfg.Provider)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewProvider(%q): %v", tt.cfg.Provider, err)
+		} else if p.Name() != tt.name {
+			t.Errorf("NewProvider(%q) = %s, want %s", tt.cfg.Provider, p.Name(), tt.name)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/redact"
+)
+
+// One redactor serves the whole process, so a secret keeps its placeholder
+// across chunks, models and repeated pair ticks.
+var (
+	redactorOnce sync.Once
+	redactor     *redact.Redactor
+	redactorErr  error
+
+	reportedMu sync.Mutex
+	reported   = map[string]bool{}
+)
+
+func getRedactor(cfg config.RedactConfig) (*redact.Redactor, error) {
+	redactorOnce.Do(func() {
+		redactor, redactorErr = redact.New(redact.Options{
+			Patterns: cfg.Patterns,
+			Allow:    cfg.Allow,
+			Entropy:  cfg.Entropy,
+		})
+	})
+	return redactor, redactorErr
+}
+
+// Redact hides the secrets in text as a request would, without sending
+// anything, and returns what it found.
+func Redact(cfg config.RevlyConfig, text string) (string, []redact.Finding, error) {
+	if cfg.Redact.Mode == "off" {
+		return text, nil, nil
+	}
+	r, err := getRedactor(cfg.Redact)
+	if err != nil {
+		return "", nil, err
+	}
+	out, findings := r.Redact(text)
+	return out, findings, nil
+}
+
+// redactInput hides the secrets in the content a command is about to send
+// and says on stderr what it hid, once per secret. In block mode it refuses
+// instead.
+func redactInput(cfg config.RevlyConfig, text string) (string, error) {
+	out, findings, err := Redact(cfg, text)
+	if err != nil || len(findings) == 0 {
+		return out, err
+	}
+	if cfg.Redact.Mode == "block" {
+		return "", &redact.BlockedError{Findings: findings}
+	}
+
+	reportedMu.Lock()
+	var fresh []redact.Finding
+	for _, f := range findings {
+		if !reported[f.Placeholder] {
+			reported[f.Placeholder] = true
+			fresh = append(fresh, f)
+		}
+	}
+	reportedMu.Unlock()
+	if len(fresh) > 0 {
+		fmt.Fprintln(os.Stderr, color.YellowString("Redacted %s before sending.", redact.Summary(fresh)))
+	}
+	return out, nil
+}
+
+// redactRequest runs every part of a request through the redactor just
+// before it is sent, so content that didn't come in through redactInput
+// can't carry a secret out either.
+func redactRequest(cfg config.RevlyConfig, req ChatRequest) (ChatRequest, error) {
+	if cfg.Redact.Mode == "off" {
+		return req, nil
+	}
+	system, err := redactInput(cfg, req.System)
+	if err != nil {
+		return req, err
+	}
+	req.System = system
+	messages := make([]Message, len(req.Messages))
+	for i, m := range req.Messages {
+		if m.Content, err = redactInput(cfg, m.Content); err != nil {
+			return req, err
+		}
+		messages[i] = m
+	}
+	req.Messages = messages
+	return req, nil
+}
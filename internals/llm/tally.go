@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+type tallyKey struct{}
+
+// Tally adds up the successful model calls made with a context returned by
+// WithTally: which models answered and how many tokens they used.
+type Tally struct {
+	mu               sync.Mutex
+	models           []string
+	promptTokens     int
+	completionTokens int
+}
+
+// WithTally returns a context whose LLM calls are counted in the Tally.
+func WithTally(ctx context.Context) (context.Context, *Tally) {
+	t := &Tally{}
+	return context.WithValue(ctx, tallyKey{}, t), t
+}
+
+func (t *Tally) add(model string, u Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !contains(t.models, model) {
+		t.models = append(t.models, model)
+	}
+	t.promptTokens += u.PromptTokens
+	t.completionTokens += u.CompletionTokens
+}
+
+// Models lists the models that answered, in the order they first did.
+func (t *Tally) Models() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.models...)
+}
+
+// Tokens returns the prompt and completion tokens used so far.
+func (t *Tally) Tokens() (prompt, completion int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.promptTokens, t.completionTokens
+}
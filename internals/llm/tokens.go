@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"strings"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+// defaultContextWindow is assumed for models we know nothing about. It is
+// deliberately small: overestimating it gets requests truncated or rejected.
+const defaultContextWindow = 32768
+
+// outputReserve is kept free in every request for the model's answer.
+const outputReserve = 4096
+
+// modelProfile describes the limits of a model family.
+type modelProfile struct {
+	contextWindow int
+	// charsPerToken is a rough average for source code and diffs. Lower is
+	// more conservative.
+	charsPerToken float64
+}
+
+// modelProfiles is matched against the model name by substring, first match
+// wins, so more specific entries come first.
+var modelProfiles = []struct {
+	match   string
+	profile modelProfile
+}{
+	{"gpt-4.1", modelProfile{1000000, 3.8}},
+	{"gpt-4o", modelProfile{128000, 3.8}},
+	{"gpt-5", modelProfile{400000, 3.8}},
+	{"claude", modelProfile{200000, 3.2}},
+	{"gemini", modelProfile{1000000, 3.6}},
+	{"qwen3-coder", modelProfile{262144, 3.4}},
+	{"qwen3", modelProfile{131072, 3.4}},
+	{"qwen2.5", modelProfile{32768, 3.4}},
+	{"kimi-k2", modelProfile{131072, 3.4}},
+	{"kimi", modelProfile{131072, 3.4}},
+	{"deepseek-r1-0528-qwen3-8b", modelProfile{32768, 3.4}},
+	{"deepseek", modelProfile{128000, 3.4}},
+	{"hunyuan", modelProfile{32768, 3.4}},
+	{"mistral-small", modelProfile{128000, 3.4}},
+	{"dolphin-mistral", modelProfile{32768, 3.4}},
+	{"mai-ds-r1", modelProfile{128000, 3.4}},
+	{"llama-3.1", modelProfile{131072, 3.4}},
+	{"llama-3.3", modelProfile{131072, 3.4}},
+}
+
+func profileFor(model string) modelProfile {
+	name := strings.ToLower(model)
+	for _, p := range modelProfiles {
+		if strings.Contains(name, p.match) {
+			return p.profile
+		}
+	}
+	return modelProfile{defaultContextWindow, 3.2}
+}
+
+// estimateTokens approximates how many tokens model will see for s. It errs
+// on the high side; there is no tokenizer for most of these models offline.
+func estimateTokens(model, s string) int {
+	return int(float64(len(s))/profileFor(model).charsPerToken) + 1
+}
+
+// promptBudget is how many tokens of user content fit in one review request
+// next to system, for the tightest model in the fallback list, since any of
+// them may end up answering. [llm] context_window overrides the built-in
+// table, and [models.review] max_tokens replaces the output reserve.
+func promptBudget(cfg config.RevlyConfig, system string) int {
+	route := cfg.Task("review")
+	reserve := outputReserve
+	if route.MaxTokens > 0 {
+		reserve = route.MaxTokens
+	}
+
+	budget := 0
+	for _, model := range route.Models {
+		window := profileFor(model).contextWindow
+		if cfg.LLM.ContextWindow > 0 {
+			window = cfg.LLM.ContextWindow
+		}
+		b := window - reserve - estimateTokens(model, system) - 256
+		if budget == 0 || b < budget {
+			budget = b
+		}
+	}
+	if cfg.Review.ChunkTokens > 0 && (budget == 0 || cfg.Review.ChunkTokens < budget) {
+		budget = cfg.Review.ChunkTokens
+	}
+	if budget < 1024 {
+		budget = 1024
+	}
+	return budget
+}
+
+// maxTokens is estimateTokens for the most pessimistic review model.
+func maxTokens(cfg config.RevlyConfig, s string) int {
+	n := 0
+	for _, model := range cfg.Task("review").Models {
+		if t := estimateTokens(model, s); t > n {
+			n = t
+		}
+	}
+	return n
+}
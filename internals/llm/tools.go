@@ -0,0 +1,462 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/gitutils"
+	"github.com/nareshkarthigeyan/revly/internals/redact"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+// reviewTools are offered to review models when [review.tools] is enabled.
+var reviewTools = []Tool{
+	{
+		Name:        "read_file",
+		Description: "Read a file in the repository, with line numbers. Use start_line and end_line to read part of a large file.",
+		Parameters: objectSchema(map[string]any{
+			"path":       stringParam("Path relative to the repository root"),
+			"start_line": intParam("First line to return, counting from 1"),
+			"end_line":   intParam("Last line to return"),
+		}, "path"),
+	},
+	{
+		Name:        "grep",
+		Description: "Search the repository's files for a regular expression (POSIX extended syntax). Returns matching lines as path:line:text.",
+		Parameters: objectSchema(map[string]any{
+			"pattern": stringParam("Regular expression to search for"),
+			"path":    stringParam("Directory or file to search, relative to the repository root; defaults to the whole repository"),
+		}, "pattern"),
+	},
+	{
+		Name:        "list_dir",
+		Description: "List a directory of the repository. Subdirectories end in /.",
+		Parameters: objectSchema(map[string]any{
+			"path": stringParam("Directory relative to the repository root; defaults to the root"),
+		}),
+	},
+	{
+		Name:        "git_log",
+		Description: "Show recent commits, optionally only those touching a path.",
+		Parameters: objectSchema(map[string]any{
+			"path":  stringParam("File or directory relative to the repository root"),
+			"limit": intParam("How many commits to show, up to 50; defaults to 10"),
+		}),
+	},
+}
+
+// toolsPrompt is added to the review prompt when tools are offered.
+const toolsPrompt = `You can call read_file, grep, list_dir and git_log to look at the rest of the repository before answering, for example to find the definition of a function the diff calls, the other callers of something it changes, or why a line was written. Use them instead of reporting that context is missing, and only as much as the review needs: you have at most %d tool calls. When you are done, answer in the format below.`
+
+func objectSchema(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func stringParam(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func intParam(description string) map[string]any {
+	return map[string]any{"type": "integer", "description": description}
+}
+
+const (
+	// maxToolOutput caps a single call, so one large file can't use up the
+	// whole byte budget.
+	maxToolOutput = 16_000
+	maxGrepLines  = 200
+	maxDirEntries = 500
+	// maxOverrunRounds is how many more rounds a model may keep calling tools
+	// after the budget is spent before it is asked without tools.
+	maxOverrunRounds = 2
+)
+
+// toolbox runs the review tools for one review, within its budget. Chunks
+// of a large diff reviewed concurrently share it.
+type toolbox struct {
+	root     string
+	maxCalls int
+	maxBytes int
+	// onCall, if set, is told about each call, for progress messages.
+	onCall func(call string)
+
+	mu    sync.Mutex
+	calls int
+	bytes int
+
+	ignoreOnce sync.Once
+	ignored    *gitutils.Matcher
+	ignoreErr  error
+}
+
+// ignore returns the patterns of .revlyignore, read on first use. Files it
+// matches are kept from the model, as they are in the diff.
+func (t *toolbox) ignore() (*gitutils.Matcher, error) {
+	t.ignoreOnce.Do(func() {
+		t.ignored, t.ignoreErr = gitutils.LoadIgnoreFile(filepath.Join(t.root, gitutils.IgnoreFile))
+		if t.ignoreErr != nil {
+			t.ignoreErr = fmt.Errorf("reading %s: %w", gitutils.IgnoreFile, t.ignoreErr)
+		}
+	})
+	return t.ignored, t.ignoreErr
+}
+
+type toolboxKey struct{}
+
+// withTools attaches a toolbox to ctx when [review.tools] is enabled, so the
+// review requests made under it offer the tools.
+func withTools(ctx context.Context, cfg config.RevlyConfig, onCall func(string)) context.Context {
+	t := cfg.Review.Tools
+	if !t.Enabled {
+		return ctx
+	}
+	return context.WithValue(ctx, toolboxKey{}, &toolbox{root: repo.Root(), maxCalls: t.MaxCalls, maxBytes: t.MaxBytes, onCall: onCall})
+}
+
+// withoutTools hides the toolbox from requests that shouldn't use it, like
+// merging the findings of chunks.
+func withoutTools(ctx context.Context) context.Context {
+	return context.WithValue(ctx, toolboxKey{}, (*toolbox)(nil))
+}
+
+func toolsFrom(ctx context.Context) *toolbox {
+	t, _ := ctx.Value(toolboxKey{}).(*toolbox)
+	return t
+}
+
+// completeWithTools is complete with the review tools offered to the model.
+// Each time the model asks for tools their results are sent back, until it
+// answers. Tool turns aren't streamed; the answer is passed to onChunk in one
+// piece. Without a toolbox it is plain complete.
+func completeWithTools(ctx context.Context, cfg config.RevlyConfig, apiKey, task string, req ChatRequest, tools *toolbox, onChunk func(string)) (string, error) {
+	if tools == nil {
+		return complete(ctx, cfg, apiKey, task, req, onChunk)
+	}
+	plain := req
+	req.Tools = reviewTools
+	req.Messages = append([]Message{}, req.Messages...)
+	overrun := 0
+	for {
+		resp, err := completeResponse(ctx, cfg, apiKey, task, req, nil)
+		if err != nil {
+			return resp.Content, err
+		}
+		if len(resp.ToolCalls) == 0 {
+			if onChunk != nil {
+				onChunk(resp.Content)
+			}
+			return resp.Content, nil
+		}
+		if tools.spent() {
+			if overrun++; overrun > maxOverrunRounds {
+				// The model won't stop on its own; ask once more with what
+				// the tools returned as plain text and no tools to call.
+				plain.Messages = append(append([]Message{}, plain.Messages...), Message{Role: "user", Content: toolTranscript(req.Messages[len(plain.Messages):])})
+				return complete(ctx, cfg, apiKey, task, plain, onChunk)
+			}
+		}
+		req.Messages = append(req.Messages, Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			req.Messages = append(req.Messages, Message{Role: "tool", ToolCallID: call.ID, ToolName: call.Name, Content: tools.run(ctx, call)})
+		}
+	}
+}
+
+// toolTranscript writes tool calls and their results out as text.
+func toolTranscript(messages []Message) string {
+	var b strings.Builder
+	b.WriteString("These are the results of the tools you called. No more tools are available; answer now.\n")
+	for _, m := range messages {
+		for _, c := range m.ToolCalls {
+			fmt.Fprintf(&b, "\n### %s %s\n", c.Name, toolArguments(c.Arguments))
+		}
+		if m.Role == "tool" {
+			b.WriteString(m.Content + "\n")
+		}
+	}
+	return b.String()
+}
+
+func (t *toolbox) spent() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.calls >= t.maxCalls || t.bytes >= t.maxBytes
+}
+
+// run executes call and returns what to tell the model: the output, cut to
+// the budget, or what went wrong.
+func (t *toolbox) run(ctx context.Context, call ToolCall) string {
+	t.mu.Lock()
+	if t.calls >= t.maxCalls || t.bytes >= t.maxBytes {
+		t.mu.Unlock()
+		return "Tool budget used up. Answer now with what you have."
+	}
+	t.calls++
+	t.mu.Unlock()
+
+	out, err := t.dispatch(ctx, call)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limit := max(0, min(maxToolOutput, t.maxBytes-t.bytes))
+	if len(out) > limit {
+		out = out[:limit] + "\n[output truncated; narrow the request, e.g. with a line range]"
+	}
+	t.bytes += len(out)
+	return out
+}
+
+func (t *toolbox) dispatch(ctx context.Context, call ToolCall) (string, error) {
+	var args struct {
+		Path      string `json:"path"`
+		Pattern   string `json:"pattern"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+		Limit     int    `json:"limit"`
+	}
+	if len(bytes.TrimSpace(call.Arguments)) > 0 && !json.Valid(call.Arguments) {
+		return "", fmt.Errorf("arguments are not valid JSON: %s", call.Arguments)
+	}
+	if err := json.Unmarshal(toolArguments(call.Arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if t.onCall != nil {
+		t.onCall(strings.TrimSpace(call.Name + " " + args.Path + " " + args.Pattern))
+	}
+
+	switch call.Name {
+	case "read_file":
+		return t.readFile(args.Path, args.StartLine, args.EndLine)
+	case "grep":
+		return t.grep(ctx, args.Pattern, args.Path)
+	case "list_dir":
+		return t.listDir(args.Path)
+	case "git_log":
+		return t.gitLog(ctx, args.Path, args.Limit)
+	}
+	return "", fmt.Errorf("unknown tool %q", call.Name)
+}
+
+// resolve turns a path from the model into one inside the repository. Paths
+// that leave the repository, directly or through a symlink, paths into .git
+// or revly's own state, and paths matched by .revlyignore are refused.
+func (t *toolbox) resolve(p string) (full, rel string, err error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		p = "."
+	}
+	if filepath.IsAbs(p) {
+		return "", "", errors.New("paths must be relative to the repository root")
+	}
+	full = filepath.Join(t.root, filepath.FromSlash(p))
+	if !within(t.root, full) {
+		return "", "", fmt.Errorf("%s is outside the repository", p)
+	}
+	if real, err := filepath.EvalSymlinks(full); err == nil {
+		root, _ := filepath.EvalSymlinks(t.root)
+		if !within(root, real) {
+			return "", "", fmt.Errorf("%s is outside the repository", p)
+		}
+	}
+	rel, _ = filepath.Rel(t.root, full)
+	rel = filepath.ToSlash(rel)
+	if first, _, _ := strings.Cut(rel, "/"); first == ".git" || first == ".revly" {
+		return "", "", fmt.Errorf("%s is not available", p)
+	}
+	ignored, err := t.ignore()
+	if err != nil {
+		return "", "", err
+	}
+	if rel != "." {
+		info, err := os.Stat(full)
+		if ignored.Match(rel) || err == nil && info.IsDir() && ignored.MatchDir(rel) {
+			return "", "", fmt.Errorf("%s is excluded by %s", p, gitutils.IgnoreFile)
+		}
+	}
+	return full, rel, nil
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (t *toolbox) readFile(p string, start, end int) (string, error) {
+	full, rel, err := t.resolve(p)
+	if err != nil {
+		return "", err
+	}
+	if redact.SensitiveFile(rel) {
+		return "", fmt.Errorf("%s holds secrets and can't be read", rel)
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return "", fmt.Errorf("%s: no such file", rel)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory; use list_dir", rel)
+	}
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "", fmt.Errorf("%s is a binary file", rel)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	start = max(start, 1)
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > end {
+		return "", fmt.Errorf("%s has %d lines", rel, len(lines))
+	}
+	var b strings.Builder
+	for i := start; i <= end; i++ {
+		fmt.Fprintf(&b, "%d\t%s\n", i, lines[i-1])
+	}
+	return b.String(), nil
+}
+
+// grep runs git grep, which is fast, skips binary files and honours
+// .gitignore.
+func (t *toolbox) grep(ctx context.Context, pattern, p string) (string, error) {
+	if pattern == "" {
+		return "", errors.New("pattern is required")
+	}
+	_, rel, err := t.resolve(p)
+	if err != nil {
+		return "", err
+	}
+	ignored, _ := t.ignore()
+	cmd := exec.CommandContext(ctx, "git", "grep", "-n", "-I", "--untracked", "--no-color", "-E", "-e", pattern, "--", rel)
+	cmd.Dir = t.root
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return "No matches.", nil
+	}
+	if err != nil {
+		if exit != nil && len(exit.Stderr) > 0 {
+			return "", errors.New(strings.TrimSpace(string(exit.Stderr)))
+		}
+		return "", err
+	}
+
+	var b strings.Builder
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		file, _, _ := strings.Cut(line, ":")
+		if redact.SensitiveFile(file) || strings.HasPrefix(file, ".revly/") || ignored.Match(file) {
+			continue
+		}
+		if n++; n > maxGrepLines {
+			fmt.Fprintf(&b, "[more than %d matches; narrow the pattern or path]\n", maxGrepLines)
+			break
+		}
+		b.WriteString(line + "\n")
+	}
+	if n == 0 {
+		return "No matches.", nil
+	}
+	return b.String(), nil
+}
+
+func (t *toolbox) listDir(p string) (string, error) {
+	full, rel, err := t.resolve(p)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return "", fmt.Errorf("%s: not a directory", rel)
+	}
+	ignored, _ := t.ignore()
+	var b strings.Builder
+	n := 0
+	for _, e := range entries {
+		if rel == "." && (e.Name() == ".git" || e.Name() == ".revly") {
+			continue
+		}
+		if path := filepath.ToSlash(filepath.Join(rel, e.Name())); ignored.Match(path) || e.IsDir() && ignored.MatchDir(path) {
+			continue
+		}
+		if n++; n > maxDirEntries {
+			fmt.Fprintf(&b, "[%d more entries]\n", len(entries)-maxDirEntries)
+			break
+		}
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		b.WriteString(name + "\n")
+	}
+	if n == 0 {
+		return "Empty directory.", nil
+	}
+	return b.String(), nil
+}
+
+func (t *toolbox) gitLog(ctx context.Context, p string, limit int) (string, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	limit = min(limit, 50)
+	args := []string{"log", "--no-color", fmt.Sprintf("-n%d", limit), "--date=short", "--format=%h %ad %an%n    %s"}
+	if p != "" {
+		_, rel, err := t.resolve(p)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--", rel)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = t.root
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git log failed: %v", err)
+	}
+	if len(out) == 0 {
+		return "No commits.", nil
+	}
+	return string(out), nil
+}
+
+// toolArguments is the arguments of a call as JSON that can be sent back to
+// the provider; models sometimes send nothing for tools without required
+// parameters, or broken JSON.
+func toolArguments(raw json.RawMessage) json.RawMessage {
+	if len(bytes.TrimSpace(raw)) == 0 || !json.Valid(raw) {
+		return json.RawMessage("{}")
+	}
+	return raw
+}
+
+// toolCallID returns id, or makes one up for providers that don't assign
+// IDs to calls.
+func toolCallID(id string, i int) string {
+	if id != "" {
+		return id
+	}
+	return fmt.Sprintf("call_%d", i)
+}
@@ -0,0 +1,229 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// toolRepo creates a committed repository for the tools to look around,
+// with a file and a symlink outside it.
+func toolRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repo")
+	files := map[string]string{
+		"main.go":         "package main\n\nfunc main() {\n\tgreet()\n}\n",
+		"greet.go":        "package main\n\nfunc greet() { println(\"hi\") }\n",
+		"docs/README.md":  "# docs\n",
+		".env":            "API_TOKEN=greet-secret\n",
+		".git-keep":       "",
+		"../outside.txt":  "not yours\n",
+		"image.png":       "\x89PNG\x00\x00",
+		".revly/state.db": "greet\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com",
+			"GIT_COMMITTER_NAME=Ada", "GIT_COMMITTER_EMAIL=ada@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", "main.go", "greet.go", "docs")
+	git("commit", "-q", "-m", "Add greeting")
+	return root
+}
+
+func call(name, args string) ToolCall {
+	return ToolCall{ID: "call_1", Name: name, Arguments: json.RawMessage(args)}
+}
+
+func TestToolboxResolve(t *testing.T) {
+	tb := &toolbox{root: toolRepo(t)}
+	tests := []struct {
+		path string
+		rel  string
+		err  string
+	}{
+		{"main.go", "main.go", ""},
+		{"", ".", ""},
+		{"./docs/../main.go", "main.go", ""},
+		{"docs/", "docs", ""},
+		{"../outside.txt", "", "outside the repository"},
+		{"docs/../../outside.txt", "", "outside the repository"},
+		{"/etc/passwd", "", "relative to the repository root"},
+		{"escape/outside.txt", "", "outside the repository"},
+		{"escape", "", "outside the repository"},
+		{".git/config", "", "not available"},
+		{".git", "", "not available"},
+		{".revly/state.db", "", "not available"},
+		{".git-keep", ".git-keep", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, rel, err := tb.resolve(tt.path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("resolve(%q) err = %v, want %q", tt.path, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve(%q): %v", tt.path, err)
+			}
+			if rel != tt.rel {
+				t.Errorf("resolve(%q) = %q, want %q", tt.path, rel, tt.rel)
+			}
+		})
+	}
+}
+
+func TestToolboxRun(t *testing.T) {
+	root := toolRepo(t)
+	tests := []struct {
+		name     string
+		call     ToolCall
+		want     []string
+		dontWant []string
+	}{
+		{"read a file", call("read_file", `{"path": "main.go"}`), []string{"1\tpackage main\n", "4\t\tgreet()\n"}, nil},
+		{"read a range", call("read_file", `{"path": "main.go", "start_line": 3, "end_line": 4}`), []string{"3\tfunc main() {\n4\t\tgreet()\n"}, []string{"package"}},
+		{"range past the end", call("read_file", `{"path": "main.go", "start_line": 40}`), []string{"error: main.go has 5 lines"}, nil},
+		{"secrets are refused", call("read_file", `{"path": ".env"}`), []string{"error: .env holds secrets"}, []string{"greet-secret"}},
+		{"binary files are refused", call("read_file", `{"path": "image.png"}`), []string{"binary file"}, nil},
+		{"directories are refused", call("read_file", `{"path": "docs"}`), []string{"use list_dir"}, nil},
+		{"missing file", call("read_file", `{"path": "nope.go"}`), []string{"error: nope.go: no such file"}, nil},
+		{"escape through a symlink", call("read_file", `{"path": "escape/outside.txt"}`), []string{"error:", "outside the repository"}, []string{"not yours"}},
+		{"grep", call("grep", `{"pattern": "greet"}`), []string{"main.go:4:", "greet.go:3:"}, []string{"greet-secret", "state.db"}},
+		{"grep in a path", call("grep", `{"pattern": "greet", "path": "docs"}`), []string{"No matches."}, nil},
+		{"grep needs a pattern", call("grep", `{}`), []string{"error: pattern is required"}, nil},
+		{"bad regular expression", call("grep", `{"pattern": "("}`), []string{"error:"}, nil},
+		{"list the root", call("list_dir", `{}`), []string{"docs/\n", "main.go\n"}, []string{".git/", ".revly"}},
+		{"list outside", call("list_dir", `{"path": ".."}`), []string{"error:", "outside the repository"}, nil},
+		{"git log", call("git_log", `{"path": "main.go"}`), []string{"Ada\n    Add greeting\n"}, nil},
+		{"invalid arguments", call("read_file", `{"path": `), []string{"error: arguments are not valid JSON"}, nil},
+		{"unknown tool", call("rm", `{}`), []string{`error: unknown tool "rm"`}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &toolbox{root: root, maxCalls: 10, maxBytes: 100_000}
+			got := tb.run(context.Background(), tt.call)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("output doesn't contain %q:\n%s", w, got)
+				}
+			}
+			for _, w := range tt.dontWant {
+				if strings.Contains(got, w) {
+					t.Errorf("output contains %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestToolboxRespectsRevlyignore(t *testing.T) {
+	root := toolRepo(t)
+	files := map[string]string{
+		".revlyignore":     "# Kept from the model.\ngenerated/\nnotes.md\n",
+		"generated/api.go": "package generated\n\nfunc greet() {}\n",
+		"notes.md":         "greet the customer by name\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		call     ToolCall
+		want     []string
+		dontWant []string
+	}{
+		{"read an ignored file", call("read_file", `{"path": "notes.md"}`), []string{"error: notes.md is excluded by .revlyignore"}, []string{"customer"}},
+		{"read in an ignored directory", call("read_file", `{"path": "generated/api.go"}`), []string{"excluded by .revlyignore"}, []string{"package"}},
+		{"list an ignored directory", call("list_dir", `{"path": "generated"}`), []string{"excluded by .revlyignore"}, []string{"api.go"}},
+		{"list the root", call("list_dir", `{}`), []string{"main.go\n", "docs/\n"}, []string{"generated/", "notes.md"}},
+		{"grep", call("grep", `{"pattern": "greet"}`), []string{"main.go:4:"}, []string{"generated/api.go", "notes.md", "customer"}},
+		{"grep in an ignored directory", call("grep", `{"pattern": "greet", "path": "generated"}`), []string{"excluded by .revlyignore"}, nil},
+		{"git log of an ignored file", call("git_log", `{"path": "notes.md"}`), []string{"excluded by .revlyignore"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &toolbox{root: root, maxCalls: 10, maxBytes: 100_000}
+			got := tb.run(context.Background(), tt.call)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("output doesn't contain %q:\n%s", w, got)
+				}
+			}
+			for _, w := range tt.dontWant {
+				if strings.Contains(got, w) {
+					t.Errorf("output contains %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestToolboxBudget(t *testing.T) {
+	root := toolRepo(t)
+	ctx := context.Background()
+
+	tb := &toolbox{root: root, maxCalls: 1, maxBytes: 100_000}
+	if got := tb.run(ctx, call("list_dir", `{}`)); strings.Contains(got, "budget") {
+		t.Fatalf("first call was refused: %s", got)
+	}
+	if !tb.spent() {
+		t.Error("the call budget should be spent")
+	}
+	if got := tb.run(ctx, call("list_dir", `{}`)); !strings.Contains(got, "Tool budget used up") {
+		t.Errorf("call over the budget ran: %s", got)
+	}
+
+	tb = &toolbox{root: root, maxCalls: 10, maxBytes: 20}
+	got := tb.run(ctx, call("read_file", `{"path": "main.go"}`))
+	if !strings.HasPrefix(got, "1\tpackage main\n2\t\n3\t\n[output truncated") {
+		t.Errorf("output wasn't cut to the byte budget: %q", got)
+	}
+	if got := tb.run(ctx, call("read_file", `{"path": "main.go"}`)); !strings.Contains(got, "Tool budget used up") {
+		t.Errorf("call over the byte budget ran: %s", got)
+	}
+}
+
+func TestToolArguments(t *testing.T) {
+	for raw, want := range map[string]string{
+		"":                 "{}",
+		"  ":               "{}",
+		"{broken":          "{}",
+		`{"path": "a.go"}`: `{"path": "a.go"}`,
+	} {
+		if got := string(toolArguments(json.RawMessage(raw))); got != want {
+			t.Errorf("toolArguments(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
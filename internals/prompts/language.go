@@ -0,0 +1,62 @@
+package prompts
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languages maps file extensions to the language name given to templates.
+var languages = map[string]string{
+	".go":     "Go",
+	".py":     "Python",
+	".js":     "JavaScript",
+	".jsx":    "JavaScript",
+	".mjs":    "JavaScript",
+	".ts":     "TypeScript",
+	".tsx":    "TypeScript",
+	".java":   "Java",
+	".kt":     "Kotlin",
+	".scala":  "Scala",
+	".rb":     "Ruby",
+	".rs":     "Rust",
+	".c":      "C",
+	".h":      "C",
+	".cc":     "C++",
+	".cpp":    "C++",
+	".hpp":    "C++",
+	".cs":     "C#",
+	".swift":  "Swift",
+	".m":      "Objective-C",
+	".php":    "PHP",
+	".dart":   "Dart",
+	".ex":     "Elixir",
+	".exs":    "Elixir",
+	".erl":    "Erlang",
+	".hs":     "Haskell",
+	".clj":    "Clojure",
+	".lua":    "Lua",
+	".r":      "R",
+	".sh":     "Shell",
+	".sql":    "SQL",
+	".vue":    "Vue",
+	".svelte": "Svelte",
+	".zig":    "Zig",
+}
+
+// mainLanguage is the language with the most files among paths, or "" if
+// none are recognised.
+func mainLanguage(paths []string) string {
+	counts := map[string]int{}
+	best := ""
+	for _, p := range paths {
+		lang, ok := languages[strings.ToLower(filepath.Ext(p))]
+		if !ok {
+			continue
+		}
+		counts[lang]++
+		if counts[lang] > counts[best] {
+			best = lang
+		}
+	}
+	return best
+}
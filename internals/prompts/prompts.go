@@ -0,0 +1,159 @@
+// Package prompts renders the system prompts sent to the model. The defaults
+// are embedded in the binary; a repository can override any of them with a
+// template of the same name under .revly/prompts (or [prompts] dir).
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/gitutils"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+//go:embed templates/*.tmpl
+var defaults embed.FS
+
+// DefaultDir is where override templates are looked up when [prompts] dir
+// isn't set, relative to the repository root.
+const DefaultDir = ".revly/prompts"
+
+// Vars are the values available to templates.
+type Vars struct {
+	RepoName   string
+	Language   string
+	Branch     string
+	Guidelines string
+}
+
+// Template is a prompt template and where it was loaded from.
+type Template struct {
+	Name   string
+	Source string
+	// Origin is the override file's path, or "built-in".
+	Origin string
+}
+
+// Names lists the prompts revly uses.
+func Names() []string {
+	entries, _ := fs.ReadDir(defaults, "templates")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".tmpl"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the built-in source of a prompt.
+func Default(name string) (string, error) {
+	data, err := defaults.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		return "", fmt.Errorf("unknown prompt %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return string(data), nil
+}
+
+// Load returns the template for name, preferring an override on disk.
+func Load(cfg config.PromptsConfig, name string) (Template, error) {
+	source, err := Default(name)
+	if err != nil {
+		return Template{}, err
+	}
+
+	path := filepath.Join(Dir(cfg), name+".tmpl")
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		return Template{Name: name, Source: string(data), Origin: path}, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return Template{Name: name, Source: source, Origin: "built-in"}, nil
+	default:
+		return Template{}, fmt.Errorf("reading prompt override %s: %w", path, err)
+	}
+}
+
+// Dir is the directory override templates are read from. A relative
+// [prompts] dir is taken from the repository root.
+func Dir(cfg config.PromptsConfig) string {
+	if cfg.Dir != "" {
+		return repo.Resolve(cfg.Dir)
+	}
+	return repo.Resolve(DefaultDir)
+}
+
+// Render loads the named prompt and executes it with the current Vars.
+func Render(cfg config.PromptsConfig, name string) (string, error) {
+	t, err := Load(cfg, name)
+	if err != nil {
+		return "", err
+	}
+	vars, err := CurrentVars(cfg)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(vars)
+}
+
+// Execute renders the template with vars.
+func (t Template) Execute(vars Vars) (string, error) {
+	tmpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.Source)
+	if err != nil {
+		return "", fmt.Errorf("parsing prompt %s (%s): %w", t.Name, t.Origin, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", fmt.Errorf("rendering prompt %s (%s): %w", t.Name, t.Origin, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+var (
+	repoVarsOnce sync.Once
+	repoVars     Vars
+)
+
+// CurrentVars describes the repository revly is running in. The git lookups
+// are done once per process.
+func CurrentVars(cfg config.PromptsConfig) (Vars, error) {
+	repoVarsOnce.Do(func() {
+		repoVars = Vars{
+			RepoName: gitutils.RepoName(),
+			Branch:   gitutils.CurrentBranch(),
+		}
+		if files, err := gitutils.TrackedFiles(); err == nil {
+			repoVars.Language = mainLanguage(files)
+		}
+	})
+
+	vars := repoVars
+	guidelines, err := Guidelines(cfg)
+	if err != nil {
+		return Vars{}, err
+	}
+	vars.Guidelines = guidelines
+	return vars, nil
+}
+
+// Guidelines returns [prompts] guidelines, or else the contents of
+// guidelines_file.
+func Guidelines(cfg config.PromptsConfig) (string, error) {
+	if g := strings.TrimSpace(cfg.Guidelines); g != "" || cfg.GuidelinesFile == "" {
+		return g, nil
+	}
+	data, err := os.ReadFile(repo.Resolve(cfg.GuidelinesFile))
+	if err != nil {
+		return "", fmt.Errorf("reading [prompts] guidelines_file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,118 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+func TestDefaultsRender(t *testing.T) {
+	vars := Vars{RepoName: "revly", Language: "Go", Branch: "main", Guidelines: "Prefer small functions."}
+	for _, name := range Names() {
+		source, err := Default(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Template{Name: name, Source: source, Origin: "built-in"}.Execute(vars)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if out == "" || strings.Contains(out, "{{") {
+			t.Errorf("%s rendered to %q", name, out)
+		}
+	}
+	if _, err := Default("nope"); err == nil || !strings.Contains(err.Error(), "available: commit, pair, reduce, review") {
+		t.Errorf("Default(nope) err = %v", err)
+	}
+}
+
+func TestLoadPrefersOverride(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "commit.tmpl"), []byte("Commit to {{.RepoName}}."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.PromptsConfig{Dir: dir}
+
+	tmpl, err := Load(cfg, "commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Origin != filepath.Join(dir, "commit.tmpl") || tmpl.Source != "Commit to {{.RepoName}}." {
+		t.Errorf("commit = %+v, want the override", tmpl)
+	}
+	out, err := tmpl.Execute(Vars{RepoName: "revly"})
+	if err != nil || out != "Commit to revly." {
+		t.Errorf("Execute = %q, %v", out, err)
+	}
+
+	tmpl, err = Load(cfg, "pair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def, _ := Default("pair"); tmpl.Origin != "built-in" || tmpl.Source != def {
+		t.Errorf("pair = %+v, want the built-in", tmpl)
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"{{.RepoName", "parsing prompt review (x.tmpl)"},
+		{"{{.Nope}}", "rendering prompt review (x.tmpl)"},
+	}
+	for _, tt := range tests {
+		_, err := Template{Name: "review", Source: tt.source, Origin: "x.tmpl"}.Execute(Vars{})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Execute(%q) err = %v, want %q", tt.source, err, tt.err)
+		}
+	}
+}
+
+func TestGuidelines(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "GUIDELINES.md")
+	if err := os.WriteFile(file, []byte("\nUse table tests.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cfg  config.PromptsConfig
+		want string
+	}{
+		{config.PromptsConfig{Guidelines: " Inline wins. ", GuidelinesFile: file}, "Inline wins."},
+		{config.PromptsConfig{GuidelinesFile: file}, "Use table tests."},
+		{config.PromptsConfig{}, ""},
+	}
+	for _, tt := range tests {
+		vars, err := CurrentVars(tt.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vars.Guidelines != tt.want {
+			t.Errorf("guidelines = %q, want %q", vars.Guidelines, tt.want)
+		}
+	}
+	if _, err := CurrentVars(config.PromptsConfig{GuidelinesFile: file + ".missing"}); err == nil {
+		t.Error("a missing guidelines_file wasn't reported")
+	}
+}
+
+func TestMainLanguage(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"main.go", "go.mod", "cmd/root.go", "web/app.ts"}, "Go"},
+		{[]string{"a.TS", "b.tsx", "c.go"}, "TypeScript"},
+		{[]string{"README", "LICENSE"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := mainLanguage(tt.paths); got != tt.want {
+			t.Errorf("mainLanguage(%q) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Package redact finds credentials in text before it is sent to an LLM and
+// replaces them with placeholders. A secret gets the same placeholder every
+// time a Redactor sees it, so the model can still tell that two lines use the
+// same key, and a review can refer to it.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// rule is a pattern for one kind of secret. When the pattern has a capture
+// group, only the group is hidden, so "password = " stays readable.
+type rule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var builtin = []rule{
+	{"aws-access-key", regexp.MustCompile(`\b((?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16})\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|private).{0,20}?['"\s:=]+([A-Za-z0-9/+=]{40})\b`)},
+	{"github-token", regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"gitlab-token", regexp.MustCompile(`\b(glpat-[A-Za-z0-9_\-]{20,})`)},
+	{"slack-token", regexp.MustCompile(`\b(xox[abposr]-[A-Za-z0-9\-]{10,})`)},
+	{"stripe-key", regexp.MustCompile(`\b((?:sk|rk)_(?:live|test)_[A-Za-z0-9]{16,})`)},
+	{"google-api-key", regexp.MustCompile(`\b(AIza[0-9A-Za-z_\-]{35})`)},
+	{"llm-api-key", regexp.MustCompile(`\b(sk-(?:proj-|ant-|or-v1-)?[A-Za-z0-9_\-]{20,})`)},
+	{"jwt", regexp.MustCompile(`\b(eyJ[A-Za-z0-9_\-]{8,}\.eyJ[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]{8,})`)},
+	{"url-password", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.\-]*://[^/\s:@]+:([^@\s/]+)@`)},
+	{"secret-assignment", regexp.MustCompile(`(?i)(?:secret|token|passw(?:or)?d|api[_\-]?key|access[_\-]?key|private[_\-]?key|credentials?)[A-Za-z0-9_]*["']?\s*(?::=|=|:)\s*["']([^"'\s]{8,})["']`)},
+}
+
+var (
+	// quoted finds string literals that may hold a random-looking token.
+	quoted = regexp.MustCompile("[\"'`]([A-Za-z0-9+/=_\\-]{20,})[\"'`]")
+	// envLine is an assignment in a .env file.
+	envLine      = regexp.MustCompile(`^\s*(?:export\s+)?[A-Za-z_][A-Za-z0-9_]*\s*=\s*(.*?)\s*$`)
+	keyBegin     = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	keyEnd       = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	keyInline    = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----.*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	hexOnly      = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	placeholders = regexp.MustCompile(`^\[REDACTED_[A-Z0-9_]+\]$`)
+	// envName is the name of an environment variable, as in token_env = "API_TOKEN".
+	envName = regexp.MustCompile(`^[A-Z][A-Z0-9]*(_[A-Z0-9]+)+$`)
+)
+
+// Finding is one secret that was hidden.
+type Finding struct {
+	Rule string `json:"rule"`
+	// File is the file of the diff the secret was in, when the text is a diff.
+	File        string `json:"file,omitempty"`
+	Placeholder string `json:"placeholder"`
+}
+
+// Options adds to the built-in rules.
+type Options struct {
+	// Patterns are extra regular expressions matching secrets.
+	Patterns []string
+	// Allow are regular expressions for values never to hide.
+	Allow []string
+	// Entropy hides long, random-looking string literals.
+	Entropy bool
+}
+
+// Redactor hides secrets. It is safe for concurrent use.
+type Redactor struct {
+	rules   []rule
+	allow   []*regexp.Regexp
+	entropy bool
+
+	mu           sync.Mutex
+	placeholders map[string]string
+	counts       map[string]int
+}
+
+// New builds a Redactor with the built-in rules and those in opts.
+func New(opts Options) (*Redactor, error) {
+	r := &Redactor{
+		rules:        append([]rule{}, builtin...),
+		entropy:      opts.Entropy,
+		placeholders: map[string]string{},
+		counts:       map[string]int{},
+	}
+	for _, p := range opts.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.rules = append(r.rules, rule{"custom", re})
+	}
+	for _, p := range opts.Allow {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact allow pattern %q: %w", p, err)
+		}
+		r.allow = append(r.allow, re)
+	}
+	return r, nil
+}
+
+// Redact returns text with every secret replaced, and a finding for each
+// distinct secret. Text that is a git diff is followed file by file, so
+// .env files are hidden entirely and findings name their file.
+func (r *Redactor) Redact(text string) (string, []Finding) {
+	var findings []Finding
+	seen := map[string]bool{}
+	hide := func(rule, secret, file string) string {
+		p := r.placeholder(rule, secret)
+		if !seen[p] {
+			seen[p] = true
+			findings = append(findings, Finding{Rule: rule, File: file, Placeholder: p})
+		}
+		return p
+	}
+
+	lines := strings.Split(text, "\n")
+	file := ""
+	inKey := false
+	keyPlaceholder := ""
+	for i, line := range lines {
+		if f, ok := diffFile(line); ok {
+			file = f
+			continue
+		}
+		marker, body := splitMarker(line, file != "")
+
+		switch {
+		case keyBegin.MatchString(body):
+			// Whole keys on one line, as in a JSON string, are replaced in
+			// place; a key left open continues on the following lines.
+			body = keyInline.ReplaceAllStringFunc(body, func(key string) string { return hide("private-key", key, file) })
+			if keyBegin.MatchString(body) {
+				inKey = true
+				keyPlaceholder = ""
+				lines[i] = marker + body
+				continue
+			}
+		case inKey && keyEnd.MatchString(body):
+			inKey = false
+			continue
+		case inKey:
+			if keyPlaceholder == "" {
+				keyPlaceholder = hide("private-key", body, file)
+			}
+			lines[i] = marker + keyPlaceholder
+			continue
+		}
+
+		if isEnvFile(file) {
+			if m := envLine.FindStringSubmatchIndex(body); m != nil && !strings.HasPrefix(strings.TrimSpace(body), "#") {
+				value := strings.Trim(body[m[2]:m[3]], `"'`)
+				if value != "" && !r.allowed(value) && !placeholders.MatchString(value) {
+					lines[i] = marker + body[:m[2]] + hide("env-assignment", value, file)
+					continue
+				}
+			}
+		}
+
+		for _, rl := range r.rules {
+			body = r.replace(body, rl, func(secret string) string { return hide(rl.name, secret, file) })
+		}
+		if r.entropy {
+			body = r.replace(body, rule{"high-entropy", quoted}, func(secret string) string {
+				if !random(secret) {
+					return secret
+				}
+				return hide("high-entropy", secret, file)
+			})
+		}
+		lines[i] = marker + body
+	}
+	return strings.Join(lines, "\n"), findings
+}
+
+// replace hides every match of rl in s, or of its first group when it has
+// one. Allowed values and values that look like placeholders are kept.
+func (r *Redactor) replace(s string, rl rule, hide func(string) string) string {
+	matches := rl.re.FindAllStringSubmatchIndex(s, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		secret := s[start:end]
+		if r.allowed(secret) || notSecret(secret) {
+			continue
+		}
+		s = s[:start] + hide(secret) + s[end:]
+	}
+	return s
+}
+
+func (r *Redactor) allowed(value string) bool {
+	for _, re := range r.allow {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholder returns the placeholder for secret, numbering new secrets per
+// rule: [REDACTED_JWT_1], [REDACTED_JWT_2], ...
+func (r *Redactor) placeholder(rule, secret string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.placeholders[secret]; ok {
+		return p
+	}
+	r.counts[rule]++
+	p := fmt.Sprintf("[REDACTED_%s_%d]", strings.ToUpper(strings.ReplaceAll(rule, "-", "_")), r.counts[rule])
+	r.placeholders[secret] = p
+	return p
+}
+
+// notSecret reports values that are references or stand-ins rather than
+// secrets: ${VAR}, {{ .Token }}, <your-key>, variable names, and the like.
+func notSecret(v string) bool {
+	if placeholders.MatchString(v) || envName.MatchString(v) {
+		return true
+	}
+	for _, prefix := range []string{"$", "{{", "<", "%"} {
+		if strings.HasPrefix(v, prefix) {
+			return true
+		}
+	}
+	lower := strings.ToLower(v)
+	for _, word := range []string{"xxxx", "example", "changeme", "placeholder", "your-", "your_"} {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// random reports whether a string literal looks like a generated token
+// rather than a word, path or identifier.
+func random(s string) bool {
+	var lower, upper, digit bool
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	if hexOnly.MatchString(s) {
+		return len(s) >= 32 && digit && entropy(s) >= 3.5
+	}
+	return digit && lower && upper && entropy(s) >= 4.3
+}
+
+// entropy is the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, c := range s {
+		counts[c]++
+	}
+	var h float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// diffFile reports the file a diff header line starts, if it is one.
+func diffFile(line string) (string, bool) {
+	switch {
+	case strings.HasPrefix(line, "+++ "):
+		name := strings.TrimPrefix(line, "+++ ")
+		if name == "/dev/null" {
+			return "", false
+		}
+		return strings.TrimPrefix(name, "b/"), true
+	case strings.HasPrefix(line, "diff --git "):
+		if i := strings.LastIndex(line, " b/"); i >= 0 {
+			return line[i+3:], true
+		}
+	}
+	return "", false
+}
+
+// splitMarker splits the +, - or space a diff puts before each line from the
+// line itself.
+func splitMarker(line string, inDiff bool) (marker, body string) {
+	if inDiff && line != "" && strings.ContainsRune("+- ", rune(line[0])) && !strings.HasPrefix(line, "--- ") {
+		return line[:1], line[1:]
+	}
+	return "", line
+}
+
+// isEnvFile reports files like .env, .env.local and prod.env, whose values
+// are all treated as secrets.
+func isEnvFile(file string) bool {
+	base := path.Base(file)
+	return base == ".env" || strings.HasPrefix(base, ".env.") || strings.HasSuffix(base, ".env")
+}
+
+// SensitiveFile reports files made of secrets, such as .env files and
+// private keys, which should never be read into a prompt whole.
+func SensitiveFile(file string) bool {
+	if isEnvFile(file) {
+		return true
+	}
+	base := strings.ToLower(path.Base(file))
+	switch path.Ext(base) {
+	case ".pem", ".key", ".p12", ".pfx", ".jks", ".keystore":
+		return true
+	}
+	return strings.HasPrefix(base, "id_rsa") || strings.HasPrefix(base, "id_ecdsa") || strings.HasPrefix(base, "id_ed25519") ||
+		base == ".netrc" || base == ".npmrc" || base == ".pypirc" || base == "credentials.toml"
+}
+
+// Summary describes findings in one line, grouped by rule and file.
+func Summary(findings []Finding) string {
+	type group struct{ rule, file string }
+	counts := map[group]int{}
+	var order []group
+	for _, f := range findings {
+		g := group{f.Rule, f.File}
+		if counts[g] == 0 {
+			order = append(order, g)
+		}
+		counts[g]++
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].file < order[j].file })
+	var parts []string
+	for _, g := range order {
+		part := fmt.Sprintf("%d %s", counts[g], g.rule)
+		if g.file != "" {
+			part += " in " + g.file
+		}
+		parts = append(parts, part)
+	}
+	noun := "secrets"
+	if len(findings) == 1 {
+		noun = "secret"
+	}
+	return fmt.Sprintf("%d %s (%s)", len(findings), noun, strings.Join(parts, ", "))
+}
+
+// BlockedError is returned instead of sending text that holds secrets when
+// redaction is set to block.
+type BlockedError struct {
+	Findings []Finding
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("not sending anything to the LLM: found %s and redact.mode is \"block\"", Summary(e.Findings))
+}
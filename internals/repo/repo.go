@@ -0,0 +1,83 @@
+// Package repo locates the repository revly is running in. Its state
+// directory (.revly) and the repository's revly.config.toml live at the root,
+// so revly behaves the same from any subdirectory.
+package repo
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ConfigName is the repository config file, at the root.
+const ConfigName = "revly.config.toml"
+
+// StateName is the directory revly keeps its caches, logs and snapshots in.
+const StateName = ".revly"
+
+var (
+	rootOnce sync.Once
+	root     string
+	inRepo   bool
+)
+
+// Root returns the top level of the current git repository. Outside a
+// repository it is the working directory.
+func Root() string {
+	rootOnce.Do(func() {
+		out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+		if top := strings.TrimSpace(string(out)); err == nil && top != "" {
+			root, inRepo = filepath.Clean(top), true
+			return
+		}
+		root, _ = os.Getwd()
+	})
+	return root
+}
+
+// InRepo reports whether revly is running inside a git repository.
+func InRepo() bool {
+	Root()
+	return inRepo
+}
+
+// State returns a path inside the state directory, e.g. State("cache").
+func State(elem ...string) string {
+	return filepath.Join(append([]string{Root(), StateName}, elem...)...)
+}
+
+// ConfigFile is the path of the repository's config file.
+func ConfigFile() string {
+	return filepath.Join(Root(), ConfigName)
+}
+
+// Resolve makes a path from the config relative to the root.
+func Resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(Root(), path)
+}
+
+// RemoteURLs returns the URLs of the repository's remotes, origin first.
+func RemoteURLs() []string {
+	out, err := exec.Command("git", "config", "--get-regexp", `^remote\..*\.url$`).Output()
+	if err != nil {
+		return nil
+	}
+	var urls []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name, url, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if name == "remote.origin.url" {
+			urls = append([]string{url}, urls...)
+		} else {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
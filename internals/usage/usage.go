@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+	"github.com/nareshkarthigeyan/revly/internals/repo"
+)
+
+func ledgerFile() string {
+	return repo.State("usage.jsonl")
+}
+
+// Record is one successful model call.
+type Record struct {
+	Time             time.Time `json:"time"`
+	Command          string    `json:"command"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	// Estimated is set when the provider didn't report token counts and
+	// they were approximated from the text instead.
+	Estimated bool    `json:"estimated,omitempty"`
+	LatencyMs int64   `json:"latency_ms"`
+	CostUSD   float64 `json:"cost_usd"`
+}
+
+var mu sync.Mutex
+
+// Append adds r to the ledger. Calls may come from concurrent chunk reviews.
+func Append(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(ledgerFile()), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(ledgerFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Load reads every record in the ledger. A missing ledger is empty, and
+// lines that don't parse (e.g. a write cut short) are skipped.
+func Load() ([]Record, error) {
+	f, err := os.Open(ledgerFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Cost prices a call from the [pricing] table, in USD. Prices are per
+// million tokens. A model is matched exactly first, then against glob
+// patterns such as "*:free", longest pattern first; unpriced models cost
+// nothing.
+func Cost(pricing map[string]config.ModelPrice, model string, promptTokens, completionTokens int) float64 {
+	price, ok := pricing[model]
+	if !ok {
+		best := ""
+		for pattern, p := range pricing {
+			if matched, _ := path.Match(pattern, model); matched && len(pattern) > len(best) {
+				price, ok, best = p, true, pattern
+			}
+		}
+	}
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+}
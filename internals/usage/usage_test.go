@@ -0,0 +1,99 @@
+package usage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nareshkarthigeyan/revly/internals/config"
+)
+
+func TestCost(t *testing.T) {
+	pricing := map[string]config.ModelPrice{
+		"openai/gpt-4o":    {Prompt: 2.5, Completion: 10},
+		"openai/*":         {Prompt: 1, Completion: 1},
+		"*":                {Prompt: 100, Completion: 100},
+		"*:free":           {},
+		"anthropic/claude": {Prompt: 3, Completion: 15},
+	}
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"openai/gpt-4o", 2.5 + 10},
+		{"openai/gpt-4o-mini", 1 + 1},
+		{"meta/llama:free", 0},
+		{"anthropic/claude", 3 + 15},
+		{"local-model", 100 + 100},
+	}
+	for _, tt := range tests {
+		if got := Cost(pricing, tt.model, 1_000_000, 1_000_000); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%s) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+	if got := Cost(nil, "openai/gpt-4o", 1000, 1000); got != 0 {
+		t.Errorf("an unpriced model cost %v", got)
+	}
+	if got := Cost(pricing, "openai/gpt-4o", 2000, 500); math.Abs(got-0.01) > 1e-9 {
+		t.Errorf("Cost for 2000 and 500 tokens = %v, want 0.01", got)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if records, err := Load(); err != nil || records != nil {
+		t.Fatalf("Load of a missing ledger = %v, %v", records, err)
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := Append(Record{Time: at, Command: "review", Model: "m", PromptTokens: i, CompletionTokens: 1}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// A line cut short by a crash is skipped.
+	f, err := os.OpenFile(ledgerFile(), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time": "2026-01-02T03:04:05Z", "comm` + "\n")
+	f.Close()
+	if err := Append(Record{Time: at, Command: "commit", Model: "m", Estimated: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 21 {
+		t.Fatalf("loaded %d records, want 21", len(records))
+	}
+	sum := 0
+	for _, r := range records[:20] {
+		sum += r.PromptTokens
+		if !r.Time.Equal(at) || r.Command != "review" {
+			t.Errorf("record = %+v", r)
+		}
+	}
+	if sum != 190 {
+		t.Errorf("prompt tokens add up to %d, want 190: a concurrent append was lost or mangled", sum)
+	}
+	if last := records[20]; last.Command != "commit" || !last.Estimated {
+		t.Errorf("last record = %+v", last)
+	}
+	if filepath.Base(filepath.Dir(ledgerFile())) != ".revly" {
+		t.Errorf("ledger is at %s, want it in .revly", ledgerFile())
+	}
+}
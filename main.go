@@ -9,7 +9,6 @@ import (
 	"os"
 	"path/filepath"
 	"github.com/charmbracelet/glamour"
-	"github.com/joho/godotenv"
 	"github.com/nareshkarthigeyan/revly/cmd"
 )
 
@@ -32,14 +31,7 @@ func checkFirstRun() {
 			log.Fatal(err)
 		}
 
-		// Load .env if it exists
-		err = godotenv.Load()
-		var msg string
-		if err != nil {
-			msg = "No `.env` file found, proceeding without it.\nSet `OPENROUTER_KEY` in your environment variables.\n\nOr, run: `export OPENROUTER_KEY=your-api-key`"
-		} else {
-			msg = "`.env` file loaded successfully. Make sure `OPENROUTER_KEY` is set."
-		}
+		msg := "Welcome to revly!\n\nRun `revly init` to choose an LLM provider and models, then `revly auth login` to store your API key, or set `LLM_API_KEY` (or your provider's usual variable, such as `OPENROUTER_API_KEY`).\n\n`revly doctor` checks that everything is set up."
 
 		rendered, err := renderer.Render(msg)
 		if err != nil {